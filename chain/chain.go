@@ -0,0 +1,183 @@
+// Package chain describes the Graphene-based blockchains SteemWatch can be run against.
+package chain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Profile contains everything that differs between the supported chains.
+type Profile struct {
+	// Name is the chain name as used in the configuration, e.g. steem.
+	Name string `json:"name"`
+
+	// DisplayName is the chain name as shown to the users, e.g. Steem.
+	DisplayName string `json:"displayName"`
+
+	// CoreSymbol and DollarSymbol are the asset symbols used by the chain.
+	CoreSymbol   string `json:"coreSymbol"`
+	DollarSymbol string `json:"dollarSymbol"`
+
+	// FrontEnd is used to build the links in notifications
+	// unless the user chooses one of FrontEnds or a custom one.
+	FrontEnd  *FrontEnd   `json:"frontEnd"`
+	FrontEnds []*FrontEnd `json:"frontEnds"`
+
+	// IconURL is the URL of the chain logo used in rich notifications.
+	IconURL string `json:"iconURL"`
+
+	// ExplorerAccountURL is the URL template for account pages in a block explorer.
+	ExplorerAccountURL string `json:"explorerAccountURL"`
+
+	// ChatAvailable is true in case steemit.chat can be used with the chain.
+	ChatAvailable bool `json:"chatAvailable"`
+}
+
+// Steem is the default profile.
+var Steem = &Profile{
+	Name:         "steem",
+	DisplayName:  "Steem",
+	CoreSymbol:   "STEEM",
+	DollarSymbol: "SBD",
+	FrontEnd:     NewFrontEnd("steemit", "https://steemit.com"),
+	FrontEnds: []*FrontEnd{
+		NewFrontEnd("steemit", "https://steemit.com"),
+		{
+			Name:         "busy",
+			PostURL:      "https://busy.org/@{author}/{permlink}",
+			AccountURL:   "https://busy.org/@{author}",
+			TransfersURL: "https://busy.org/@{author}/transfers",
+		},
+		{
+			Name:         "steempeak",
+			PostURL:      "https://steempeak.com/{tag}/@{author}/{permlink}",
+			AccountURL:   "https://steempeak.com/@{author}",
+			TransfersURL: "https://steempeak.com/@{author}/wallet",
+		},
+	},
+	IconURL:            "https://steemit.com/images/favicons/favicon-96x96.png",
+	ExplorerAccountURL: "https://steemd.com/@{author}",
+	ChatAvailable:      true,
+}
+
+// Hive is the profile for the Hive fork of Steem.
+var Hive = &Profile{
+	Name:         "hive",
+	DisplayName:  "Hive",
+	CoreSymbol:   "HIVE",
+	DollarSymbol: "HBD",
+	FrontEnd:     NewFrontEnd("hiveblog", "https://hive.blog"),
+	FrontEnds: []*FrontEnd{
+		NewFrontEnd("hiveblog", "https://hive.blog"),
+		{
+			Name:         "peakd",
+			PostURL:      "https://peakd.com/{tag}/@{author}/{permlink}",
+			AccountURL:   "https://peakd.com/@{author}",
+			TransfersURL: "https://peakd.com/@{author}/wallet",
+		},
+		{
+			Name:         "ecency",
+			PostURL:      "https://ecency.com/{tag}/@{author}/{permlink}",
+			AccountURL:   "https://ecency.com/@{author}",
+			TransfersURL: "https://ecency.com/@{author}/wallet",
+		},
+	},
+	IconURL:            "https://hive.blog/images/favicons/favicon-96x96.png",
+	ExplorerAccountURL: "https://hiveblocks.com/@{author}",
+	ChatAvailable:      false,
+}
+
+var profiles = map[string]*Profile{
+	Steem.Name: Steem,
+	Hive.Name:  Hive,
+}
+
+// Lookup returns a copy of the profile with the given name.
+func Lookup(name string) (*Profile, error) {
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.Errorf("unknown chain: %v", name)
+	}
+	clone := *profile
+	frontEnd := *profile.FrontEnd
+	clone.FrontEnd = &frontEnd
+	return &clone, nil
+}
+
+// Preferences are the chain-related user preferences
+// passed to the notifiers along with the notifier settings.
+type Preferences struct {
+	FrontEnd *FrontEnd `bson:"frontEnd,omitempty"`
+}
+
+// ResolveFrontEnd returns the front-end matching the user's choice.
+// nil is returned in case the choice is not valid, the default front-end is to be used then.
+func (profile *Profile) ResolveFrontEnd(choice *FrontEnd) *FrontEnd {
+	if choice == nil {
+		return nil
+	}
+	if choice.Name == CustomFrontEnd {
+		if choice.Validate() != nil {
+			return nil
+		}
+		return choice
+	}
+	for _, fe := range profile.FrontEnds {
+		if fe.Name == choice.Name {
+			return fe
+		}
+	}
+	return nil
+}
+
+// WithFrontEnd returns a copy of the profile using the given front-end.
+// The profile itself is returned in case the front-end is nil.
+func (profile *Profile) WithFrontEnd(frontEnd *FrontEnd) *Profile {
+	if frontEnd == nil {
+		return profile
+	}
+	clone := *profile
+	clone.FrontEnd = frontEnd
+	return &clone
+}
+
+// ExplorerAccountLink returns the block explorer URL for the given account.
+func (profile *Profile) ExplorerAccountLink(account string) string {
+	return expand(profile.ExplorerAccountURL, map[string]string{
+		"author": account,
+	})
+}
+
+// FormatAmount makes sure the amount uses the asset symbols of the chain.
+// Some API nodes still return the legacy Steem symbols for forked chains.
+func (profile *Profile) FormatAmount(amount string) string {
+	i := strings.LastIndex(amount, " ")
+	if i == -1 {
+		return amount
+	}
+
+	value, symbol := amount[:i], amount[i+1:]
+	switch symbol {
+	case Steem.CoreSymbol:
+		symbol = profile.CoreSymbol
+	case Steem.DollarSymbol:
+		symbol = profile.DollarSymbol
+	}
+	return value + " " + symbol
+}
+
+// FormatEstimate formats an estimated amount using FormatAmount.
+// An empty amount means the estimate is not available.
+func (profile *Profile) FormatEstimate(amount string) string {
+	if amount == "" {
+		return "n/a"
+	}
+	return "~" + profile.FormatAmount(amount)
+}
+
+// FormatPrice formats the price of the core asset in the dollar asset, e.g. 0.950 SBD/STEEM.
+func (profile *Profile) FormatPrice(price float64) string {
+	return fmt.Sprintf("%.3f %v/%v", price, profile.DollarSymbol, profile.CoreSymbol)
+}
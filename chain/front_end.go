@@ -0,0 +1,105 @@
+package chain
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/pkg/errors"
+)
+
+// CustomFrontEnd is the name of the front-end defined by the user.
+const CustomFrontEnd = "custom"
+
+// FrontEnd builds links to a particular front-end using URL templates.
+//
+// The templates can contain {author}, {permlink} and {tag} placeholders.
+type FrontEnd struct {
+	Name         string `json:"name"                   bson:"name"`
+	PostURL      string `json:"postURL,omitempty"      bson:"postURL,omitempty"`
+	AccountURL   string `json:"accountURL,omitempty"   bson:"accountURL,omitempty"`
+	TransfersURL string `json:"transfersURL,omitempty" bson:"transfersURL,omitempty"`
+}
+
+// NewFrontEnd returns the front-end using the URL scheme of steemit.com on the given base URL.
+func NewFrontEnd(name, baseURL string) *FrontEnd {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &FrontEnd{
+		Name:         name,
+		PostURL:      baseURL + "/{tag}/@{author}/{permlink}",
+		AccountURL:   baseURL + "/@{author}",
+		TransfersURL: baseURL + "/@{author}/transfers",
+	}
+}
+
+// Validate makes sure the templates are absolute URLs containing the placeholders needed.
+// The transfers template is optional, the account page is used when it is missing.
+func (fe *FrontEnd) Validate() error {
+	templates := []struct {
+		field        string
+		value        string
+		placeholders []string
+	}{
+		{"postURL", fe.PostURL, []string{"{author}", "{permlink}"}},
+		{"accountURL", fe.AccountURL, []string{"{author}"}},
+		{"transfersURL", fe.TransfersURL, []string{"{author}"}},
+	}
+	for _, t := range templates {
+		if t.value == "" {
+			if t.field == "transfersURL" {
+				continue
+			}
+			return errors.Errorf("%v is not set", t.field)
+		}
+
+		u, err := url.Parse(expand(t.value, map[string]string{
+			"author":   "author",
+			"permlink": "permlink",
+			"tag":      "tag",
+		}))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("%v is not a valid http(s) URL template", t.field)
+		}
+		for _, placeholder := range t.placeholders {
+			if !strings.Contains(t.value, placeholder) {
+				return errors.Errorf("%v is missing %v", t.field, placeholder)
+			}
+		}
+	}
+	return nil
+}
+
+// Post returns the URL of the given content.
+func (fe *FrontEnd) Post(content *database.Content) string {
+	return expand(fe.PostURL, map[string]string{
+		"author":   content.Author,
+		"permlink": content.Permlink,
+		"tag":      content.Category,
+	})
+}
+
+// Account returns the URL of the given account.
+func (fe *FrontEnd) Account(account string) string {
+	return expand(fe.AccountURL, map[string]string{
+		"author": account,
+	})
+}
+
+// Transfers returns the URL of the wallet of the given account.
+func (fe *FrontEnd) Transfers(account string) string {
+	if fe.TransfersURL == "" {
+		return fe.Account(account)
+	}
+	return expand(fe.TransfersURL, map[string]string{
+		"author": account,
+	})
+}
+
+// expand replaces the {key} placeholders with the associated values, escaped.
+func expand(template string, values map[string]string) string {
+	pairs := make([]string, 0, 2*len(values))
+	for key, value := range values {
+		pairs = append(pairs, "{"+key+"}", url.PathEscape(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
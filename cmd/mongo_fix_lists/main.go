@@ -24,6 +24,7 @@ type Doc struct {
 	Users           []string      `bson:"users"`
 	AuthorBlacklist []string      `bson:"authorBlacklist"`
 	Tags            []string      `bson:"tags"`
+	TagBlacklist    []string      `bson:"tagBlacklist"`
 	Authors         []string      `bson:"authors"`
 	Voters          []string      `bson:"voters"`
 	ParentAuthors   []string      `bson:"parentAuthors"`
@@ -113,6 +114,7 @@ func run() error {
 		check(res.From, "from")
 		check(res.ParentAuthors, "parentAuthors")
 		check(res.Tags, "tags")
+		check(res.TagBlacklist, "tagBlacklist")
 		check(res.To, "to")
 		check(res.Users, "users")
 		check(res.Voters, "voters")
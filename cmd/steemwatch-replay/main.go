@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/chain"
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/notifications/notifiers/discord"
+	"github.com/tchap/steemwatch/steemd"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/go-steem/rpc"
+	"github.com/pkg/errors"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const usage = `Usage: steemwatch-replay [flags] <mongo-url> <from> <to>
+       steemwatch-replay -failed [flags] <mongo-url>`
+
+const (
+	modePrint = "print"
+	modeUser  = "user"
+	modeAll   = "all"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nError: %+v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	// Flags.
+	mode := flag.String("mode", modePrint,
+		"print the matches (print), deliver to a single user (user) or deliver to everyone (all)")
+	userId := flag.String("user", "", "user ID, required in user mode, optional in print mode")
+	steemdURLs := flag.String("steemd", "ws://localhost:8090",
+		"comma-separated steemd RPC endpoint addresses, ws(s):// or http(s)://")
+	workers := flag.Uint("workers", notifications.DefaultWorkerCount, "number of block processing workers")
+	maxAge := flag.Duration("catch-up-max-age", notifications.DefaultCatchUpMaxAge,
+		"events older than this are marked as delayed")
+	chainName := flag.String("chain", chain.Steem.Name, "chain the notifications are rendered for, steem or hive")
+	failed := flag.Bool("failed", false,
+		"list the recorded failed blocks (print) or retry them (all) instead of replaying a range")
+	flag.Parse()
+
+	// Get the arguments.
+	args := flag.Args()
+	if (*failed && len(args) != 1) || (!*failed && len(args) != 3) {
+		return errors.New(usage)
+	}
+	mongoURL := args[0]
+
+	var from, to uint64
+	if !*failed {
+		var err error
+		from, err = strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return errors.Wrapf(err, "invalid block number: %v", args[1])
+		}
+		to, err = strconv.ParseUint(args[2], 10, 32)
+		if err != nil {
+			return errors.Wrapf(err, "invalid block number: %v", args[2])
+		}
+	}
+
+	// Check the mode.
+	if *userId != "" && !bson.IsObjectIdHex(*userId) {
+		return errors.Errorf("invalid user ID: %v", *userId)
+	}
+
+	profile, err := chain.Lookup(*chainName)
+	if err != nil {
+		return err
+	}
+
+	var discordToken string
+	opts := []notifications.Option{
+		notifications.SetWorkerCount(*workers),
+		notifications.SetCatchUpPolicy(notifications.CatchUpDeliver, *maxAge),
+		notifications.SetChainProfile(profile),
+	}
+
+	switch *mode {
+	case modePrint:
+		opts = append(opts, notifications.SetDryRun(func(delivery *notifications.PlannedDelivery) {
+			fmt.Printf("MATCH block=%v trx=%v op=%v kind=%v user=%v notifier=%v\n",
+				delivery.Origin.BlockNum, delivery.Origin.TrxNum, delivery.Origin.OpNum,
+				delivery.Kind, delivery.UserId, delivery.NotifierId)
+		}))
+		if *userId != "" {
+			opts = append(opts, notifications.RestrictToUser(*userId))
+		}
+
+	case modeUser:
+		if *failed {
+			return errors.New("failed blocks can only be retried for all users")
+		}
+		if *userId == "" {
+			return errors.New("user mode requires -user to be set")
+		}
+		opts = append(opts, notifications.RestrictToUser(*userId))
+		fallthrough
+
+	case modeAll:
+		// Discord is only used in case the bot token is available.
+		discordToken = os.Getenv("STEEMWATCH_DISCORD_BOT_TOKEN")
+
+	default:
+		return errors.Errorf("unknown mode: %v", *mode)
+	}
+
+	// Connect to MongoDB.
+	conn, err := mgo.Dial(mongoURL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to dial MongoDB using URL %v", mongoURL)
+	}
+	defer conn.Close()
+
+	// Failed blocks are only listed in print mode.
+	if *failed && *mode == modePrint {
+		blocks, err := notifications.ListFailedBlocks(conn.DB(""))
+		if err != nil {
+			return err
+		}
+		for _, block := range blocks {
+			fmt.Printf("FAILED block=%v attempts=%v transient=%v at=%v error=%q\n",
+				block.BlockNum, block.Attempts, block.Transient,
+				block.FailedAt.Format(time.RFC3339), block.Error)
+		}
+		return nil
+	}
+
+	// Connect to steemd.
+	pool, err := steemd.NewPool(strings.Split(*steemdURLs, ","))
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	connect := func() (*rpc.Client, error) {
+		t, err := pool.NewTransport()
+		if err != nil {
+			return nil, err
+		}
+		client, err := rpc.NewClient(t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to instantiate the steemd RPC client")
+		}
+		return client, nil
+	}
+
+	// The notifiers and the callers are owned by the processor and closed on exit,
+	// so every processor created needs its own.
+	newOptions := func() ([]notifications.Option, error) {
+		processorOpts := append([]notifications.Option(nil), opts...)
+
+		if discordToken != "" {
+			dg, err := discordgo.New("Bot " + discordToken)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to initialize Discord")
+			}
+			processorOpts = append(processorOpts, notifications.AddStandardNotifier("discord",
+				discord.NewNotifier(dg, discord.SetChainProfile(profile))))
+		}
+
+		// Vote values are estimated using a dedicated transport.
+		valuation, err := pool.NewTransport()
+		if err != nil {
+			return nil, err
+		}
+		processorOpts = append(processorOpts,
+			notifications.SetVoteValuation(valuation, notifications.DefaultVoteValueRefreshInterval))
+
+		return processorOpts, nil
+	}
+
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Retry the failed blocks.
+	if *failed {
+		log.Println("Retrying failed blocks ...")
+		fixed, failedAgain, err := notifications.RetryFailedBlocks(client, connect, conn.DB(""), newOptions)
+		for _, blockNum := range fixed {
+			log.Printf("Block %v processed successfully.", blockNum)
+		}
+		for _, block := range failedAgain {
+			log.Printf("Block %v failed again: %v", block.BlockNum, block.Error)
+		}
+		return err
+	}
+
+	// Replay the blocks.
+	log.Printf("Replaying blocks %v-%v in %v mode ...", from, to, *mode)
+	processorOpts, err := newOptions()
+	if err != nil {
+		return err
+	}
+	err = notifications.Replay(client, connect, conn.DB(""), uint32(from), uint32(to), processorOpts...)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Replay finished successfully.")
+	return nil
+}
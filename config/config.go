@@ -1,6 +1,10 @@
 package config
 
 import (
+	"time"
+
+	"github.com/tchap/steemwatch/chain"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 )
@@ -11,6 +15,26 @@ type Config struct {
 	ListenAddress string `envconfig:"LISTEN_ADDRESS" default:"127.0.0.1:8080"`
 	CanonicalURL  string `envconfig:"CANONICAL_URL"  default:"http://localhost:8080"`
 
+	// LogLevel is one of debug, info, warning, error.
+	// LogFormat is either text or json.
+	LogLevel  string `envconfig:"LOG_LEVEL"  default:"info"`
+	LogFormat string `envconfig:"LOG_FORMAT" default:"text"`
+
+	// The admin server serves profiling and metrics, health checks stay on the public server.
+	// Unless it is bound to the loopback interface, the admin token must be set.
+	AdminListenAddress string `envconfig:"ADMIN_LISTEN_ADDRESS" default:"127.0.0.1:8081"`
+	AdminToken         string `envconfig:"ADMIN_TOKEN"`
+
+	// Chain selects the chain profile, steem or hive.
+	// The profile defaults can be overridden using the other CHAIN_ variables.
+	Chain             string `envconfig:"CHAIN"               default:"steem"`
+	ChainCoreSymbol   string `envconfig:"CHAIN_CORE_SYMBOL"`
+	ChainDollarSymbol string `envconfig:"CHAIN_DOLLAR_SYMBOL"`
+	ChainFrontEndURL  string `envconfig:"CHAIN_FRONT_END_URL"`
+	ChainChatDisabled bool   `envconfig:"CHAIN_CHAT_DISABLED"`
+
+	chainProfile *chain.Profile
+
 	FacebookClientId     string `envconfig:"FACEBOOK_CLIENT_ID"     required:"true"`
 	FacebookClientSecret string `envconfig:"FACEBOOK_CLIENT_SECRET" required:"true"`
 
@@ -32,7 +56,46 @@ type Config struct {
 	SteemdDisabled             bool     `envconfig:"STEEMD_DISABLED"`
 	SteemdRPCEndpointAddresses []string `envconfig:"STEEMD_RPC_ENDPOINT_ADDRESSES" default:"ws://localhost:8090"`
 
-	BlockProcessorWorkerCount uint `envconfig:"BLOCK_PROCESSOR_WORKER_COUNT" default:"10"`
+	// The endpoints can be ws(s):// or http(s):// URLs. An endpoint lagging more than
+	// SteemdMaxBlocksBehind blocks behind the other endpoints is avoided, so is an endpoint
+	// reporting a head block older than SteemdMaxHeadAge.
+	SteemdMaxBlocksBehind uint32        `envconfig:"STEEMD_MAX_BLOCKS_BEHIND" default:"20"`
+	SteemdMaxHeadAge      time.Duration `envconfig:"STEEMD_MAX_HEAD_AGE"      default:"1m"`
+
+	BlockProcessorWorkerCount uint   `envconfig:"BLOCK_PROCESSOR_WORKER_COUNT" default:"10"`
+	BlockProcessorMode        string `envconfig:"BLOCK_PROCESSOR_MODE"         default:"head"`
+
+	// A block failing this many times is recorded in the failedBlocks collection and skipped.
+	BlockProcessorMaxAttempts uint `envconfig:"BLOCK_PROCESSOR_MAX_ATTEMPTS" default:"5"`
+
+	CatchUpPolicy string        `envconfig:"CATCH_UP_POLICY"  default:"deliver"`
+	CatchUpMaxAge time.Duration `envconfig:"CATCH_UP_MAX_AGE" default:"10m"`
+
+	// Content fetched from steemd is cached for a short time, a post receiving
+	// many votes is only fetched once that way. Set the size to 0 to disable the cache.
+	ContentCacheSize int           `envconfig:"CONTENT_CACHE_SIZE" default:"10000"`
+	ContentCacheTTL  time.Duration `envconfig:"CONTENT_CACHE_TTL"  default:"30s"`
+
+	// The reward fund and the median price used to estimate vote values are refreshed this often.
+	VoteValueRefreshInterval time.Duration `envconfig:"VOTE_VALUE_REFRESH_INTERVAL" default:"5m"`
+
+	// The accounts with thresholds set by the users are checked this often.
+	AccountPollInterval time.Duration `envconfig:"ACCOUNT_POLL_INTERVAL" default:"1m"`
+
+	// The median price feed is checked this often for price.alert.
+	PricePollInterval time.Duration `envconfig:"PRICE_POLL_INTERVAL" default:"5m"`
+
+	// story.payout_soon is fired this long before the story pays out.
+	PayoutReminderLeadTime time.Duration `envconfig:"PAYOUT_REMINDER_LEAD_TIME" default:"12h"`
+
+	DispatchQueueSize   uint `envconfig:"DISPATCH_QUEUE_SIZE"  default:"1000"`
+	NotifierConcurrency uint `envconfig:"NOTIFIER_CONCURRENCY" default:"10"`
+
+	// HealthMaxBlockLag is how far behind the block processor can be to be considered ready.
+	HealthMaxBlockLag time.Duration `envconfig:"HEALTH_MAX_BLOCK_LAG" default:"5m"`
+	// HealthMaxBlockStall is how long the block processor can go without processing a block
+	// before it is considered stuck.
+	HealthMaxBlockStall time.Duration `envconfig:"HEALTH_MAX_BLOCK_STALL" default:"5m"`
 }
 
 func Load() (*Config, error) {
@@ -40,5 +103,29 @@ func Load() (*Config, error) {
 	if err := envconfig.Process("STEEMWATCH", &config); err != nil {
 		return nil, errors.Wrap(err, "failed to load config from the environment")
 	}
+
+	profile, err := chain.Lookup(config.Chain)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load config from the environment")
+	}
+	if config.ChainCoreSymbol != "" {
+		profile.CoreSymbol = config.ChainCoreSymbol
+	}
+	if config.ChainDollarSymbol != "" {
+		profile.DollarSymbol = config.ChainDollarSymbol
+	}
+	if config.ChainFrontEndURL != "" {
+		profile.FrontEnd = chain.NewFrontEnd("default", config.ChainFrontEndURL)
+	}
+	if config.ChainChatDisabled {
+		profile.ChatAvailable = false
+	}
+	config.chainProfile = profile
+
 	return &config, nil
 }
+
+// ChainProfile returns the chain profile with the overrides applied.
+func (config *Config) ChainProfile() *chain.Profile {
+	return config.chainProfile
+}
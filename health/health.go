@@ -0,0 +1,149 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultCheckTimeout = 5 * time.Second
+
+// Check returns an error in case the checked component is not healthy.
+type Check func() error
+
+// Cached returns a check that only runs the given check once per ttl,
+// the last result is returned otherwise. This is useful for checks
+// calling external services that should not be hit on every probe.
+func Cached(check Check, ttl time.Duration) Check {
+	var (
+		err       error
+		checkedAt time.Time
+		lock      sync.Mutex
+	)
+	return func() error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if checkedAt.IsZero() || time.Since(checkedAt) >= ttl {
+			err = check()
+			checkedAt = time.Now()
+		}
+		return err
+	}
+}
+
+type Kind int
+
+const (
+	// Readiness checks decide whether the process should be receiving traffic.
+	Readiness Kind = iota
+
+	// Liveness checks decide whether the process should be restarted.
+	// They are included in the readiness checks as well.
+	Liveness
+)
+
+// Status is the result of a single check.
+type Status struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	kind  Kind
+	check Check
+}
+
+// Checker holds the registered checks. Checks can be added any time,
+// since the components being checked are started one by one.
+type Checker struct {
+	checks  []*namedCheck
+	timeout time.Duration
+	lock    sync.RWMutex
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		timeout: DefaultCheckTimeout,
+	}
+}
+
+func (checker *Checker) Add(name string, kind Kind, check Check) {
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	checker.checks = append(checker.checks, &namedCheck{name, kind, check})
+}
+
+// Live runs the liveness checks.
+func (checker *Checker) Live() (bool, []*Status) {
+	return checker.run(Liveness)
+}
+
+// Ready runs all the checks.
+func (checker *Checker) Ready() (bool, []*Status) {
+	return checker.run(Readiness)
+}
+
+// run runs the checks of the given kind or higher concurrently.
+// Checks not finishing in time are considered failed.
+func (checker *Checker) run(kind Kind) (bool, []*Status) {
+	checker.lock.RLock()
+	var checks []*namedCheck
+	for _, check := range checker.checks {
+		if check.kind >= kind {
+			checks = append(checks, check)
+		}
+	}
+	checker.lock.RUnlock()
+
+	statusCh := make(chan *Status, len(checks))
+	for _, check := range checks {
+		go func(check *namedCheck) {
+			status := &Status{Name: check.name, OK: true}
+			if err := check.check(); err != nil {
+				status.OK = false
+				status.Message = err.Error()
+			}
+			statusCh <- status
+		}(check)
+	}
+
+	var (
+		ok       = true
+		statuses = make([]*Status, 0, len(checks))
+		pending  = make(map[string]struct{}, len(checks))
+		timeout  = time.After(checker.timeout)
+	)
+	for _, check := range checks {
+		pending[check.name] = struct{}{}
+	}
+
+Collect:
+	for range checks {
+		select {
+		case status := <-statusCh:
+			delete(pending, status.Name)
+			statuses = append(statuses, status)
+			if !status.OK {
+				ok = false
+			}
+		case <-timeout:
+			break Collect
+		}
+	}
+	for name := range pending {
+		ok = false
+		statuses = append(statuses, &Status{
+			Name:    name,
+			Message: fmt.Sprintf("timed out after %v", checker.timeout),
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return ok, statuses
+}
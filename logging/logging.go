@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New returns a logger writing to stderr using the given level and format.
+func New(level, format string) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.Out = os.Stderr
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid log level: %v", level)
+	}
+	logger.Level = lvl
+
+	switch format {
+	case FormatText:
+		logger.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	case FormatJSON:
+		logger.Formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, errors.Errorf("invalid log format: %v", format)
+	}
+
+	return logger, nil
+}
@@ -1,27 +1,29 @@
 package main
 
 import (
-	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/tchap/steemwatch/config"
+	"github.com/tchap/steemwatch/health"
+	"github.com/tchap/steemwatch/logging"
 	"github.com/tchap/steemwatch/notifications"
 	"github.com/tchap/steemwatch/notifications/notifiers/discord"
 	"github.com/tchap/steemwatch/server"
+	"github.com/tchap/steemwatch/steemd"
 
 	"github.com/go-steem/rpc"
-	"github.com/go-steem/rpc/transports/websocket"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/steemwatch/blockfetcher"
 	mgo "gopkg.in/mgo.v2"
 )
 
 func main() {
 	if err := _main(); err != nil {
-		log.Fatalf("Error: %+v", err)
+		logrus.Fatalf("Error: %+v", err)
 	}
 }
 
@@ -32,6 +34,13 @@ func _main() error {
 		return err
 	}
 
+	// Set up logging.
+	logger, err := logging.New(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	rootLogger := logrus.NewEntry(logger)
+
 	// Connect to MongoDB.
 	wMongo, err := mgo.Dial(cfg.MongoURL)
 	if err != nil {
@@ -48,16 +57,44 @@ func _main() error {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
+	checker := health.NewChecker()
+
+	// Set up the steemd endpoint pool shared by all the steemd clients.
+	var pool *steemd.Pool
+	if !cfg.SteemdDisabled {
+		pool, err = steemd.NewPool(cfg.SteemdRPCEndpointAddresses,
+			steemd.SetMaxBlocksBehind(cfg.SteemdMaxBlocksBehind),
+			steemd.SetMaxHeadAge(cfg.SteemdMaxHeadAge),
+			steemd.SetLogger(rootLogger.WithField("component", "steemd")))
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		checker.Add("steemd", health.Readiness, pool.Check)
+	}
+
 	// Start the web server.
-	serverCtx, dg, err := server.Run(wDB, cfg)
+	serverCtx, dg, err := server.Run(wDB, cfg, checker, rootLogger.WithField("component", "server"), pool)
 	if err != nil {
 		return err
 	}
 
 	// Start notifications.
-	notificationsCtx, client, err := runNotifications(nDB, cfg,
+	notificationsCtx, client, err := runNotifications(nDB, cfg, checker, pool,
+		notifications.SetLogger(rootLogger.WithField("component", "notifications")),
 		notifications.SetWorkerCount(cfg.BlockProcessorWorkerCount),
-		notifications.AddStandardNotifier("discord", discord.NewNotifier(dg)),
+		notifications.SetMode(cfg.BlockProcessorMode),
+		notifications.SetBlockRetryPolicy(cfg.BlockProcessorMaxAttempts,
+			notifications.DefaultBlockRetryMinDelay, notifications.DefaultBlockRetryMaxDelay),
+		notifications.SetCatchUpPolicy(cfg.CatchUpPolicy, cfg.CatchUpMaxAge),
+		notifications.SetContentCache(cfg.ContentCacheSize, cfg.ContentCacheTTL),
+		notifications.SetPayoutReminderLeadTime(cfg.PayoutReminderLeadTime),
+		notifications.SetDispatchQueueSize(cfg.DispatchQueueSize),
+		notifications.SetNotifierConcurrency("", cfg.NotifierConcurrency),
+		notifications.SetChainProfile(cfg.ChainProfile()),
+		notifications.AddStandardNotifier("discord",
+			discord.NewNotifier(dg, discord.SetChainProfile(cfg.ChainProfile()))),
 		notifications.AddNotifier("websocket", serverCtx.EventStreamManager))
 	if err != nil {
 		return err
@@ -68,7 +105,7 @@ func _main() error {
 	go func() {
 		<-signalCh
 		signal.Stop(signalCh)
-		log.Println("Signal received, exiting...")
+		rootLogger.Info("Signal received, exiting...")
 
 		serverCtx.Interrupt()
 
@@ -84,7 +121,7 @@ func _main() error {
 		if notificationsCtx != nil {
 			err = notificationsCtx.Wait()
 			if err != nil {
-				log.Printf("Notifications error: %+v", err)
+				rootLogger.Errorf("Notifications error: %+v", err)
 			}
 		}
 		errCh <- err
@@ -93,7 +130,7 @@ func _main() error {
 	go func() {
 		err := serverCtx.Wait()
 		if err != nil {
-			log.Printf("Web server error: %+v", err)
+			rootLogger.Errorf("Web server error: %+v", err)
 		}
 		errCh <- err
 	}()
@@ -109,33 +146,19 @@ func _main() error {
 func runNotifications(
 	db *mgo.Database,
 	cfg *config.Config,
+	checker *health.Checker,
+	pool *steemd.Pool,
 	opts ...notifications.Option,
 ) (*blockfetcher.Context, *rpc.Client, error) {
 
-	if cfg.SteemdDisabled {
+	if pool == nil {
 		return nil, nil, nil
 	}
 
 	connect := func() (*rpc.Client, error) {
-		// Monitor the connection to steemd.
-		monitorChan := make(chan interface{})
-		go func() {
-			for event := range monitorChan {
-				log.Println("steemd connection:", event)
-			}
-		}()
-
-		// Connect to steemd.
-		t, err := websocket.NewTransport(cfg.SteemdRPCEndpointAddresses,
-			websocket.SetDialTimeout(1*time.Minute),
-			websocket.SetWriteTimeout(30*time.Second),
-			websocket.SetReadTimeout(1*time.Minute),
-			websocket.SetAutoReconnectEnabled(true),
-			websocket.SetAutoReconnectMaxDelay(1*time.Minute),
-			websocket.SetMonitor(monitorChan))
+		t, err := pool.NewTransport()
 		if err != nil {
-			return nil, errors.Wrap(
-				err, "failed to connect initialize WebSocket transport")
+			return nil, err
 		}
 		client, err := rpc.NewClient(t)
 		if err != nil {
@@ -144,9 +167,36 @@ func runNotifications(
 		return client, nil
 	}
 
+	// Vote values are estimated using a dedicated transport owned by the processor.
+	valuation, err := pool.NewTransport()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, notifications.SetVoteValuation(valuation, cfg.VoteValueRefreshInterval))
+
+	// The same goes for the account threshold poller.
+	accounts, err := pool.NewTransport()
+	if err != nil {
+		valuation.Close()
+		return nil, nil, err
+	}
+	opts = append(opts, notifications.SetAccountPolling(accounts, cfg.AccountPollInterval))
+
+	// And the median price feed watcher.
+	prices, err := pool.NewTransport()
+	if err != nil {
+		valuation.Close()
+		accounts.Close()
+		return nil, nil, err
+	}
+	opts = append(opts, notifications.SetPriceFeedPolling(prices, cfg.PricePollInterval))
+
 	// Start the block processor.
 	client, err := connect()
 	if err != nil {
+		valuation.Close()
+		accounts.Close()
+		prices.Close()
 		return nil, nil, err
 	}
 	ctx, err := notifications.Run(client, connect, db, opts...)
@@ -154,5 +204,31 @@ func runNotifications(
 		client.Close()
 		return nil, nil, err
 	}
+
+	// The processor is stuck in case no block is processed for too long.
+	startedAt := time.Now()
+	checker.Add("block_processor", health.Liveness, func() error {
+		_, processedAt := notifications.LastBlock()
+		if processedAt.IsZero() {
+			processedAt = startedAt
+		}
+		if d := time.Since(processedAt); d > cfg.HealthMaxBlockStall {
+			return errors.Errorf("no block processed for %v", d.Truncate(time.Second))
+		}
+		return nil
+	})
+
+	// The processor is not ready while catching up.
+	checker.Add("block_lag", health.Readiness, func() error {
+		timestamp, _ := notifications.LastBlock()
+		if timestamp.IsZero() {
+			return errors.New("no block processed yet")
+		}
+		if lag := time.Since(timestamp); lag > cfg.HealthMaxBlockLag {
+			return errors.Errorf("block lag %v exceeds %v", lag.Truncate(time.Second), cfg.HealthMaxBlockLag)
+		}
+		return nil
+	})
+
 	return ctx, client, nil
 }
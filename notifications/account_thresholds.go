@@ -0,0 +1,416 @@
+package notifications
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultAccountPollInterval = time.Minute
+
+// manaRegenerationPeriod is how long it takes for voting mana and resource credits
+// to regenerate from 0 to 100%.
+const manaRegenerationPeriod = 5 * 24 * time.Hour
+
+// accountsPerCall is the number of accounts fetched from steemd using a single call.
+const accountsPerCall = 100
+
+// AccountThreshold makes the user notified when the metric of the account
+// drops below the threshold.
+//
+// Once the alert is sent, the threshold is only armed again when the metric
+// recovers to Threshold + Hysteresis, so that the alerts do not flap.
+type AccountThreshold struct {
+	Id         bson.ObjectId `json:"id"                  bson:"_id,omitempty"`
+	OwnerId    bson.ObjectId `json:"-"                   bson:"ownerId"`
+	Account    string        `json:"account"             bson:"account"`
+	Metric     string        `json:"metric"              bson:"metric"`
+	Threshold  float64       `json:"threshold"           bson:"threshold"`
+	Hysteresis float64       `json:"hysteresis"          bson:"hysteresis"`
+	Below      bool          `json:"below"               bson:"below"`
+	Value      *float64      `json:"value,omitempty"     bson:"value,omitempty"`
+	CheckedAt  *time.Time    `json:"checkedAt,omitempty" bson:"checkedAt,omitempty"`
+}
+
+// Validate makes sure the threshold can be evaluated.
+// The default hysteresis for the metric is filled in when not set.
+func (threshold *AccountThreshold) Validate() error {
+	if threshold.Account == "" {
+		return errors.New("account is not set")
+	}
+
+	switch threshold.Metric {
+	case events.MetricVotingPower, events.MetricResourceCredits:
+		if threshold.Threshold <= 0 || threshold.Threshold >= 100 {
+			return errors.New("threshold must be between 0 and 100 percent")
+		}
+		if threshold.Hysteresis == 0 {
+			threshold.Hysteresis = 5
+		}
+	case events.MetricBalance:
+		if threshold.Threshold <= 0 {
+			return errors.New("threshold must be positive")
+		}
+		if threshold.Hysteresis == 0 {
+			threshold.Hysteresis = threshold.Threshold / 10
+		}
+	default:
+		return errors.Errorf("unknown metric: %v", threshold.Metric)
+	}
+
+	if threshold.Hysteresis < 0 {
+		return errors.New("hysteresis must not be negative")
+	}
+	return nil
+}
+
+// Evaluate returns the state of the threshold for the current value of the metric.
+// Crossed is set in case the value dropped below the threshold, i.e. the alert is to be sent.
+func (threshold *AccountThreshold) Evaluate(value float64) (below, crossed bool) {
+	switch {
+	case !threshold.Below && value < threshold.Threshold:
+		return true, true
+	case threshold.Below && value >= threshold.Threshold+threshold.Hysteresis:
+		return false, false
+	default:
+		return threshold.Below, false
+	}
+}
+
+// crossingKey identifies the alert for the threshold being crossed.
+// The key stays the same until the threshold state is updated,
+// so the alert can be retried without notifying anybody twice.
+func (threshold *AccountThreshold) crossingKey() string {
+	var checkedAt int64
+	if threshold.CheckedAt != nil {
+		checkedAt = threshold.CheckedAt.UnixNano()
+	}
+	return fmt.Sprintf("accountThresholds:%v:%v", threshold.Id.Hex(), checkedAt)
+}
+
+// SetAccountPolling enables the account threshold poller.
+//
+// The watched accounts are fetched using the given caller every interval.
+// The processor takes ownership of the caller and closes it on exit.
+func SetAccountPolling(caller interfaces.CallCloser, interval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.accountPollCaller = caller
+		processor.accountPollInterval = interval
+	}
+}
+
+func ensureAccountThresholdIndexes(db *mgo.Database) error {
+	for _, key := range []string{"ownerId", "account"} {
+		err := db.C("accountThresholds").EnsureIndex(mgo.Index{
+			Key:        []string{key},
+			Background: true,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to create index for accountThresholds.%v", key)
+		}
+	}
+	return nil
+}
+
+// startAccountPoller starts polling the watched accounts, if enabled.
+func (processor *BlockProcessor) startAccountPoller() {
+	caller := processor.accountPollCaller
+	if caller == nil {
+		return
+	}
+
+	poller := &accountPoller{
+		db:     processor.db,
+		caller: caller,
+		dispatch: func(userId string, event *events.AccountThresholdCrossed) bool {
+			return processor.dispatchDetached(&event.Origin, func() {
+				processor.DispatchAccountThresholdCrossedEvent(userId, event)
+			})
+		},
+		logger: processor.logger.WithField("component", "account_poller"),
+	}
+	processor.t.Go(func() error {
+		defer caller.Close()
+		return poller.loop(processor.accountPollInterval, processor.t.Dying())
+	})
+}
+
+// accountPoller periodically checks the account thresholds set by the users.
+//
+// The thresholds are loaded from the database on every run,
+// the state of every threshold is stored back there as well.
+//
+// The dispatch function returns false in case the alert could not be sent,
+// the threshold state is not updated then so that the alert is sent again.
+type accountPoller struct {
+	db       *mgo.Database
+	caller   interfaces.Caller
+	dispatch func(userId string, event *events.AccountThresholdCrossed) bool
+	logger   *logrus.Entry
+}
+
+func (poller *accountPoller) loop(interval time.Duration, dying <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := poller.poll(); err != nil {
+			poller.logger.WithError(err).Warn("Failed checking account thresholds")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-dying:
+			return nil
+		}
+	}
+}
+
+func (poller *accountPoller) poll() error {
+	var thresholds []*AccountThreshold
+	if err := poller.db.C("accountThresholds").Find(nil).All(&thresholds); err != nil {
+		return errors.Wrap(err, "failed to load account thresholds")
+	}
+	if len(thresholds) == 0 {
+		return nil
+	}
+
+	// Collect the accounts to fetch.
+	var (
+		accounts   []string
+		seen       = make(map[string]struct{})
+		rcAccounts []string
+		rcSeen     = make(map[string]struct{})
+	)
+	for _, threshold := range thresholds {
+		if _, ok := seen[threshold.Account]; !ok {
+			seen[threshold.Account] = struct{}{}
+			accounts = append(accounts, threshold.Account)
+		}
+		if threshold.Metric == events.MetricResourceCredits {
+			if _, ok := rcSeen[threshold.Account]; !ok {
+				rcSeen[threshold.Account] = struct{}{}
+				rcAccounts = append(rcAccounts, threshold.Account)
+			}
+		}
+	}
+
+	now := time.Now()
+	metrics, err := poller.fetchAccountMetrics(accounts, now)
+	if err != nil {
+		return err
+	}
+	if len(rcAccounts) != 0 {
+		if err := poller.fetchResourceCredits(rcAccounts, now, metrics); err != nil {
+			return err
+		}
+	}
+
+	// Evaluate the thresholds.
+	bulk := poller.db.C("accountThresholds").Bulk()
+	bulk.Unordered()
+	for _, threshold := range thresholds {
+		value, ok := metrics[threshold.Account][threshold.Metric]
+		if !ok {
+			continue
+		}
+
+		below, crossed := threshold.Evaluate(value)
+		if crossed {
+			sent := poller.dispatch(threshold.OwnerId.Hex(), &events.AccountThresholdCrossed{
+				Account:   threshold.Account,
+				Metric:    threshold.Metric,
+				Threshold: threshold.Threshold,
+				Value:     value,
+				Origin: events.Origin{
+					Key:       threshold.crossingKey(),
+					Timestamp: now,
+				},
+			})
+			if !sent {
+				continue
+			}
+		}
+
+		// The threshold is not updated in case the user modified it in the meantime.
+		bulk.Update(bson.M{
+			"_id":       threshold.Id,
+			"metric":    threshold.Metric,
+			"threshold": threshold.Threshold,
+		}, bson.M{
+			"$set": bson.M{
+				"below":     below,
+				"value":     value,
+				"checkedAt": now,
+			},
+		})
+	}
+	if _, err := bulk.Run(); err != nil {
+		return errors.Wrap(err, "failed to update account thresholds")
+	}
+	return nil
+}
+
+// fetchAccountMetrics returns account -> metric -> value for the given accounts.
+// The accounts the metrics cannot be computed for are logged and left out.
+func (poller *accountPoller) fetchAccountMetrics(
+	accounts []string,
+	now time.Time,
+) (map[string]map[string]float64, error) {
+
+	metrics := make(map[string]map[string]float64, len(accounts))
+	for i := 0; i < len(accounts); i += accountsPerCall {
+		end := i + accountsPerCall
+		if end > len(accounts) {
+			end = len(accounts)
+		}
+
+		var resp []*accountState
+		if err := poller.caller.Call("get_accounts", []interface{}{accounts[i:end]}, &resp); err != nil {
+			return nil, errors.Wrap(err, "failed to get accounts")
+		}
+		for _, account := range resp {
+			balance, err := parseAmount(account.Balance)
+			if err != nil {
+				poller.logger.WithError(err).WithField("account", account.Name).
+					Warn("Invalid account balance, skipping the account")
+				continue
+			}
+			votingPower, err := account.VotingPower(now)
+			if err != nil {
+				poller.logger.WithError(err).WithField("account", account.Name).
+					Warn("Failed getting voting power, skipping the account")
+				continue
+			}
+			metrics[account.Name] = map[string]float64{
+				events.MetricBalance:     balance,
+				events.MetricVotingPower: votingPower,
+			}
+		}
+	}
+	return metrics, nil
+}
+
+// fetchResourceCredits adds the resource credits to the metrics of the given accounts.
+// Nodes not running the RC plugin are only logged, the accounts are skipped then.
+func (poller *accountPoller) fetchResourceCredits(
+	accounts []string,
+	now time.Time,
+	metrics map[string]map[string]float64,
+) error {
+
+	for i := 0; i < len(accounts); i += accountsPerCall {
+		end := i + accountsPerCall
+		if end > len(accounts) {
+			end = len(accounts)
+		}
+
+		var resp struct {
+			RCAccounts []*struct {
+				Account   string    `json:"account"`
+				RCManabar manabar   `json:"rc_manabar"`
+				MaxRC     flexFloat `json:"max_rc"`
+			} `json:"rc_accounts"`
+		}
+		params := map[string]interface{}{"accounts": accounts[i:end]}
+		if err := poller.caller.Call("rc_api.find_rc_accounts", params, &resp); err != nil {
+			poller.logger.WithError(err).Warn("Failed getting resource credits")
+			return nil
+		}
+		for _, rc := range resp.RCAccounts {
+			if m, ok := metrics[rc.Account]; ok {
+				m[events.MetricResourceCredits] = rc.RCManabar.Percent(float64(rc.MaxRC), now)
+			}
+		}
+	}
+	return nil
+}
+
+// accountState contains the account fields needed to compute the metrics.
+type accountState struct {
+	Name                   string      `json:"name"`
+	Balance                string      `json:"balance"`
+	LegacyVotingPower      int         `json:"voting_power"`
+	LastVoteTime           *types.Time `json:"last_vote_time"`
+	VotingManabar          *manabar    `json:"voting_manabar"`
+	VestingShares          string      `json:"vesting_shares"`
+	DelegatedVestingShares string      `json:"delegated_vesting_shares"`
+	ReceivedVestingShares  string      `json:"received_vesting_shares"`
+}
+
+// VotingPower returns the current voting power in percent.
+//
+// The voting manabar is used when available, the legacy voting_power field otherwise.
+func (account *accountState) VotingPower(now time.Time) (float64, error) {
+	if mb := account.VotingManabar; mb != nil && mb.LastUpdateTime != 0 {
+		var effective float64
+		for i, amount := range []string{
+			account.VestingShares,
+			account.DelegatedVestingShares,
+			account.ReceivedVestingShares,
+		} {
+			vests, err := parseAmount(amount)
+			if err != nil {
+				return 0, err
+			}
+			if i == 1 {
+				vests = -vests
+			}
+			effective += vests
+		}
+		return mb.Percent(effective*1e6, now), nil
+	}
+
+	// Legacy accounts regenerate from the last vote time.
+	power := float64(account.LegacyVotingPower)
+	if account.LastVoteTime != nil && account.LastVoteTime.Time != nil {
+		elapsed := now.Sub(*account.LastVoteTime.Time)
+		power += 10000 * elapsed.Seconds() / manaRegenerationPeriod.Seconds()
+	}
+	if power > 10000 {
+		power = 10000
+	}
+	return power / 100, nil
+}
+
+// manabar is the regenerating resource steemd uses for voting power and resource credits.
+type manabar struct {
+	CurrentMana    flexFloat `json:"current_mana"`
+	LastUpdateTime int64     `json:"last_update_time"`
+}
+
+// Percent returns the regenerated mana in percent of max.
+func (mb *manabar) Percent(max float64, now time.Time) float64 {
+	if max <= 0 {
+		return 0
+	}
+
+	elapsed := now.Sub(time.Unix(mb.LastUpdateTime, 0))
+	current := float64(mb.CurrentMana) + max*elapsed.Seconds()/manaRegenerationPeriod.Seconds()
+	if current > max {
+		current = max
+	}
+	return 100 * current / max
+}
+
+// flexFloat decodes numbers steemd sends either as JSON numbers or as strings.
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseFloat(strings.Trim(string(data), `"`), 64)
+	if err != nil {
+		return errors.Wrapf(err, "invalid number: %s", data)
+	}
+	*f = flexFloat(v)
+	return nil
+}
@@ -0,0 +1,138 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+func TestAccountThreshold_Evaluate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		below   bool
+		value   float64
+		isBelow bool
+		crossed bool
+	}{
+		{"armed, above the threshold", false, 60, false, false},
+		{"armed, at the threshold", false, 50, false, false},
+		{"armed, below the threshold", false, 49, true, true},
+		{"fired, still below the threshold", true, 40, true, false},
+		{"fired, recovered within the hysteresis", true, 54, true, false},
+		{"fired, recovered past the hysteresis", true, 55, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			threshold := &AccountThreshold{
+				Threshold:  50,
+				Hysteresis: 5,
+				Below:      tc.below,
+			}
+			below, crossed := threshold.Evaluate(tc.value)
+			if below != tc.isBelow {
+				t.Errorf("expected below to be %v, got %v", tc.isBelow, below)
+			}
+			if crossed != tc.crossed {
+				t.Errorf("expected crossed to be %v, got %v", tc.crossed, crossed)
+			}
+		})
+	}
+}
+
+func TestAccountThreshold_EvaluateSequence(t *testing.T) {
+	// The value oscillating around the threshold only fires once
+	// until it recovers past the hysteresis.
+	var (
+		threshold = &AccountThreshold{Threshold: 50, Hysteresis: 5}
+		values    = []float64{60, 49, 51, 49, 54, 49, 56, 49}
+		expected  = []bool{false, true, false, false, false, false, false, true}
+	)
+
+	for i, value := range values {
+		below, crossed := threshold.Evaluate(value)
+		if crossed != expected[i] {
+			t.Errorf("value %v (step %v): expected crossed to be %v, got %v", value, i, expected[i], crossed)
+		}
+		threshold.Below = below
+	}
+}
+
+func TestAccountThreshold_Validate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		threshold  AccountThreshold
+		valid      bool
+		hysteresis float64
+	}{
+		{
+			name:       "voting power default hysteresis",
+			threshold:  AccountThreshold{Account: "alice", Metric: events.MetricVotingPower, Threshold: 80},
+			valid:      true,
+			hysteresis: 5,
+		},
+		{
+			name:       "balance default hysteresis",
+			threshold:  AccountThreshold{Account: "alice", Metric: events.MetricBalance, Threshold: 20},
+			valid:      true,
+			hysteresis: 2,
+		},
+		{
+			name: "custom hysteresis",
+			threshold: AccountThreshold{
+				Account: "alice", Metric: events.MetricResourceCredits, Threshold: 20, Hysteresis: 1,
+			},
+			valid:      true,
+			hysteresis: 1,
+		},
+		{
+			name:      "negative hysteresis",
+			threshold: AccountThreshold{Account: "alice", Metric: events.MetricBalance, Threshold: 20, Hysteresis: -1},
+		},
+		{
+			name:      "percentage out of range",
+			threshold: AccountThreshold{Account: "alice", Metric: events.MetricVotingPower, Threshold: 100},
+		},
+		{
+			name:      "unknown metric",
+			threshold: AccountThreshold{Account: "alice", Metric: "reputation", Threshold: 20},
+		},
+		{
+			name:      "missing account",
+			threshold: AccountThreshold{Metric: events.MetricBalance, Threshold: 20},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.threshold.Validate()
+			if valid := err == nil; valid != tc.valid {
+				t.Fatalf("expected valid to be %v, got error %v", tc.valid, err)
+			}
+			if tc.valid && tc.threshold.Hysteresis != tc.hysteresis {
+				t.Errorf("expected hysteresis %v, got %v", tc.hysteresis, tc.threshold.Hysteresis)
+			}
+		})
+	}
+}
+
+func TestAccountPoller_FetchAccountMetrics(t *testing.T) {
+	// The account with an invalid balance is skipped, the others are kept.
+	caller := &staticCaller{response: `[
+		{"name": "alice", "balance": "12.500 STEEM", "voting_power": 10000},
+		{"name": "bob", "balance": "invalid", "voting_power": 10000}
+	]`}
+	poller := &accountPoller{caller: caller, logger: newTestLogger()}
+
+	metrics, err := poller.fetchAccountMetrics([]string{"alice", "bob"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := metrics["alice"][events.MetricBalance]; balance != 12.5 {
+		t.Errorf("expected alice's balance 12.5, got %v", balance)
+	}
+	if _, ok := metrics["bob"]; ok {
+		t.Error("expected bob to be skipped")
+	}
+}
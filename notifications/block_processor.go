@@ -1,16 +1,20 @@
 package notifications
 
 import (
-	"log"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 
 	"github.com/go-steem/rpc"
 	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/interfaces"
 	"github.com/go-steem/rpc/types"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/tomb.v2"
@@ -21,16 +25,24 @@ const DefaultWorkerCount = 10
 type BlockProcessorConfig struct {
 	NextBlockNum       uint32     `bson:"nextBlockNum"`
 	LastBlockTimestamp *time.Time `bson:"lastBlockTimestamp,omitempty"`
+
+	LastIrreversibleBlockNum uint32              `bson:"lastIrreversibleBlockNum"`
+	UnconfirmedBlocks        []*UnconfirmedBlock `bson:"unconfirmedBlocks,omitempty"`
 }
 
 func (config *BlockProcessorConfig) Clone() *BlockProcessorConfig {
 	clone := &BlockProcessorConfig{
-		NextBlockNum: config.NextBlockNum,
+		NextBlockNum:             config.NextBlockNum,
+		LastIrreversibleBlockNum: config.LastIrreversibleBlockNum,
 	}
 	if ts := config.LastBlockTimestamp; ts != nil {
 		lastBlockTimestamp := *ts
 		clone.LastBlockTimestamp = &lastBlockTimestamp
 	}
+	for _, block := range config.UnconfirmedBlocks {
+		b := *block
+		clone.UnconfirmedBlocks = append(clone.UnconfirmedBlocks, &b)
+	}
 	return clone
 }
 
@@ -43,6 +55,68 @@ type BlockProcessor struct {
 	eventMiners         map[types.OpType][]EventMiner
 	additionalNotifiers map[string]Notifier
 
+	threadWatchTTL time.Duration
+
+	index                         *subscriptionIndex
+	subscriptionIndexPollInterval time.Duration
+
+	dispatchPool          *dispatchPool
+	dispatchQueueSize     uint
+	notifierConcurrency   map[string]uint
+	dispatchStatsInterval time.Duration
+	deliveryTTL           time.Duration
+	deliveries            *deliveryLog
+	flags                 *flagLog
+	pendingBlocks         *pendingBlocks
+	dispatchFailures      int32
+
+	// orphaned holds the deliveries recorded for the orphaned blocks
+	// until the canonical blocks replacing them are processed.
+	orphaned     map[uint32][]*delivery
+	orphanedLock sync.Mutex
+
+	mode                   string
+	forkGuard              *forkGuard
+	forkGuardCheckInterval time.Duration
+
+	catchUp       *catchUp
+	catchUpPolicy string
+	catchUpMaxAge time.Duration
+
+	contentCache     *contentCache
+	contentCacheSize int
+	contentCacheTTL  time.Duration
+	filterOperations bool
+
+	blockMaxAttempts   uint
+	blockRetryMinDelay time.Duration
+	blockRetryMaxDelay time.Duration
+
+	chainProfile *chain.Profile
+
+	voteValuer            *voteValuer
+	voteValuationCaller   interfaces.CallCloser
+	voteValuationInterval time.Duration
+
+	accountPollCaller   interfaces.CallCloser
+	accountPollInterval time.Duration
+
+	pricePollCaller   interfaces.CallCloser
+	pricePollInterval time.Duration
+
+	scheduler              *scheduler
+	schedulerPollInterval  time.Duration
+	payoutReminderLeadTime time.Duration
+
+	blockRange *blockRange
+	dryRun     func(*PlannedDelivery)
+	onlyUserId string
+
+	// inFlight counts the blocks being processed and the notifications being dispatched.
+	inFlight sync.WaitGroup
+
+	logger *logrus.Entry
+
 	blockCh             chan *database.Block
 	blockProcessingLock *sync.Mutex
 	blockAckCh          chan *database.Block
@@ -70,19 +144,30 @@ func AddStandardNotifier(id string, notifier Notifier) Option {
 	}
 }
 
+// SetChainProfile sets the chain the standard notifiers render the events for.
+// chain.Steem is used by default.
+func SetChainProfile(profile *chain.Profile) Option {
+	return func(processor *BlockProcessor) {
+		processor.chainProfile = profile
+	}
+}
+
+// SetLogger sets the logger to be used. The standard logrus logger is used by default.
+func SetLogger(logger *logrus.Entry) Option {
+	return func(processor *BlockProcessor) {
+		processor.logger = logger
+	}
+}
+
 func SetWorkerCount(numWorkers uint) Option {
 	return func(processor *BlockProcessor) {
 		processor.numWorkers = numWorkers
 	}
 }
 
-func New(
-	client *rpc.Client,
-	connect ConnectFunc,
-	db *mgo.Database,
-	opts ...Option,
-) (*BlockProcessor, error) {
-	// Ensure DB indexes exist.
+// ensureIndexes makes sure the DB indexes exist.
+// Failures are only logged, the indexes are not required for the processor to work.
+func ensureIndexes(db *mgo.Database, logger *logrus.Entry) {
 	indexes := []struct {
 		Key    string
 		Sparse bool
@@ -95,37 +180,118 @@ func New(
 		{"users", true},
 		{"authorBlacklist", true},
 		{"tags", true},
+		{"tagBlacklist", true},
 		{"authors", true},
 		{"voters", true},
 		{"parentAuthors", true},
 	}
 
 	for _, index := range indexes {
-		log.Printf("Creating index for events.%v ...", index.Key)
+		logger.Infof("Creating index for events.%v ...", index.Key)
 		err := db.C("events").EnsureIndex(mgo.Index{
 			Key:        []string{index.Key},
 			Background: true,
 			Sparse:     index.Sparse,
 		})
 		if err != nil {
-			log.Printf("Failed creating index for events.%v: %v", index.Key, err)
+			logger.WithError(err).Errorf("Failed creating index for events.%v", index.Key)
 		}
 	}
 
 	for _, key := range []string{"ownerId", "enabled"} {
-		log.Printf("Creating index for notifiers.%v ...", key)
+		logger.Infof("Creating index for notifiers.%v ...", key)
 		err := db.C("notifiers").EnsureIndex(mgo.Index{
 			Key:        []string{key},
 			Background: true,
 		})
 		if err != nil {
-			log.Printf("Failed creating index for notifiers.%v: %v", key, err)
+			logger.WithError(err).Errorf("Failed creating index for notifiers.%v", key)
 		}
 	}
 
-	// Load config from the database.
+	logger.Info("Creating index for users.accounts ...")
+	err := db.C("users").EnsureIndex(mgo.Index{
+		Key:        []string{"accounts"},
+		Background: true,
+		Sparse:     true,
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed creating index for users.accounts")
+	}
+
+	logger.Info("Creating indexes for threadWatches ...")
+	if err := ensureThreadWatchIndexes(db); err != nil {
+		logger.WithError(err).Error("Failed creating indexes for threadWatches")
+	}
+
+	logger.Info("Creating indexes for accountThresholds ...")
+	if err := ensureAccountThresholdIndexes(db); err != nil {
+		logger.WithError(err).Error("Failed creating indexes for accountThresholds")
+	}
+
+	logger.Info("Creating indexes for flags ...")
+	if err := ensureFlagIndexes(db); err != nil {
+		logger.WithError(err).Error("Failed creating indexes for flags")
+	}
+}
+
+func New(
+	client *rpc.Client,
+	connect ConnectFunc,
+	db *mgo.Database,
+	opts ...Option,
+) (*BlockProcessor, error) {
+	// Create a new BlockProcessor instance.
+	processor := &BlockProcessor{
+		client:                        client,
+		db:                            db,
+		numWorkers:                    DefaultWorkerCount,
+		eventMiners:                   newEventMiners(),
+		threadWatchTTL:                DefaultThreadWatchTTL,
+		subscriptionIndexPollInterval: DefaultSubscriptionIndexPollInterval,
+		dispatchQueueSize:             DefaultDispatchQueueSize,
+		dispatchStatsInterval:         DefaultDispatchStatsInterval,
+		deliveryTTL:                   DefaultDeliveryTTL,
+		mode:                          DefaultMode,
+		forkGuardCheckInterval:        DefaultForkGuardCheckInterval,
+		catchUpPolicy:                 DefaultCatchUpPolicy,
+		catchUpMaxAge:                 DefaultCatchUpMaxAge,
+		contentCacheSize:              DefaultContentCacheSize,
+		contentCacheTTL:               DefaultContentCacheTTL,
+		filterOperations:              true,
+		blockMaxAttempts:              DefaultBlockMaxAttempts,
+		blockRetryMinDelay:            DefaultBlockRetryMinDelay,
+		blockRetryMaxDelay:            DefaultBlockRetryMaxDelay,
+		chainProfile:                  chain.Steem,
+		voteValuationInterval:         DefaultVoteValueRefreshInterval,
+		accountPollInterval:           DefaultAccountPollInterval,
+		pricePollInterval:             DefaultPricePollInterval,
+		schedulerPollInterval:         DefaultSchedulerPollInterval,
+		payoutReminderLeadTime:        DefaultPayoutReminderLeadTime,
+		pendingBlocks:                 newPendingBlocks(),
+		orphaned:                      make(map[uint32][]*delivery),
+		logger:                        logrus.NewEntry(logrus.StandardLogger()),
+		t:                             new(tomb.Tomb),
+	}
+
+	// Apply the options.
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	// Ensure DB indexes exist.
+	ensureIndexes(db, processor.logger)
+
+	// Load config from the database unless replaying a fixed block range.
 	var config BlockProcessorConfig
-	if err := db.C("configuration").FindId("BlockProcessor").One(&config); err != nil {
+	if r := processor.blockRange; r != nil {
+		props, err := client.Database.GetDynamicGlobalProperties()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get steemd dynamic global properties")
+		}
+		config.NextBlockNum = r.from
+		config.LastIrreversibleBlockNum = props.LastIrreversibleBlockNum
+	} else if err := db.C("configuration").FindId("BlockProcessor").One(&config); err != nil {
 		if err == mgo.ErrNotFound {
 			// We need to get the last irreversible block number
 			// to know where to start processing blocks from initially.
@@ -134,13 +300,156 @@ func New(
 				return nil, errors.Wrap(err, "failed to get steemd dynamic global properties")
 			}
 			config.NextBlockNum = props.LastIrreversibleBlockNum
+			config.LastIrreversibleBlockNum = props.LastIrreversibleBlockNum
 		} else {
 			return nil, errors.Wrap(err, "failed to load BlockProcessor configuration")
 		}
 	}
+	processor.config = &config
+
+	// Notifiers are not needed when the deliveries are only being reported.
+	if processor.dryRun == nil {
+		initNotifiers(processor.chainProfile)
+	}
+
+	// Make sure the catch-up policy is valid.
+	catchUp, err := newCatchUp(processor.catchUpPolicy, processor.catchUpMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	catchUp.digests = db.C("catchUpDigests")
+	processor.catchUp = catchUp
+
+	// Set up the content cache shared by the workers.
+	if processor.contentCacheSize > 0 {
+		cache, err := newContentCache(processor.contentCacheSize, processor.contentCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		processor.contentCache = cache
+	}
+
+	// Load the flags being watched into memory.
+	flags, err := newFlagLog(db)
+	if err != nil {
+		return nil, err
+	}
+	processor.flags = flags
+
+	// Load subscriptions into memory and keep them up to date.
+	index, err := newSubscriptionIndex(db, processor.logger.WithField("component", "subscription_index"))
+	if err != nil {
+		return nil, err
+	}
+	processor.index = index
+	processor.t.Go(func() error {
+		return index.poller(processor.subscriptionIndexPollInterval, processor.t.Dying())
+	})
+
+	// The goroutines already started must be stopped in case the setup fails from now on.
+	fail := func(err error) (*BlockProcessor, error) {
+		processor.t.Kill(err)
+		processor.t.Wait()
+		return nil, err
+	}
+
+	// Keep the vote valuation parameters up to date.
+	processor.startVoteValuer()
+
+	// Start the dispatch pool.
+	deliveries, err := newDeliveryLog(db, processor.deliveryTTL)
+	if err != nil {
+		return fail(err)
+	}
+	processor.deliveries = deliveries
+
+	notifiers := make(map[string]Notifier, len(availableNotifiers)+len(processor.additionalNotifiers))
+	for id, notifier := range availableNotifiers {
+		notifiers[id] = notifier
+	}
+	for id, notifier := range processor.additionalNotifiers {
+		notifiers[id] = notifier
+	}
+	processor.dispatchPool = newDispatchPool(
+		notifiers, processor.dispatchQueueSize, processor.notifierConcurrency,
+		deliveries, &processor.inFlight, processor.logger.WithField("component", "dispatcher"), processor.t)
+	processor.t.Go(func() error {
+		return processor.dispatchPool.reporter(processor.dispatchStatsInterval)
+	})
+	if err := registerDispatchPoolCollector(processor.dispatchPool); err != nil {
+		processor.logger.WithError(err).Warn("Failed registering dispatch queue metrics")
+	}
+
+	// Set up the fork guard.
+	guardClient, err := connect()
+	if err != nil {
+		return fail(err)
+	}
+	processor.t.Go(func() error {
+		<-processor.t.Dying()
+		guardClient.Close()
+		return nil
+	})
+	guard, err := newForkGuard(processor.mode, guardClient, &config, processor.handleOrphanedBlock,
+		processor.logger.WithField("component", "fork_guard"))
+	if err != nil {
+		return fail(err)
+	}
+	processor.forkGuard = guard
+
+	// Set up the scheduler for the events fired later on.
+	if err := processor.startScheduler(connect); err != nil {
+		return fail(err)
+	}
+
+	// Start the catch-up digest flusher.
+	if catchUp.policy == CatchUpDigest {
+		processor.t.Go(func() error {
+			return catchUp.digestFlusher(
+				DefaultDigestFlushInterval,
+				DefaultDigestMaxPeriod,
+				func(userId string, digest *events.CatchUpDigest) bool {
+					return processor.dispatchDetached(&digest.Origin, func() {
+						processor.DispatchCatchUpDigestEvent(userId, digest)
+					})
+				},
+				processor.logger.WithField("component", "catch_up"),
+				processor.t.Dying())
+		})
+	}
+
+	// Start checking the account thresholds.
+	processor.startAccountPoller()
+
+	// Start watching the median price feed.
+	if err := processor.startPriceWatcher(); err != nil {
+		return fail(err)
+	}
+
+	// Start the config flusher.
+	processor.blockAckCh = make(chan *database.Block, processor.numWorkers)
+	processor.t.Go(processor.configFlusher)
+
+	// Start workers.
+	processor.blockCh = make(chan *database.Block, processor.numWorkers)
+	for i := uint(0); i < processor.numWorkers; i++ {
+		processor.t.Go(func() error {
+			return processor.worker(connect)
+		})
+	}
+
+	// Start the fork guard.
+	processor.t.Go(func() error {
+		return guard.watcher(processor.forkGuardCheckInterval, processor.t.Dying())
+	})
+
+	// Return the new BlockProcessor.
+	return processor, nil
+}
 
-	// Instantiate event miners.
-	eventMiners := map[types.OpType][]EventMiner{
+// newEventMiners returns the event miners, grouped by the operation type they handle.
+func newEventMiners() map[types.OpType][]EventMiner {
+	return map[types.OpType][]EventMiner{
 		types.TypeAccountUpdate: []EventMiner{
 			events.NewAccountUpdatedEventMiner(),
 		},
@@ -154,64 +463,49 @@ func New(
 			events.NewUserMentionedEventMiner(),
 			events.NewStoryPublishedEventMiner(),
 			events.NewCommentPublishedEventMiner(),
+			events.NewContentMatchedEventMiner(),
 		},
 		types.TypeVote: []EventMiner{
 			events.NewStoryVotedEventMiner(),
 			events.NewCommentVotedEventMiner(),
+			events.NewStoryFlaggedEventMiner(),
+			events.NewCommentFlaggedEventMiner(),
 		},
 		types.TypeCustomJSON: []EventMiner{
 			events.NewUserFollowStatusChangedEventMiner(),
 		},
 	}
-
-	// Create a new BlockProcessor instance.
-	processor := &BlockProcessor{
-		client:      client,
-		db:          db,
-		config:      &config,
-		numWorkers:  DefaultWorkerCount,
-		eventMiners: eventMiners,
-		blockAckCh:  make(chan *database.Block),
-		t:           new(tomb.Tomb),
-	}
-
-	// Apply the options.
-	for _, opt := range opts {
-		opt(processor)
-	}
-
-	// Start the config flusher.
-	processor.blockAckCh = make(chan *database.Block, processor.numWorkers)
-	processor.t.Go(processor.configFlusher)
-
-	// Start workers.
-	processor.blockCh = make(chan *database.Block, processor.numWorkers)
-	for i := uint(0); i < processor.numWorkers; i++ {
-		processor.t.Go(func() error {
-			return processor.worker(connect)
-		})
-	}
-
-	// Return the new BlockProcessor.
-	return processor, nil
 }
 
 func (processor *BlockProcessor) BlockRange() (from, to uint32) {
+	if r := processor.blockRange; r != nil {
+		return r.from, r.to
+	}
 	return processor.config.NextBlockNum, 0
 }
 
 func (processor *BlockProcessor) ProcessBlock(block *database.Block) error {
+	block, ok, err := processor.forkGuard.Accept(block, processor.t.Dying())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return processor.t.Wait()
+	}
+
+	processor.inFlight.Add(1)
 	select {
 	case processor.blockCh <- block:
 		return nil
 	case <-processor.t.Dying():
+		processor.inFlight.Done()
 		return processor.t.Wait()
 	}
 }
 
 func (processor *BlockProcessor) worker(connect ConnectFunc) error {
 	defer func() {
-		log.Println("Worker terminating ...")
+		processor.logger.Debug("Worker terminating ...")
 		processor.blockAckCh <- nil
 	}()
 
@@ -221,7 +515,7 @@ func (processor *BlockProcessor) worker(connect ConnectFunc) error {
 	}
 	processor.t.Go(func() error {
 		<-processor.t.Dying()
-		log.Println("Worker connection closed")
+		processor.logger.Debug("Worker connection closed")
 		client.Close()
 		return nil
 	})
@@ -229,55 +523,45 @@ func (processor *BlockProcessor) worker(connect ConnectFunc) error {
 	for {
 		select {
 		case block := <-processor.blockCh:
-			for _, tx := range block.Transactions {
-				for _, op := range tx.Operations {
-					// Fetch the associated content in case
-					// this is a content-related operation.
-					var (
-						content *database.Content
-						err     error
-					)
-					switch body := op.Data().(type) {
-					case *types.CommentOperation:
-						content, err = client.Database.GetContent(body.Author, body.Permlink)
-						err = errors.Wrapf(err, "block %v: failed to get content: @%v/%v",
-							block.Number, body.Author, body.Permlink)
-					case *types.VoteOperation:
-						content, err = client.Database.GetContent(body.Author, body.Permlink)
-						err = errors.Wrapf(err, "block %v: failed to get content: @%v/%v",
-							block.Number, body.Author, body.Permlink)
-					}
-					if err != nil {
-						if !processor.t.Alive() {
-							return nil
-						}
-						return err
-					}
+			// The block is only acknowledged once all the notifications are dispatched,
+			// otherwise the checkpoint could move past the notifications still queued.
+			pending := processor.pendingBlocks.Begin(blockKey(block.Number))
+			recorded, err := processor.handleBlock(client, block, pending)
+			if err == nil {
+				err = pending.Wait(processor.t.Dying())
+			}
+			processor.pendingBlocks.End(blockKey(block.Number))
+			if err != nil {
+				if !processor.t.Alive() {
+					return nil
+				}
+				return err
+			}
 
-					// Get miners associated with the given operation.
-					miners, ok := processor.eventMiners[op.Type()]
-					if !ok {
-						continue
-					}
-					// Mine events and handle them.
-					for _, eventMiner := range miners {
-						events, err := eventMiner.MineEvent(op, content)
-						if err == nil {
-							for _, event := range events {
-								err = processor.handleEvent(event)
-								if err != nil {
-									break
-								}
-							}
-						}
-						if err != nil {
-							return errors.Wrapf(err, "block %v: %v", block.Number, err.Error())
-						}
+			if n := pending.Failed(); n != 0 {
+				atomic.AddInt32(&processor.dispatchFailures, int32(n))
+				processor.logger.WithFields(logrus.Fields{
+					"block":  block.Number,
+					"failed": n,
+				}).Warn("Some notifications for the block could not be dispatched")
+
+				// Record the block so that the notifications can be dispatched again later.
+				if !recorded && processor.dryRun == nil {
+					if err := recordFailedBlock(processor.db, block.Number, 1, &DispatchError{n}); err != nil {
+						processor.logger.WithError(err).Error("Failed recording failed block")
 					}
 				}
 			}
 
+			if err := processor.retractOrphaned(block.Number, pending.Planned()); err != nil {
+				processor.logger.WithError(err).WithField("block", block.Number).
+					Warn("Failed retracting notifications for the orphaned block")
+			}
+
 			processor.blockAckCh <- block
+			processor.inFlight.Done()
+			blocksProcessed.Inc()
+			processor.logger.WithField("block", block.Number).Debug("block processed")
 
 		case <-processor.t.Dying():
 			return nil
@@ -285,6 +569,105 @@ func (processor *BlockProcessor) worker(connect ConnectFunc) error {
 	}
 }
 
+// processBlock mines events from the block and handles them.
+//
+// The operations no subscription can match are dropped right away,
+// before any content is fetched or any event is mined.
+// The associated content is fetched before any event is handled so that
+// steemd being unavailable does not interrupt the block half way through.
+// Processing the block again is safe anyway since the deliveries are deduplicated.
+func (processor *BlockProcessor) processBlock(client *rpc.Client, block *database.Block) error {
+	var (
+		contents = make([][]*database.Content, len(block.Transactions))
+		skipped  = make([][]bool, len(block.Transactions))
+	)
+	for trxNum, tx := range block.Transactions {
+		contents[trxNum] = make([]*database.Content, len(tx.Operations))
+		skipped[trxNum] = make([]bool, len(tx.Operations))
+		for opNum, op := range tx.Operations {
+			if _, ok := processor.eventMiners[op.Type()]; !ok {
+				continue
+			}
+			if !processor.isRelevant(op) {
+				operationsFiltered.WithLabelValues(string(op.Type())).Inc()
+				skipped[trxNum][opNum] = true
+				continue
+			}
+			content, err := processor.getContent(client, op)
+			if err != nil {
+				return err
+			}
+			contents[trxNum][opNum] = content
+		}
+	}
+
+	for trxNum, tx := range block.Transactions {
+		for opNum, op := range tx.Operations {
+			if skipped[trxNum][opNum] {
+				continue
+			}
+			// Get miners associated with the given operation.
+			miners, ok := processor.eventMiners[op.Type()]
+			if !ok {
+				continue
+			}
+			// Mine events and handle them.
+			for _, eventMiner := range miners {
+				events, err := eventMiner.MineEvent(op, contents[trxNum][opNum])
+				if err != nil {
+					return permanent(errors.Wrapf(err, "failed to mine %v", op.Type()))
+				}
+				eventsMined.WithLabelValues(string(op.Type())).Add(float64(len(events)))
+				for _, event := range events {
+					if !processor.prepareEvent(event, block, trxNum, opNum) {
+						continue
+					}
+					eventLogger(processor.logger, event).Debug("event mined")
+					if err := processor.handleEvent(event); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getOperationContent fetches the content associated with the operation.
+// Nil is returned in case this is not a content-related operation.
+func getOperationContent(client *rpc.Client, op types.Operation) (*database.Content, error) {
+	author, permlink, ok := operationContentKey(op)
+	if !ok {
+		return nil, nil
+	}
+
+	start := time.Now()
+	content, err := client.Database.GetContent(author, permlink)
+	observeDuration(rpcDuration.WithLabelValues("get_content"), start)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get content: @%v/%v", author, permlink)
+	}
+	return content, nil
+}
+
+// operationContentKey returns the author and the permlink of the content
+// associated with the operation. False is returned for other operations.
+func operationContentKey(op types.Operation) (author, permlink string, ok bool) {
+	switch body := op.Data().(type) {
+	case *types.CommentOperation:
+		return body.Author, body.Permlink, true
+	case *types.VoteOperation:
+		return body.Author, body.Permlink, true
+	default:
+		return "", "", false
+	}
+}
+
+// DispatchStats returns the current state of the notification dispatch queues.
+func (processor *BlockProcessor) DispatchStats() []*DispatchStats {
+	return processor.dispatchPool.Stats()
+}
+
 func (processor *BlockProcessor) Finalize() error {
 	processor.t.Kill(nil)
 
@@ -305,6 +688,11 @@ func (processor *BlockProcessor) configFlusher() error {
 	numAlive := processor.numWorkers
 
 	updateConfig := func(block *database.Block) {
+		// Blocks replacing orphaned blocks are processed again, skip them.
+		if block.Number < config.NextBlockNum {
+			return
+		}
+
 		// In case this is not the next block, remember it and return.
 		if block.Number != config.NextBlockNum {
 			processedBlocks[block.Number] = block
@@ -340,12 +728,13 @@ func (processor *BlockProcessor) configFlusher() error {
 		case block := <-processor.blockAckCh:
 			if block == nil {
 				numAlive--
-				log.Println("Workers alive: ", numAlive)
+				processor.logger.WithField("workers", numAlive).Info("Worker terminated")
 				if numAlive == 0 {
 					return processor.flushConfig(config)
 				}
 			} else {
 				updateConfig(block)
+				recordProgress(config)
 			}
 
 		// Flush config every minute.
@@ -359,6 +748,13 @@ func (processor *BlockProcessor) configFlusher() error {
 }
 
 func (processor *BlockProcessor) flushConfig(config *BlockProcessorConfig) error {
+	// The checkpoint is left alone when replaying a fixed block range.
+	if processor.blockRange != nil {
+		return nil
+	}
+
+	processor.forkGuard.Checkpoint(config)
+
 	if _, err := processor.db.C("configuration").UpsertId("BlockProcessor", config); err != nil {
 		return errors.Wrapf(err, "failed to store BlockProcessor configuration: %+v", config)
 	}
@@ -369,6 +765,63 @@ func (processor *BlockProcessor) flushConfig(config *BlockProcessorConfig) error
 // Event handling
 //==============================================================================
 
+// prepareEvent sets the origin of the event and applies the catch-up policy.
+// False is returned in case the event is to be dropped.
+func (processor *BlockProcessor) prepareEvent(
+	event interface{},
+	block *database.Block,
+	trxNum int,
+	opNum int,
+) bool {
+
+	origin := setEventOrigin(event, block, trxNum, opNum)
+	if origin == nil {
+		return true
+	}
+
+	if processor.catchUp.IsStale(origin) {
+		if processor.catchUp.policy == CatchUpSkip {
+			return false
+		}
+		origin.Delayed = true
+	}
+	return true
+}
+
+// setEventOrigin sets the origin of the event, returning nil in case the event has none.
+func setEventOrigin(event interface{}, block *database.Block, trxNum, opNum int) *events.Origin {
+	e, ok := event.(interface {
+		EventOrigin() *events.Origin
+	})
+	if !ok {
+		return nil
+	}
+
+	origin := e.EventOrigin()
+	*origin = events.Origin{
+		BlockNum: block.Number,
+		TrxNum:   trxNum,
+		OpNum:    opNum,
+	}
+	if block.Timestamp != nil && block.Timestamp.Time != nil {
+		origin.Timestamp = *block.Timestamp.Time
+	}
+	return origin
+}
+
+// eventLogger returns a logger carrying the correlation ID of the event.
+func eventLogger(logger *logrus.Entry, event interface{}) *logrus.Entry {
+	fields := logrus.Fields{
+		"event": fmt.Sprintf("%T", event),
+	}
+	if e, ok := event.(interface {
+		EventOrigin() *events.Origin
+	}); ok {
+		fields["correlation_id"] = e.EventOrigin().CorrelationId()
+	}
+	return logger.WithFields(fields)
+}
+
 func (processor *BlockProcessor) handleEvent(event interface{}) error {
 	switch event := event.(type) {
 	case *events.AccountUpdated:
@@ -389,223 +842,442 @@ func (processor *BlockProcessor) handleEvent(event interface{}) error {
 		return processor.HandleCommentPublishedEvent(event)
 	case *events.CommentVoted:
 		return processor.HandleCommentVotedEvent(event)
+	case *events.StoryFlagged:
+		return processor.HandleStoryFlaggedEvent(event)
+	case *events.CommentFlagged:
+		return processor.HandleCommentFlaggedEvent(event)
+	case *events.ContentMatched:
+		return processor.HandleContentMatchedEvent(event)
 	default:
 		return errors.Errorf("unknown event type: %T", event)
 	}
 }
 
-func (processor *BlockProcessor) HandleAccountUpdatedEvent(event *events.AccountUpdated) error {
-	query := bson.M{
-		"kind":     "account.updated",
-		"accounts": event.Op.Account,
-	}
-
-	log.Println(query)
+// matchCriteria returns the criteria used to find the users to be notified about the event.
+// Nil is returned for the events that are not matched using event subscriptions.
+func matchCriteria(event interface{}) *Criteria {
+	switch event := event.(type) {
+	case *events.AccountUpdated:
+		return &Criteria{
+			Kind: "account.updated",
+			Include: map[string][]string{
+				"accounts": {event.Op.Account},
+			},
+		}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
-	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchAccountUpdatedEvent(result.OwnerId.Hex(), event)
-	}
-	return errors.Wrap(iter.Err(), "failed get target users for account.updated")
-}
+	case *events.AccountWitnessVoted:
+		return &Criteria{
+			Kind: "account.witness_voted",
+			Include: map[string][]string{
+				"accounts":  {event.Op.Account},
+				"witnesses": {event.Op.Witness},
+			},
+		}
 
-func (processor *BlockProcessor) HandleAccountWitnessVotedEvent(event *events.AccountWitnessVoted) error {
-	query := bson.M{
-		"kind": "account.witness_voted",
-		"$or": []interface{}{
-			bson.M{
-				"accounts": event.Op.Account,
+	case *events.TransferMade:
+		return &Criteria{
+			Kind: "transfer.made",
+			Include: map[string][]string{
+				"from": {event.Op.From},
+				"to":   {event.Op.To},
 			},
-			bson.M{
-				"witnesses": event.Op.Witness,
+		}
+
+	case *events.UserMentioned:
+		return &Criteria{
+			Kind: "user.mentioned",
+			Include: map[string][]string{
+				"users": {event.User},
 			},
-		},
-	}
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+			},
+		}
 
-	log.Println(query)
+	case *events.UserFollowStatusChanged:
+		return &Criteria{
+			Kind: "user.follow_changed",
+			Include: map[string][]string{
+				"users": {event.Op.Following},
+			},
+		}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
-	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchAccountWitnessVotedEvent(result.OwnerId.Hex(), event)
-	}
-	return errors.Wrap(iter.Err(), "failed get target users for account.witness_voted")
-}
+	case *events.StoryPublished:
+		tags := contentTags(event.Content)
+		return &Criteria{
+			Kind: "story.published",
+			Include: map[string][]string{
+				"authors": {event.Content.Author},
+				"tags":    tags,
+			},
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+				"tagBlacklist":    tags,
+			},
+		}
 
-func (processor *BlockProcessor) HandleTransferMadeEvent(event *events.TransferMade) error {
-	query := bson.M{
-		"kind": "transfer.made",
-		"$or": []interface{}{
-			bson.M{
-				"from": event.Op.From,
+	case *events.StoryVoted:
+		return &Criteria{
+			Kind: "story.voted",
+			Include: map[string][]string{
+				"authors": {event.Content.Author},
+				"voters":  {event.Op.Voter},
 			},
-			bson.M{
-				"to": event.Op.To,
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+				"tagBlacklist":    contentTags(event.Content),
 			},
-		},
-	}
+		}
+
+	case *events.CommentPublished:
+		return &Criteria{
+			Kind: "comment.published",
+			Include: map[string][]string{
+				"authors":       {event.Content.Author},
+				"parentAuthors": {event.Content.ParentAuthor},
+			},
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+				"tagBlacklist":    contentTags(event.Content),
+			},
+		}
 
-	log.Println(query)
+	case *events.CommentVoted:
+		return &Criteria{
+			Kind: "comment.voted",
+			Include: map[string][]string{
+				"authors": {event.Content.Author},
+				"voters":  {event.Op.Voter},
+			},
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+				"tagBlacklist":    contentTags(event.Content),
+			},
+		}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
-	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchTransferMadeEvent(result.OwnerId.Hex(), event)
+	case *events.StoryFlagged:
+		return &Criteria{
+			Kind: "story.flagged",
+			Include: map[string][]string{
+				"authors": {event.Content.Author},
+				"voters":  {event.Op.Voter},
+			},
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+				"tagBlacklist":    contentTags(event.Content),
+			},
+		}
+
+	case *events.CommentFlagged:
+		return &Criteria{
+			Kind: "comment.flagged",
+			Include: map[string][]string{
+				"authors": {event.Content.Author},
+				"voters":  {event.Op.Voter},
+			},
+			Exclude: map[string][]string{
+				"authorBlacklist": {event.Content.Author},
+				"tagBlacklist":    contentTags(event.Content),
+			},
+		}
+
+	default:
+		return nil
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for transfer.made")
 }
 
-func (processor *BlockProcessor) HandleUserMentionedEvent(event *events.UserMentioned) error {
-	query := bson.M{
-		"kind":            "user.mentioned",
-		"users":           event.User,
-		"authorBlacklist": bson.M{"$ne": event.Content.Author},
+func (processor *BlockProcessor) HandleAccountUpdatedEvent(event *events.AccountUpdated) error {
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchAccountUpdatedEvent(ownerId.Hex(), event)
 	}
+	return nil
+}
 
-	log.Println(query)
+func (processor *BlockProcessor) HandleAccountWitnessVotedEvent(event *events.AccountWitnessVoted) error {
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchAccountWitnessVotedEvent(ownerId.Hex(), event)
+	}
+	return nil
+}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+func (processor *BlockProcessor) HandleTransferMadeEvent(event *events.TransferMade) error {
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchTransferMadeEvent(ownerId.Hex(), event)
 	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchUserMentionedEvent(result.OwnerId.Hex(), event)
+	return nil
+}
+
+func (processor *BlockProcessor) HandleUserMentionedEvent(event *events.UserMentioned) error {
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchUserMentionedEvent(ownerId.Hex(), event)
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for user.mentioned")
+	return nil
 }
 
 func (processor *BlockProcessor) HandleUserFollowStatusChangedEvent(
 	event *events.UserFollowStatusChanged,
 ) error {
 
-	query := bson.M{
-		"kind":  "user.follow_changed",
-		"users": event.Op.Following,
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchUserFollowStatusChangedEvent(ownerId.Hex(), event)
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) HandleStoryPublishedEvent(event *events.StoryPublished) error {
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchStoryPublishedEvent(ownerId.Hex(), event)
 	}
+	return processor.schedulePayoutReminders(event)
+}
 
-	log.Println(query)
+func (processor *BlockProcessor) HandleStoryVotedEvent(event *events.StoryVoted) error {
+	// The users watching flags are notified about flags using story.flagged.
+	// That includes the flags replaced by this vote, but they are only told once.
+	flag := &events.StoryFlagged{
+		Op:      event.Op,
+		Content: event.Content,
+		Removed: true,
+		Origin:  event.Origin,
+	}
+	var flagOwnerIds []bson.ObjectId
+	if event.Op.Weight < 0 {
+		flagOwnerIds = processor.index.Match(matchCriteria(flag))
+	} else {
+		watcherIds := processor.index.Match(matchCriteria(flag))
+		flagged, err := processor.forgetFlag(event.Op, event.Origin.BlockNum, len(watcherIds) != 0)
+		if err != nil {
+			return err
+		}
+		if flagged {
+			flagOwnerIds = watcherIds
+			for _, ownerId := range flagOwnerIds {
+				processor.DispatchStoryFlaggedEvent(ownerId.Hex(), flag)
+			}
+		}
+	}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+	ownerIds := excludeOwners(processor.index.Match(matchCriteria(event)), flagOwnerIds)
+	if len(ownerIds) != 0 && !event.Removed {
+		event.Value = processor.estimateVoteValue(event.Op, event.Content)
 	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchUserFollowStatusChangedEvent(result.OwnerId.Hex(), event)
+	for _, ownerId := range ownerIds {
+		processor.DispatchStoryVotedEvent(ownerId.Hex(), event)
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for user.follow_changed")
+	return nil
 }
 
-func (processor *BlockProcessor) HandleStoryPublishedEvent(event *events.StoryPublished) error {
-	query := bson.M{
-		"kind": "story.published",
-		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"tags": bson.M{
-					"$in": event.Content.JsonMetadata.Tags,
-				},
-			},
-		},
+func (processor *BlockProcessor) HandleCommentPublishedEvent(event *events.CommentPublished) error {
+	notified := make(map[bson.ObjectId]struct{})
+	for _, ownerId := range processor.index.Match(matchCriteria(event)) {
+		processor.DispatchCommentPublishedEvent(ownerId.Hex(), event)
+		notified[ownerId] = struct{}{}
 	}
 
-	log.Println(query)
+	return processor.handleThreadReply(event, notified)
+}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+func (processor *BlockProcessor) HandleCommentVotedEvent(event *events.CommentVoted) error {
+	// The users watching flags are notified about flags using comment.flagged.
+	// That includes the flags replaced by this vote, but they are only told once.
+	flag := &events.CommentFlagged{
+		Op:      event.Op,
+		Content: event.Content,
+		Removed: true,
+		Origin:  event.Origin,
 	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchStoryPublishedEvent(result.OwnerId.Hex(), event)
+	var flagOwnerIds []bson.ObjectId
+	if event.Op.Weight < 0 {
+		flagOwnerIds = processor.index.Match(matchCriteria(flag))
+	} else {
+		watcherIds := processor.index.Match(matchCriteria(flag))
+		flagged, err := processor.forgetFlag(event.Op, event.Origin.BlockNum, len(watcherIds) != 0)
+		if err != nil {
+			return err
+		}
+		if flagged {
+			flagOwnerIds = watcherIds
+			for _, ownerId := range flagOwnerIds {
+				processor.DispatchCommentFlaggedEvent(ownerId.Hex(), flag)
+			}
+		}
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for story.published")
+
+	ownerIds := excludeOwners(processor.index.Match(matchCriteria(event)), flagOwnerIds)
+	if len(ownerIds) != 0 && !event.Removed {
+		event.Value = processor.estimateVoteValue(event.Op, event.Content)
+	}
+	for _, ownerId := range ownerIds {
+		processor.DispatchCommentVotedEvent(ownerId.Hex(), event)
+	}
+	return nil
 }
 
-func (processor *BlockProcessor) HandleStoryVotedEvent(event *events.StoryVoted) error {
-	query := bson.M{
-		"kind": "story.voted",
-		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"voters": event.Op.Voter,
-			},
-		},
+func (processor *BlockProcessor) HandleStoryFlaggedEvent(event *events.StoryFlagged) error {
+	ownerIds := processor.index.Match(matchCriteria(event))
+	if len(ownerIds) == 0 {
+		return nil
 	}
 
-	log.Println(query)
+	// Only the flags being watched are recorded.
+	if !event.Removed {
+		event.Value = processor.estimateVoteValue(event.Op, event.Content)
+		if err := processor.recordFlag(event.Op, event.Origin.BlockNum); err != nil {
+			return err
+		}
+	}
+	for _, ownerId := range ownerIds {
+		processor.DispatchStoryFlaggedEvent(ownerId.Hex(), event)
+	}
+	return nil
+}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+func (processor *BlockProcessor) HandleCommentFlaggedEvent(event *events.CommentFlagged) error {
+	ownerIds := processor.index.Match(matchCriteria(event))
+	if len(ownerIds) == 0 {
+		return nil
 	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchStoryVotedEvent(result.OwnerId.Hex(), event)
+
+	// Only the flags being watched are recorded.
+	if !event.Removed {
+		event.Value = processor.estimateVoteValue(event.Op, event.Content)
+		if err := processor.recordFlag(event.Op, event.Origin.BlockNum); err != nil {
+			return err
+		}
+	}
+	for _, ownerId := range ownerIds {
+		processor.DispatchCommentFlaggedEvent(ownerId.Hex(), event)
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for story.voted")
+	return nil
 }
 
-func (processor *BlockProcessor) HandleCommentPublishedEvent(event *events.CommentPublished) error {
-	query := bson.M{
-		"kind": "comment.published",
-		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"parentAuthors": event.Content.ParentAuthor,
-			},
-		},
+// excludeOwners returns the owners not listed in excluded.
+func excludeOwners(ownerIds, excluded []bson.ObjectId) []bson.ObjectId {
+	if len(excluded) == 0 {
+		return ownerIds
+	}
+
+	skip := make(map[bson.ObjectId]struct{}, len(excluded))
+	for _, ownerId := range excluded {
+		skip[ownerId] = struct{}{}
+	}
+
+	var rest []bson.ObjectId
+	for _, ownerId := range ownerIds {
+		if _, ok := skip[ownerId]; !ok {
+			rest = append(rest, ownerId)
+		}
+	}
+	return rest
+}
+
+func (processor *BlockProcessor) HandleContentMatchedEvent(event *events.ContentMatched) error {
+	// The users were notified when the content was published.
+	if event.IsEdit() {
+		return nil
 	}
 
-	log.Println(query)
+	text := event.Content.Title + "\n" + event.Content.Body
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+	for ownerId, matches := range processor.index.MatchContent(text) {
+		processor.DispatchContentMatchedEvent(ownerId.Hex(), &events.ContentMatched{
+			Op:      event.Op,
+			Content: event.Content,
+			Matches: matches,
+			Origin:  event.Origin,
+		})
 	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchCommentPublishedEvent(result.OwnerId.Hex(), event)
+	return nil
+}
+
+// handleOrphanedBlock processes the canonical block replacing the orphaned one.
+//
+// The deliveries recorded for the orphaned block are kept aside until the canonical
+// block is processed. The notifications the canonical block produces again are not sent
+// twice thanks to the delivery log, the rest is retracted then, see retractOrphaned.
+func (processor *BlockProcessor) handleOrphanedBlock(canonical *database.Block) error {
+	records, err := processor.deliveries.ForBlock(canonical.Number)
+	if err != nil {
+		return err
 	}
-	if err := iter.Err(); err != nil {
-		return errors.Wrap(err, "failed get target users for comment.published")
+
+	if len(records) != 0 {
+		processor.orphanedLock.Lock()
+		processor.orphaned[canonical.Number] = append(processor.orphaned[canonical.Number], records...)
+		processor.orphanedLock.Unlock()
 	}
 
+	processor.inFlight.Add(1)
+	select {
+	case processor.blockCh <- canonical:
+	case <-processor.t.Dying():
+		processor.inFlight.Done()
+	}
 	return nil
 }
 
-func (processor *BlockProcessor) HandleCommentVotedEvent(event *events.CommentVoted) error {
-	query := bson.M{
-		"kind": "comment.voted",
-		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"voters": event.Op.Voter,
-			},
-		},
+// retractOrphaned notifies the users about the notifications sent for the orphaned block
+// the canonical block did not produce again, then it forgets the deliveries retracted.
+//
+// Planned are the delivery keys produced by processing the canonical block.
+func (processor *BlockProcessor) retractOrphaned(blockNum uint32, planned map[string]struct{}) error {
+	processor.orphanedLock.Lock()
+	records, ok := processor.orphaned[blockNum]
+	delete(processor.orphaned, blockNum)
+	processor.orphanedLock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	type target struct {
+		userId     string
+		notifierId string
 	}
+	var (
+		retracted = make(map[target]*events.BlockOrphaned)
+		keys      = make([]string, 0, len(records))
+	)
+	for _, record := range records {
+		if _, ok := planned[record.Key]; ok {
+			continue
+		}
+		keys = append(keys, record.Key)
 
-	log.Println(query)
+		key := target{record.UserId, record.NotifierId}
+		event, ok := retracted[key]
+		if !ok {
+			event = &events.BlockOrphaned{BlockNum: blockNum}
+			retracted[key] = event
+		}
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+		event.Count++
+		if !containsString(event.Kinds, record.Kind) {
+			event.Kinds = append(event.Kinds, record.Kind)
+		}
 	}
-	iter := processor.db.C("events").Find(query).Iter()
-	for iter.Next(&result) {
-		processor.DispatchCommentVotedEvent(result.OwnerId.Hex(), event)
+
+	for key, event := range retracted {
+		processor.DispatchBlockOrphanedEvent(key.userId, key.notifierId, event)
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for comment.voted")
+
+	return processor.deliveries.Forget(keys)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTags returns the tags associated with the given content.
+func contentTags(content *database.Content) []string {
+	if content.JsonMetadata == nil {
+		return nil
+	}
+	return content.JsonMetadata.Tags
 }
 
 //==============================================================================
@@ -617,126 +1289,348 @@ type NotifierDoc struct {
 	Settings   bson.Raw `bson:"settings"`
 }
 
-func (processor *BlockProcessor) getActiveNotifiersForUser(userId string) ([]*NotifierDoc, error) {
-	query := bson.M{
-		"ownerId": bson.ObjectIdHex(userId),
-		"enabled": true,
-	}
+// dispatchEvent enqueues the event to be dispatched using every notifier enabled by the user.
+// It blocks while the dispatch queue of any of the notifiers is full.
+//
+// Deliveries using the notifiers enabled by the user are deduplicated
+// using the event kind and origin, so that the user is not notified twice
+// when a block is processed again after restart.
+func (processor *BlockProcessor) dispatchEvent(
+	userId string,
+	kind string,
+	origin *events.Origin,
+	actors []string,
+	dispatch func(Notifier, bson.Raw) error,
+) {
 
-	var result []*NotifierDoc
-	if err := processor.db.C("notifiers").Find(query).All(&result); err != nil {
-		return nil, err
-	}
-	return result, nil
-}
+	usersMatched.WithLabelValues(kind).Inc()
 
-func (processor *BlockProcessor) dispatchEvent(userId string, dispatch func(Notifier, bson.Raw) error) error {
-	notifiers, err := processor.getActiveNotifiersForUser(userId)
-	if err != nil {
-		return errors.Wrapf(err, "failed to get notifiers for user %v", userId)
+	// Drop the event in case the processor is restricted to another user.
+	if processor.onlyUserId != "" && userId != processor.onlyUserId {
+		return
 	}
 
-	for _, notifier := range notifiers {
-		id := notifier.NotifierId
+	ownerId := bson.ObjectIdHex(userId)
 
-		dispatcher, ok := availableNotifiers[id]
-		if !ok {
-			dispatcher, ok = processor.additionalNotifiers[id]
-			if !ok {
-				log.Printf("dispatcher not found: id=%v", id)
-				continue
-			}
+	logger := processor.logger.WithFields(logrus.Fields{
+		"correlation_id": origin.CorrelationId(),
+		"kind":           kind,
+		"user":           userId,
+	})
+
+	// Drop the event in case the user muted any of the accounts involved.
+	if processor.index.IsMuted(ownerId, actors) {
+		logger.Debug("event muted")
+		return
+	}
+	logger.Debug("event matched")
+
+	// Only report the deliveries in case this is a dry run.
+	if report := processor.dryRun; report != nil {
+		for _, notifier := range processor.index.Notifiers(ownerId) {
+			report(&PlannedDelivery{
+				UserId:     userId,
+				NotifierId: notifier.NotifierId,
+				Kind:       kind,
+				Origin:     *origin,
+			})
 		}
+		return
+	}
 
-		if err := dispatch(dispatcher, notifier.Settings); err != nil {
-			log.Printf("dispatcher %v failed: %+v", id, err)
+	// Stale events are only counted in case they are to be sent as a digest.
+	// The event is counted as a failed notification in case it cannot be added,
+	// the block is retried then the same way as when the dispatch fails.
+	if origin.IsDelayed() && processor.catchUp.policy == CatchUpDigest {
+		if err := processor.catchUp.Add(userId, kind, origin); err != nil {
+			logger.WithError(err).Error("Failed adding event to the catch-up digest")
+			processor.pendingBlocks.Add(originKey(origin)).Done(true)
 		}
+		return
 	}
 
-	var settings bson.Raw
-	for id, dispatcher := range processor.additionalNotifiers {
-		if err := dispatch(dispatcher, settings); err != nil {
-			log.Printf("dispatcher %v failed: %+v", id, err)
+	// The links are rendered for the front-end chosen by the user.
+	preferences := processor.userPreferences(ownerId)
+
+	for _, notifier := range processor.index.Notifiers(ownerId) {
+		settings, err := withPreferences(notifier.Settings, preferences)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to apply user preferences, using the defaults")
 		}
+
+		record := newDelivery(origin, kind, userId, notifier.NotifierId)
+		block := processor.pendingBlocks.Add(originKey(origin))
+		block.Plan(record)
+
+		processor.dispatchPool.Enqueue(notifier.NotifierId, &dispatchJob{
+			userId:   userId,
+			settings: settings,
+			dispatch: dispatch,
+			delivery: record,
+			block:    block,
+			logger:   logger,
+		})
 	}
 
-	return nil
+	settings, err := withPreferences(bson.Raw{}, preferences)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to apply user preferences, using the defaults")
+	}
+	for id := range processor.additionalNotifiers {
+		processor.dispatchPool.Enqueue(id, &dispatchJob{
+			userId:   userId,
+			settings: settings,
+			dispatch: dispatch,
+			block:    processor.pendingBlocks.Add(originKey(origin)),
+			logger:   logger,
+		})
+	}
+}
+
+// dispatchDetached dispatches an event not mined from a block and it waits
+// until all the notifications are dispatched. The origin key must be set,
+// it identifies the event for tracking and deduplicating the notifications.
+//
+// False is returned in case any of the notifications could not be dispatched,
+// the event is to be dispatched again later using the same key then.
+func (processor *BlockProcessor) dispatchDetached(origin *events.Origin, dispatch func()) bool {
+	key := originKey(origin)
+	pending := processor.pendingBlocks.Begin(key)
+	defer processor.pendingBlocks.End(key)
+
+	dispatch()
+	if err := pending.Wait(processor.t.Dying()); err != nil {
+		return false
+	}
+
+	if n := pending.Failed(); n != 0 {
+		atomic.AddInt32(&processor.dispatchFailures, int32(n))
+		processor.logger.WithFields(logrus.Fields{
+			"correlation_id": origin.CorrelationId(),
+			"failed":         n,
+		}).Warn("Some notifications for the event could not be dispatched")
+		return false
+	}
+	return true
+}
+
+// eventActors returns the accounts involved in the event.
+// The event is dropped for the users that muted any of them.
+func eventActors(event interface{}) []string {
+	switch event := event.(type) {
+	case *events.AccountUpdated:
+		return []string{event.Op.Account}
+	case *events.AccountWitnessVoted:
+		return []string{event.Op.Account, event.Op.Witness}
+	case *events.TransferMade:
+		return []string{event.Op.From, event.Op.To}
+	case *events.UserMentioned:
+		return []string{event.Content.Author}
+	case *events.UserFollowStatusChanged:
+		return []string{event.Op.Follower}
+	case *events.StoryPublished:
+		return []string{event.Content.Author}
+	case *events.StoryVoted:
+		return []string{event.Op.Voter, event.Content.Author}
+	case *events.CommentPublished:
+		return []string{event.Content.Author}
+	case *events.CommentThreadReply:
+		return []string{event.Content.Author}
+	case *events.CommentVoted:
+		return []string{event.Op.Voter, event.Content.Author}
+	case *events.StoryFlagged:
+		return []string{event.Op.Voter, event.Content.Author}
+	case *events.CommentFlagged:
+		return []string{event.Op.Voter, event.Content.Author}
+	case *events.ContentMatched:
+		return []string{event.Content.Author}
+	case *events.StoryPayoutSoon:
+		return []string{event.Content.Author}
+	default:
+		return nil
+	}
 }
 
 func (processor *BlockProcessor) DispatchAccountUpdatedEvent(userId string, event *events.AccountUpdated) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchAccountUpdatedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchAccountUpdatedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "account.updated", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchAccountWitnessVotedEvent(
 	userId string,
 	event *events.AccountWitnessVoted,
 ) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchAccountWitnessVotedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchAccountWitnessVotedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "account.witness_voted", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchTransferMadeEvent(userId string, event *events.TransferMade) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchTransferMadeEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchTransferMadeEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "transfer.made", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchUserMentionedEvent(userId string, event *events.UserMentioned) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchUserMentionedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchUserMentionedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "user.mentioned", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchUserFollowStatusChangedEvent(
 	userId string,
 	event *events.UserFollowStatusChanged,
 ) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchUserFollowStatusChangedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchUserFollowStatusChangedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "user.follow_changed", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchStoryPublishedEvent(userId string, event *events.StoryPublished) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchStoryPublishedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchStoryPublishedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "story.published", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchStoryVotedEvent(userId string, event *events.StoryVoted) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchStoryVotedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchStoryVotedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "story.voted", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchCommentPublishedEvent(userId string, event *events.CommentPublished) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchCommentPublishedEvent(userId, settings, event)
-		})
-	})
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchCommentPublishedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "comment.published", &event.Origin, actors, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchCommentThreadReplyEvent(userId string, event *events.CommentThreadReply) {
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchCommentThreadReplyEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "comment.thread_reply", &event.Origin, actors, dispatch)
 }
 
 func (processor *BlockProcessor) DispatchCommentVotedEvent(userId string, event *events.CommentVoted) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchCommentVotedEvent(userId, settings, event)
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchCommentVotedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "comment.voted", &event.Origin, actors, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchStoryFlaggedEvent(userId string, event *events.StoryFlagged) {
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchStoryFlaggedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "story.flagged", &event.Origin, actors, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchCommentFlaggedEvent(userId string, event *events.CommentFlagged) {
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchCommentFlaggedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "comment.flagged", &event.Origin, actors, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchContentMatchedEvent(userId string, event *events.ContentMatched) {
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchContentMatchedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "content.matched", &event.Origin, actors, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchStoryPayoutSoonEvent(userId string, event *events.StoryPayoutSoon) {
+	actors := eventActors(event)
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchStoryPayoutSoonEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "story.payout_soon", &event.Origin, actors, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchAccountThresholdCrossedEvent(
+	userId string,
+	event *events.AccountThresholdCrossed,
+) {
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchAccountThresholdCrossedEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "account.threshold_crossed", &event.Origin, nil, dispatch)
+}
+
+func (processor *BlockProcessor) DispatchPriceAlertEvent(userId string, event *events.PriceAlert) {
+	dispatch := func(notifier Notifier, settings bson.Raw) error {
+		return notifier.DispatchPriceAlertEvent(userId, settings, event)
+	}
+	processor.dispatchEvent(userId, "price.alert", &event.Origin, nil, dispatch)
+}
+
+// DispatchBlockOrphanedEvent sends the event using the given notifier only,
+// it being the notifier used to deliver the notifications now being retracted.
+func (processor *BlockProcessor) DispatchBlockOrphanedEvent(
+	userId string,
+	notifierId string,
+	event *events.BlockOrphaned,
+) {
+	for _, notifier := range processor.index.Notifiers(bson.ObjectIdHex(userId)) {
+		if notifier.NotifierId != notifierId {
+			continue
+		}
+
+		processor.dispatchPool.Enqueue(notifierId, &dispatchJob{
+			userId:   userId,
+			settings: notifier.Settings,
+			dispatch: func(notifier Notifier, settings bson.Raw) error {
+				return notifier.DispatchBlockOrphanedEvent(userId, settings, event)
+			},
+			logger: processor.logger.WithFields(logrus.Fields{
+				"block": event.BlockNum,
+				"kind":  "block.orphaned",
+				"user":  userId,
+			}),
 		})
-	})
+	}
+}
+
+// DispatchCatchUpDigestEvent sends the digest using every notifier enabled by the user.
+// The digest origin key is used to track and deduplicate the notifications.
+func (processor *BlockProcessor) DispatchCatchUpDigestEvent(userId string, event *events.CatchUpDigest) {
+	origin := &event.Origin
+	for _, notifier := range processor.index.Notifiers(bson.ObjectIdHex(userId)) {
+		processor.dispatchPool.Enqueue(notifier.NotifierId, &dispatchJob{
+			userId:   userId,
+			settings: notifier.Settings,
+			dispatch: func(notifier Notifier, settings bson.Raw) error {
+				return notifier.DispatchCatchUpDigestEvent(userId, settings, event)
+			},
+			delivery: newDelivery(origin, "catch_up.digest", userId, notifier.NotifierId),
+			block:    processor.pendingBlocks.Add(originKey(origin)),
+			logger: processor.logger.WithFields(logrus.Fields{
+				"correlation_id": origin.CorrelationId(),
+				"kind":           "catch_up.digest",
+				"user":           userId,
+			}),
+		})
+	}
 }
@@ -0,0 +1,232 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Catch-up policies specify what happens to events older than the configured age,
+// which is what happens when SteemWatch is processing blocks after downtime.
+const (
+	// CatchUpDeliver delivers stale events, marked as delayed.
+	CatchUpDeliver = "deliver"
+
+	// CatchUpSkip drops stale events.
+	CatchUpSkip = "skip"
+
+	// CatchUpDigest sends every user a single summary of the stale events
+	// once SteemWatch catches up with the chain.
+	CatchUpDigest = "digest"
+)
+
+const (
+	DefaultCatchUpPolicy = CatchUpDeliver
+	DefaultCatchUpMaxAge = 10 * time.Minute
+
+	// DefaultDigestFlushInterval is how often the digests are sent
+	// when there are no more stale events coming.
+	DefaultDigestFlushInterval = 30 * time.Second
+
+	// DefaultDigestMaxPeriod limits how long a digest can be collecting events,
+	// so that the users get something even when catching up takes forever.
+	DefaultDigestMaxPeriod = 1 * time.Hour
+)
+
+// SetCatchUpPolicy sets what happens to events older than maxAge.
+// Setting maxAge to 0 disables the policy.
+func SetCatchUpPolicy(policy string, maxAge time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.catchUpPolicy = policy
+		processor.catchUpMaxAge = maxAge
+	}
+}
+
+type catchUp struct {
+	policy string
+	maxAge time.Duration
+
+	// digests holds the digests being collected, one document per user.
+	// The digests are stored in the database as the events are counted,
+	// so that nothing is lost when the blocks are acknowledged before
+	// the digests are sent and the process is restarted in the meantime.
+	digests *mgo.Collection
+}
+
+func newCatchUp(policy string, maxAge time.Duration) (*catchUp, error) {
+	switch policy {
+	case CatchUpDeliver, CatchUpSkip, CatchUpDigest:
+	default:
+		return nil, errors.Errorf("unknown catch-up policy: %v", policy)
+	}
+
+	return &catchUp{
+		policy: policy,
+		maxAge: maxAge,
+	}, nil
+}
+
+// IsStale returns true when the event is older than the configured age.
+func (c *catchUp) IsStale(origin *events.Origin) bool {
+	if c.maxAge == 0 || origin.Timestamp.IsZero() {
+		return false
+	}
+	return time.Since(origin.Timestamp) > c.maxAge
+}
+
+// digestDoc is the digest being collected for a user.
+//
+// The event kinds contain dots, which cannot be used in field names,
+// so the kinds are escaped in Counts, see digestCountField.
+type digestDoc struct {
+	UserId    string         `bson:"_id"`
+	From      time.Time      `bson:"from"`
+	To        time.Time      `bson:"to"`
+	Counts    map[string]int `bson:"counts"`
+	Total     int            `bson:"total"`
+	OpenedAt  time.Time      `bson:"openedAt"`
+	UpdatedAt time.Time      `bson:"updatedAt"`
+}
+
+func digestCountField(kind string) string {
+	return "counts." + strings.Replace(kind, ".", ":", -1)
+}
+
+// Digest returns the event to be sent for the digest.
+//
+// The origin key changes every time an event is added to the digest,
+// so a digest is never mistaken for another one already delivered.
+func (doc *digestDoc) Digest() *events.CatchUpDigest {
+	digest := &events.CatchUpDigest{
+		From:   doc.From,
+		To:     doc.To,
+		Counts: make(map[string]int, len(doc.Counts)),
+		Origin: events.Origin{
+			Key:       fmt.Sprintf("catchUpDigests:%v:%v", doc.UserId, doc.UpdatedAt.UnixNano()),
+			Timestamp: doc.To,
+		},
+	}
+	for field, n := range doc.Counts {
+		if n > 0 {
+			digest.Counts[strings.Replace(field, ":", ".", -1)] = n
+		}
+	}
+	return digest
+}
+
+// Add records the event into the digest for the given user.
+//
+// The digest is only a summary, so the events are not deduplicated,
+// i.e. an event is counted twice in case its block is processed again.
+func (c *catchUp) Add(userId string, kind string, origin *events.Origin) error {
+	now := time.Now()
+	_, err := c.digests.UpsertId(userId, bson.M{
+		"$inc": bson.M{
+			digestCountField(kind): 1,
+			"total":                1,
+		},
+		"$min":         bson.M{"from": origin.Timestamp},
+		"$max":         bson.M{"to": origin.Timestamp},
+		"$set":         bson.M{"updatedAt": now},
+		"$setOnInsert": bson.M{"openedAt": now},
+	})
+	return errors.Wrapf(err, "failed to add %v to the catch-up digest of user %v", kind, userId)
+}
+
+// take returns the digests to be sent, if any. The digests are sent
+// when no stale event has been seen for the whole flush interval
+// or when the digests are being collected for too long.
+func (c *catchUp) take(flushInterval, maxPeriod time.Duration) ([]*digestDoc, error) {
+	var docs []*digestDoc
+	if err := c.digests.Find(nil).All(&docs); err != nil {
+		return nil, errors.Wrap(err, "failed to load catch-up digests")
+	}
+	if !digestsDue(docs, time.Now(), flushInterval, maxPeriod) {
+		return nil, nil
+	}
+	return docs, nil
+}
+
+// digestsDue returns true when the digests are to be sent at the given time.
+func digestsDue(docs []*digestDoc, now time.Time, flushInterval, maxPeriod time.Duration) bool {
+	if len(docs) == 0 {
+		return false
+	}
+
+	openedAt, lastAddAt := docs[0].OpenedAt, docs[0].UpdatedAt
+	for _, doc := range docs[1:] {
+		if doc.OpenedAt.Before(openedAt) {
+			openedAt = doc.OpenedAt
+		}
+		if doc.UpdatedAt.After(lastAddAt) {
+			lastAddAt = doc.UpdatedAt
+		}
+	}
+	return now.Sub(lastAddAt) >= flushInterval || now.Sub(openedAt) >= maxPeriod
+}
+
+// forget removes the events sent from the digest. The events added
+// while the digest was being sent are kept to be sent later.
+func (c *catchUp) forget(doc *digestDoc) error {
+	update := bson.M{
+		"total": -doc.Total,
+	}
+	for field, n := range doc.Counts {
+		update["counts."+field] = -n
+	}
+	err := c.digests.UpdateId(doc.UserId, bson.M{
+		"$inc": update,
+		"$set": bson.M{"openedAt": time.Now()},
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrapf(err, "failed to update the catch-up digest of user %v", doc.UserId)
+	}
+
+	err = c.digests.Remove(bson.M{
+		"_id":   doc.UserId,
+		"total": bson.M{"$lte": 0},
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrapf(err, "failed to remove the catch-up digest of user %v", doc.UserId)
+	}
+	return nil
+}
+
+// digestFlusher sends the digests collected using the given function.
+// The digests that could not be sent are kept to be sent again on the next flush.
+func (c *catchUp) digestFlusher(
+	flushInterval time.Duration,
+	maxPeriod time.Duration,
+	send func(userId string, digest *events.CatchUpDigest) bool,
+	logger *logrus.Entry,
+	dying <-chan struct{},
+) error {
+
+	for {
+		select {
+		case <-time.After(flushInterval):
+			docs, err := c.take(flushInterval, maxPeriod)
+			if err != nil {
+				logger.WithError(err).Warn("Failed taking catch-up digests")
+				continue
+			}
+			for _, doc := range docs {
+				if !send(doc.UserId, doc.Digest()) {
+					continue
+				}
+				if err := c.forget(doc); err != nil {
+					logger.WithError(err).Warn("Failed forgetting catch-up digest")
+				}
+			}
+		case <-dying:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package notifications
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+func TestNewCatchUp(t *testing.T) {
+	testCases := []struct {
+		policy string
+		valid  bool
+	}{
+		{CatchUpDeliver, true},
+		{CatchUpSkip, true},
+		{CatchUpDigest, true},
+		{"", false},
+		{"drop", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			_, err := newCatchUp(tc.policy, DefaultCatchUpMaxAge)
+			if valid := err == nil; valid != tc.valid {
+				t.Errorf("expected valid to be %v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestCatchUp_IsStale(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		maxAge    time.Duration
+		timestamp time.Time
+		stale     bool
+	}{
+		{"recent event", 10 * time.Minute, now.Add(-time.Minute), false},
+		{"old event", 10 * time.Minute, now.Add(-time.Hour), true},
+		{"policy disabled", 0, now.Add(-time.Hour), false},
+		{"event without timestamp", 10 * time.Minute, time.Time{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := newCatchUp(CatchUpSkip, tc.maxAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stale := c.IsStale(&events.Origin{Timestamp: tc.timestamp}); stale != tc.stale {
+				t.Errorf("expected stale to be %v, got %v", tc.stale, stale)
+			}
+		})
+	}
+}
+
+func TestDigestDoc_Digest(t *testing.T) {
+	var (
+		from = time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+		to   = from.Add(2 * time.Minute)
+	)
+
+	doc := &digestDoc{
+		UserId: "alice",
+		From:   from,
+		To:     to,
+		Counts: map[string]int{
+			"story:voted":         2,
+			"user:follow_changed": 1,
+			"transfer:made":       0,
+		},
+		Total:     3,
+		UpdatedAt: to,
+	}
+
+	expected := &events.CatchUpDigest{
+		From:   from,
+		To:     to,
+		Counts: map[string]int{"story.voted": 2, "user.follow_changed": 1},
+		Origin: events.Origin{
+			Key:       fmt.Sprintf("catchUpDigests:alice:%v", to.UnixNano()),
+			Timestamp: to,
+		},
+	}
+	if digest := doc.Digest(); !reflect.DeepEqual(digest, expected) {
+		t.Errorf("expected %+v, got %+v", expected, digest)
+	}
+
+	// The field the counts are incremented in matches the key decoded.
+	if field := digestCountField("user.follow_changed"); field != "counts.user:follow_changed" {
+		t.Errorf("unexpected count field: %v", field)
+	}
+
+	// Adding an event changes the digest key.
+	doc.UpdatedAt = to.Add(time.Second)
+	if digest := doc.Digest(); digest.Key == expected.Key {
+		t.Errorf("expected the key to change, got %v", digest.Key)
+	}
+}
+
+func TestDigestsDue(t *testing.T) {
+	var (
+		now           = time.Now()
+		flushInterval = time.Minute
+		maxPeriod     = time.Hour
+	)
+
+	testCases := []struct {
+		name string
+		docs []*digestDoc
+		due  bool
+	}{
+		{
+			name: "no digests",
+			due:  false,
+		},
+		{
+			name: "stale events still coming",
+			docs: []*digestDoc{
+				{OpenedAt: now.Add(-10 * time.Minute), UpdatedAt: now.Add(-time.Hour)},
+				{OpenedAt: now.Add(-5 * time.Minute), UpdatedAt: now.Add(-time.Second)},
+			},
+			due: false,
+		},
+		{
+			name: "no stale event for the flush interval",
+			docs: []*digestDoc{
+				{OpenedAt: now.Add(-10 * time.Minute), UpdatedAt: now.Add(-2 * time.Minute)},
+				{OpenedAt: now.Add(-5 * time.Minute), UpdatedAt: now.Add(-3 * time.Minute)},
+			},
+			due: true,
+		},
+		{
+			name: "collecting for too long",
+			docs: []*digestDoc{
+				{OpenedAt: now.Add(-2 * time.Hour), UpdatedAt: now.Add(-time.Second)},
+				{OpenedAt: now.Add(-5 * time.Minute), UpdatedAt: now},
+			},
+			due: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if due := digestsDue(tc.docs, now, flushInterval, maxPeriod); due != tc.due {
+				t.Errorf("expected due to be %v, got %v", tc.due, due)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultContentCacheSize = 10000
+	DefaultContentCacheTTL  = 30 * time.Second
+)
+
+// SetContentCache sets the size and the TTL of the content cache shared by the workers.
+// The cache is disabled in case the size is 0.
+func SetContentCache(size int, ttl time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.contentCacheSize = size
+		processor.contentCacheTTL = ttl
+	}
+}
+
+type contentKey struct {
+	author   string
+	permlink string
+}
+
+type cachedContent struct {
+	content   *database.Content
+	expiresAt time.Time
+}
+
+// contentCall is a lookup in progress other workers can wait for.
+type contentCall struct {
+	content *database.Content
+	err     error
+	done    chan struct{}
+}
+
+// contentCache caches the content fetched from steemd for a short time.
+//
+// A post receiving many votes in a short period is only fetched once that way.
+// Concurrent lookups of the same content are coalesced into a single RPC call.
+type contentCache struct {
+	cache *lru.Cache
+	ttl   time.Duration
+
+	calls map[contentKey]*contentCall
+	lock  sync.Mutex
+}
+
+func newContentCache(size int, ttl time.Duration) (*contentCache, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create content cache")
+	}
+	return &contentCache{
+		cache: cache,
+		ttl:   ttl,
+		calls: make(map[contentKey]*contentCall),
+	}, nil
+}
+
+// Get returns the content for the given author and permlink,
+// calling fetch in case the content is not cached or has expired.
+func (cache *contentCache) Get(
+	author string,
+	permlink string,
+	fetch func() (*database.Content, error),
+) (*database.Content, error) {
+
+	key := contentKey{author, permlink}
+
+	cache.lock.Lock()
+	if v, ok := cache.cache.Get(key); ok {
+		cached := v.(*cachedContent)
+		if time.Now().Before(cached.expiresAt) {
+			cache.lock.Unlock()
+			contentCacheLookups.WithLabelValues("hit").Inc()
+			return cached.content, nil
+		}
+		cache.cache.Remove(key)
+	}
+
+	// Wait for the lookup in progress in case there is any.
+	if call, ok := cache.calls[key]; ok {
+		cache.lock.Unlock()
+		contentCacheLookups.WithLabelValues("coalesced").Inc()
+		<-call.done
+		return call.content, call.err
+	}
+
+	call := &contentCall{done: make(chan struct{})}
+	cache.calls[key] = call
+	cache.lock.Unlock()
+
+	contentCacheLookups.WithLabelValues("miss").Inc()
+	call.content, call.err = fetch()
+
+	cache.lock.Lock()
+	delete(cache.calls, key)
+	if call.err == nil {
+		cache.cache.Add(key, &cachedContent{call.content, time.Now().Add(cache.ttl)})
+	}
+	cache.lock.Unlock()
+	close(call.done)
+
+	return call.content, call.err
+}
+
+// Put replaces the cached content.
+func (cache *contentCache) Put(author, permlink string, content *database.Content) {
+	cache.lock.Lock()
+	cache.cache.Add(contentKey{author, permlink}, &cachedContent{content, time.Now().Add(cache.ttl)})
+	cache.lock.Unlock()
+}
+
+// getContent fetches the content associated with the operation, using the cache when enabled.
+//
+// Comment operations modify the content, so the content is always fetched for them
+// and the cache is updated with the result.
+func (processor *BlockProcessor) getContent(client *rpc.Client, op types.Operation) (*database.Content, error) {
+	cache := processor.contentCache
+	if cache == nil {
+		return getOperationContent(client, op)
+	}
+
+	author, permlink, ok := operationContentKey(op)
+	if !ok {
+		return nil, nil
+	}
+
+	if op.Type() == types.TypeComment {
+		content, err := getOperationContent(client, op)
+		if err != nil {
+			return nil, err
+		}
+		cache.Put(author, permlink, content)
+		return content, nil
+	}
+
+	return cache.Get(author, permlink, func() (*database.Content, error) {
+		return getOperationContent(client, op)
+	})
+}
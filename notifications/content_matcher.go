@@ -0,0 +1,193 @@
+package notifications
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/notifications/matching"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MaxPatternsPerUser limits the number of regular expressions per user.
+const MaxPatternsPerUser = 10
+
+// MaxPatterns limits the number of regular expressions in total.
+// Unlike keywords, regular expressions are evaluated for every subscription,
+// the patterns past the limit are ignored.
+const MaxPatterns = 1000
+
+type keywordOwner struct {
+	ownerId   bson.ObjectId
+	keyword   string
+	wholeWord bool
+}
+
+type patternOwner struct {
+	ownerId bson.ObjectId
+	pattern string
+	re      *regexp.Regexp
+}
+
+// patternSet holds the patterns of a single subscription.
+//
+// The patterns are combined into a single alternation so that the text is only
+// scanned once per subscription. The patterns are only evaluated one by one
+// to tell which of them matched once the alternation matches.
+// The alternation is nil in case it cannot be compiled.
+type patternSet struct {
+	any      *regexp.Regexp
+	patterns []*patternOwner
+}
+
+// contentMatcher holds all content.matched subscriptions
+// so that matching a story or a comment takes a single pass over the text.
+//
+// The matcher is immutable, it is rebuilt by the subscription index on every reload.
+type contentMatcher struct {
+	keywords *matching.Matcher
+	owners   [][]*keywordOwner
+	patterns []*patternSet
+}
+
+// newContentMatcher builds a matcher for the given content.matched subscriptions.
+func newContentMatcher(subs []*Subscription, logger *logrus.Entry) *contentMatcher {
+	var (
+		index    = make(map[string]int)
+		keywords []string
+		owners   [][]*keywordOwner
+		patterns []*patternSet
+		total    int
+	)
+
+	addKeyword := func(ownerId bson.ObjectId, keyword string, wholeWord bool) {
+		k := strings.ToLower(strings.TrimSpace(keyword))
+		if k == "" {
+			return
+		}
+
+		i, ok := index[k]
+		if !ok {
+			i = len(keywords)
+			index[k] = i
+			keywords = append(keywords, k)
+			owners = append(owners, nil)
+		}
+		owners[i] = append(owners[i], &keywordOwner{ownerId, keyword, wholeWord})
+	}
+
+	for _, sub := range subs {
+		for _, keyword := range sub.Lists["keywords"] {
+			addKeyword(sub.OwnerId, keyword, false)
+		}
+		for _, word := range sub.Lists["words"] {
+			addKeyword(sub.OwnerId, word, true)
+		}
+
+		var (
+			set          patternSet
+			alternatives []string
+		)
+		for i, pattern := range sub.Lists["patterns"] {
+			if i == MaxPatternsPerUser {
+				logger.WithField("user", sub.OwnerId.Hex()).Warn("content.matched: too many patterns")
+				break
+			}
+			if total == MaxPatterns {
+				logger.WithField("user", sub.OwnerId.Hex()).Warn("content.matched: pattern limit reached")
+				break
+			}
+
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"user":    sub.OwnerId.Hex(),
+					"pattern": pattern,
+				}).Warn("content.matched: invalid pattern")
+				continue
+			}
+			set.patterns = append(set.patterns, &patternOwner{sub.OwnerId, pattern, re})
+			alternatives = append(alternatives, "(?:"+pattern+")")
+			total++
+		}
+
+		switch len(set.patterns) {
+		case 0:
+			continue
+		case 1:
+			set.any = set.patterns[0].re
+		default:
+			// In case the alternation fails to compile, the patterns are evaluated one by one.
+			re, err := regexp.Compile("(?i)" + strings.Join(alternatives, "|"))
+			if err != nil {
+				logger.WithField("user", sub.OwnerId.Hex()).WithError(err).
+					Warn("content.matched: failed to combine patterns")
+			}
+			set.any = re
+		}
+		patterns = append(patterns, &set)
+	}
+
+	return &contentMatcher{
+		keywords: matching.New(keywords),
+		owners:   owners,
+		patterns: patterns,
+	}
+}
+
+// Match returns the keywords and patterns matched in the text, grouped by the subscription owner.
+func (matcher *contentMatcher) Match(text string) map[bson.ObjectId][]string {
+	var (
+		matches = make(map[bson.ObjectId][]string)
+		seen    = make(map[*keywordOwner]struct{})
+		lower   = strings.ToLower(text)
+	)
+
+	matcher.keywords.Match(lower, func(index, start, end int) {
+		for _, owner := range matcher.owners[index] {
+			if _, ok := seen[owner]; ok {
+				continue
+			}
+			if owner.wholeWord && !isWordBoundary(lower, start, end) {
+				continue
+			}
+			seen[owner] = struct{}{}
+			matches[owner.ownerId] = append(matches[owner.ownerId], owner.keyword)
+		}
+	})
+
+	for _, set := range matcher.patterns {
+		if set.any != nil && !set.any.MatchString(text) {
+			continue
+		}
+		for _, owner := range set.patterns {
+			if owner.re.MatchString(text) {
+				matches[owner.ownerId] = append(matches[owner.ownerId], owner.pattern)
+			}
+		}
+	}
+
+	return matches
+}
+
+// isWordBoundary returns true when text[start:end] is not surrounded by word characters.
+func isWordBoundary(text string, start, end int) bool {
+	isWordRune := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		if r, _ := utf8.DecodeRuneInString(text[end:]); isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
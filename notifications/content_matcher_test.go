@@ -0,0 +1,174 @@
+package notifications
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func newTestLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	return logrus.NewEntry(logger)
+}
+
+func TestContentMatcher(t *testing.T) {
+	var (
+		alice = bson.NewObjectId()
+		bob   = bson.NewObjectId()
+	)
+
+	tooManyPatterns := make([]string, MaxPatternsPerUser+1)
+	for i := range tooManyPatterns {
+		tooManyPatterns[i] = "p" + strconv.Itoa(i) + "x"
+	}
+
+	testCases := []struct {
+		name  string
+		subs  []*Subscription
+		text  string
+		match map[bson.ObjectId][]string
+	}{
+		{
+			name: "keyword is matched case-insensitively",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"keywords": {"SteemWatch"}}},
+			},
+			text:  "I love steemwatch!",
+			match: map[bson.ObjectId][]string{alice: {"SteemWatch"}},
+		},
+		{
+			name: "keyword is matched within a word",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"keywords": {"steem"}}},
+			},
+			text:  "steemit",
+			match: map[bson.ObjectId][]string{alice: {"steem"}},
+		},
+		{
+			name: "word is not matched within a word",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"words": {"go"}}},
+			},
+			text:  "gopher",
+			match: map[bson.ObjectId][]string{},
+		},
+		{
+			name: "word is matched on word boundaries",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"words": {"go"}}},
+			},
+			text:  "Written in Go.",
+			match: map[bson.ObjectId][]string{alice: {"go"}},
+		},
+		{
+			name: "keyword is reported once",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"keywords": {"steem"}}},
+			},
+			text:  "steem steem steem",
+			match: map[bson.ObjectId][]string{alice: {"steem"}},
+		},
+		{
+			name: "keywords are matched per owner",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"keywords": {"steem"}}},
+				{OwnerId: bob, Lists: map[string][]string{"keywords": {"steem", "bitcoin"}}},
+			},
+			text: "steem and bitcoin",
+			match: map[bson.ObjectId][]string{
+				alice: {"steem"},
+				bob:   {"steem", "bitcoin"},
+			},
+		},
+		{
+			name: "only the patterns matched are reported",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"patterns": {`\bsbd\b`, `steem(it)?`, `btc`}}},
+			},
+			text:  "STEEMIT and SBD",
+			match: map[bson.ObjectId][]string{alice: {`\bsbd\b`, `steem(it)?`}},
+		},
+		{
+			name: "patterns not matching are not reported",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"patterns": {`^steem`, `btc$`}}},
+			},
+			text:  "I love steem, not btc!",
+			match: map[bson.ObjectId][]string{},
+		},
+		{
+			name: "invalid pattern is skipped",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"patterns": {`steem(`, `sbd`}}},
+			},
+			text:  "steem( and sbd",
+			match: map[bson.ObjectId][]string{alice: {`sbd`}},
+		},
+		{
+			name: "patterns over the limit are ignored",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"patterns": tooManyPatterns}},
+			},
+			text:  "p0x p10x",
+			match: map[bson.ObjectId][]string{alice: {"p0x"}},
+		},
+		{
+			name: "patterns are matched per owner",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{"patterns": {`steem`}}},
+				{OwnerId: bob, Lists: map[string][]string{"patterns": {`btc`}}},
+			},
+			text:  "steem",
+			match: map[bson.ObjectId][]string{alice: {`steem`}},
+		},
+		{
+			name: "keywords and patterns are combined",
+			subs: []*Subscription{
+				{OwnerId: alice, Lists: map[string][]string{
+					"keywords": {"steem"},
+					"patterns": {`s[bm]d`},
+				}},
+			},
+			text:  "steem sbd",
+			match: map[bson.ObjectId][]string{alice: {"steem", `s[bm]d`}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matcher := newContentMatcher(tc.subs, newTestLogger())
+			if match := matcher.Match(tc.text); !reflect.DeepEqual(match, tc.match) {
+				t.Errorf("expected %v, got %v", tc.match, match)
+			}
+		})
+	}
+}
+
+func TestContentMatcher_MaxPatterns(t *testing.T) {
+	subs := make([]*Subscription, MaxPatterns/MaxPatternsPerUser+1)
+	for i := range subs {
+		patterns := make([]string, MaxPatternsPerUser)
+		for j := range patterns {
+			patterns[j] = "steem"
+		}
+		subs[i] = &Subscription{
+			OwnerId: bson.NewObjectId(),
+			Lists:   map[string][]string{"patterns": patterns},
+		}
+	}
+
+	matcher := newContentMatcher(subs, newTestLogger())
+
+	match := matcher.Match("steem")
+	if len(match) != len(subs)-1 {
+		t.Errorf("expected %v owners matched, got %v", len(subs)-1, len(match))
+	}
+	if _, ok := match[subs[len(subs)-1].OwnerId]; ok {
+		t.Error("expected the patterns over the limit to be ignored")
+	}
+}
@@ -0,0 +1,123 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultDeliveryTTL specifies how long successful deliveries are remembered.
+// It must be comfortably longer than the interval the processed block number
+// is persisted in, otherwise duplicate notifications are sent on restart.
+const DefaultDeliveryTTL = 24 * time.Hour
+
+func SetDeliveryTTL(ttl time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.deliveryTTL = ttl
+	}
+}
+
+type delivery struct {
+	Key         string    `bson:"_id"`
+	BlockNum    uint32    `bson:"blockNum"`
+	Kind        string    `bson:"kind"`
+	UserId      string    `bson:"userId"`
+	NotifierId  string    `bson:"notifierId"`
+	DeliveredAt time.Time `bson:"deliveredAt"`
+}
+
+// newDelivery returns the delivery record for the given event and notifier.
+// The key of the record is used as the idempotency key for the delivery.
+//
+// Events not mined from a block are identified by the origin key instead.
+// Nil is returned for events having neither, these are never deduplicated.
+func newDelivery(origin *events.Origin, kind, userId, notifierId string) *delivery {
+	var key string
+	switch {
+	case origin.Key != "":
+		key = fmt.Sprintf("%v:%v:%v:%v", origin.Key, kind, userId, notifierId)
+	case origin.BlockNum != 0:
+		key = fmt.Sprintf("%v:%v:%v:%v:%v:%v",
+			origin.BlockNum, origin.TrxNum, origin.OpNum, kind, userId, notifierId)
+	default:
+		return nil
+	}
+
+	return &delivery{
+		Key:        key,
+		BlockNum:   origin.BlockNum,
+		Kind:       kind,
+		UserId:     userId,
+		NotifierId: notifierId,
+	}
+}
+
+// deliveryLog records successful deliveries so that re-processing
+// a block after restart does not notify the users again.
+type deliveryLog struct {
+	c *mgo.Collection
+}
+
+func newDeliveryLog(db *mgo.Database, ttl time.Duration) (*deliveryLog, error) {
+	c := db.C("deliveries")
+
+	indexes := []mgo.Index{
+		{
+			Key:        []string{"blockNum"},
+			Background: true,
+		},
+		{
+			// The documents are removed by MongoDB once expired.
+			Key:         []string{"deliveredAt"},
+			Background:  true,
+			ExpireAfter: ttl,
+		},
+	}
+
+	for _, index := range indexes {
+		if err := c.EnsureIndex(index); err != nil {
+			return nil, errors.Wrapf(err, "failed to create index for deliveries.%v", index.Key)
+		}
+	}
+
+	return &deliveryLog{c}, nil
+}
+
+// Delivered returns true when the delivery with the given key already succeeded.
+func (deliveries *deliveryLog) Delivered(key string) (bool, error) {
+	n, err := deliveries.c.FindId(key).Count()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get delivery %v", key)
+	}
+	return n != 0, nil
+}
+
+// Record marks the delivery as successful.
+func (deliveries *deliveryLog) Record(record *delivery) error {
+	record.DeliveredAt = time.Now()
+	_, err := deliveries.c.UpsertId(record.Key, record)
+	return errors.Wrapf(err, "failed to record delivery %v", record.Key)
+}
+
+// ForBlock returns the deliveries recorded for events mined from the given block.
+func (deliveries *deliveryLog) ForBlock(blockNum uint32) ([]*delivery, error) {
+	var records []*delivery
+	if err := deliveries.c.Find(bson.M{"blockNum": blockNum}).All(&records); err != nil {
+		return nil, errors.Wrapf(err, "failed to get deliveries for block %v", blockNum)
+	}
+	return records, nil
+}
+
+// Forget removes the deliveries with the given keys.
+func (deliveries *deliveryLog) Forget(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := deliveries.c.RemoveAll(bson.M{"_id": bson.M{"$in": keys}})
+	return errors.Wrapf(err, "failed to remove deliveries %v", keys)
+}
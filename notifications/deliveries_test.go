@@ -0,0 +1,65 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+func TestNewDelivery(t *testing.T) {
+	origin := &events.Origin{BlockNum: 100, TrxNum: 1, OpNum: 2}
+	base := newDelivery(origin, "story.voted", "user", "slack")
+
+	testCases := []struct {
+		name       string
+		origin     *events.Origin
+		kind       string
+		userId     string
+		notifierId string
+		duplicate  bool
+	}{
+		{"same delivery", &events.Origin{BlockNum: 100, TrxNum: 1, OpNum: 2}, "story.voted", "user", "slack", true},
+		{"other block", &events.Origin{BlockNum: 101, TrxNum: 1, OpNum: 2}, "story.voted", "user", "slack", false},
+		{"other transaction", &events.Origin{BlockNum: 100, TrxNum: 2, OpNum: 2}, "story.voted", "user", "slack", false},
+		{"other operation", &events.Origin{BlockNum: 100, TrxNum: 1, OpNum: 3}, "story.voted", "user", "slack", false},
+		{"other kind", origin, "story.flagged", "user", "slack", false},
+		{"other user", origin, "story.voted", "other", "slack", false},
+		{"other notifier", origin, "story.voted", "user", "discord", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			record := newDelivery(tc.origin, tc.kind, tc.userId, tc.notifierId)
+			if record == nil {
+				t.Fatal("expected a delivery record")
+			}
+			if duplicate := record.Key == base.Key; duplicate != tc.duplicate {
+				t.Errorf("expected duplicate to be %v for keys %v and %v", tc.duplicate, record.Key, base.Key)
+			}
+			if record.BlockNum != tc.origin.BlockNum {
+				t.Errorf("expected block %v, got %v", tc.origin.BlockNum, record.BlockNum)
+			}
+		})
+	}
+
+	t.Run("events not mined from a block are identified by the origin key", func(t *testing.T) {
+		origin := &events.Origin{Key: "scheduledEvents:1"}
+		record := newDelivery(origin, "story.payout_soon", "user", "slack")
+		if record == nil {
+			t.Fatal("expected a delivery record")
+		}
+		other := newDelivery(&events.Origin{Key: "scheduledEvents:2"}, "story.payout_soon", "user", "slack")
+		if record.Key == other.Key {
+			t.Errorf("expected different keys, got %v", record.Key)
+		}
+		if again := newDelivery(origin, "story.payout_soon", "user", "slack"); again.Key != record.Key {
+			t.Errorf("expected key %v, got %v", record.Key, again.Key)
+		}
+	})
+
+	t.Run("events without origin are not deduplicated", func(t *testing.T) {
+		if record := newDelivery(&events.Origin{}, "story.voted", "user", "slack"); record != nil {
+			t.Errorf("expected no delivery record, got %v", record.Key)
+		}
+	})
+}
@@ -0,0 +1,419 @@
+package notifications
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/tomb.v2"
+)
+
+const (
+	DefaultDispatchQueueSize     = 1000
+	DefaultNotifierConcurrency   = 10
+	DefaultDispatchStatsInterval = 1 * time.Minute
+)
+
+// SetDispatchQueueSize sets the number of notifications that can be waiting
+// to be dispatched using a single notifier. Block processing is blocked
+// until there is space in the queue again.
+func SetDispatchQueueSize(size uint) Option {
+	return func(processor *BlockProcessor) {
+		processor.dispatchQueueSize = size
+	}
+}
+
+// SetNotifierConcurrency sets the number of notifications
+// that can be dispatched using a single notifier concurrently.
+//
+// In case notifierId is empty, the limit is used for all notifiers
+// that don't have their own limit set.
+func SetNotifierConcurrency(notifierId string, limit uint) Option {
+	return func(processor *BlockProcessor) {
+		if processor.notifierConcurrency == nil {
+			processor.notifierConcurrency = make(map[string]uint)
+		}
+		processor.notifierConcurrency[notifierId] = limit
+	}
+}
+
+func SetDispatchStatsInterval(interval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.dispatchStatsInterval = interval
+	}
+}
+
+type dispatchJob struct {
+	userId   string
+	settings bson.Raw
+	dispatch func(Notifier, bson.Raw) error
+
+	// delivery is recorded once the job succeeds, nil when not applicable.
+	delivery *delivery
+
+	// block is the block the event was mined from, or the entry tracking
+	// the event not mined from a block. Nil when not being tracked.
+	block *pendingBlock
+
+	// logger carries the correlation ID of the event being dispatched.
+	logger *logrus.Entry
+}
+
+// dispatchLane is a bounded queue and a fixed number of workers for a single notifier,
+// so that a stuck notifier cannot affect the others until its queue is full.
+type dispatchLane struct {
+	notifierId string
+	notifier   Notifier
+	queue      chan *dispatchJob
+	numWorkers uint
+	numBusy    int32
+	deliveries *deliveryLog
+	inFlight   *sync.WaitGroup
+}
+
+func (lane *dispatchLane) worker(dying <-chan struct{}) error {
+	for {
+		select {
+		case job := <-lane.queue:
+			atomic.AddInt32(&lane.numBusy, 1)
+			lane.process(job)
+			atomic.AddInt32(&lane.numBusy, -1)
+
+		case <-dying:
+			return nil
+		}
+	}
+}
+
+func (lane *dispatchLane) process(job *dispatchJob) {
+	defer lane.inFlight.Done()
+
+	failed := true
+	defer func() {
+		job.block.Done(failed)
+	}()
+
+	record := job.delivery
+	logger := job.logger.WithField("notifier", lane.notifierId)
+
+	// Skip the job in case it has been delivered already.
+	// When the delivery log is not available, rather risk a duplicate.
+	if record != nil {
+		delivered, err := lane.deliveries.Delivered(record.Key)
+		if err != nil {
+			logger.WithError(err).Warn("failed to check delivery log")
+		}
+		if delivered {
+			failed = false
+			return
+		}
+	}
+
+	start := time.Now()
+	err := job.dispatch(lane.notifier, job.settings)
+	observeDuration(dispatchDuration.WithLabelValues(lane.notifierId), start)
+	if err != nil {
+		notificationsDispatched.WithLabelValues(lane.notifierId, "failure").Inc()
+		logger.WithError(err).Error("failed to dispatch notification")
+		return
+	}
+	notificationsDispatched.WithLabelValues(lane.notifierId, "success").Inc()
+	failed = false
+	logger.WithField("duration", time.Since(start)).Debug("notification dispatched")
+
+	if record != nil {
+		if err := lane.deliveries.Record(record); err != nil {
+			logger.WithError(err).Warn("failed to record delivery")
+		}
+	}
+}
+
+// pendingBlock counts the notifications being dispatched for a block,
+// so that the block is only acknowledged once they are all dispatched.
+//
+// The keys of the deliveries planned for the block are collected as well,
+// these are needed to tell what changed when a block is replaced due to a fork.
+type pendingBlock struct {
+	refs    int
+	pending sync.WaitGroup
+	failed  int32
+
+	planned     map[string]struct{}
+	plannedLock sync.Mutex
+}
+
+// Add registers a notification to be dispatched. Nil receiver is a no-op.
+func (block *pendingBlock) Add() {
+	if block != nil {
+		block.pending.Add(1)
+	}
+}
+
+// Plan records the delivery planned for the block. Nil receiver or record is a no-op.
+func (block *pendingBlock) Plan(record *delivery) {
+	if block == nil || record == nil {
+		return
+	}
+
+	block.plannedLock.Lock()
+	defer block.plannedLock.Unlock()
+	if block.planned == nil {
+		block.planned = make(map[string]struct{})
+	}
+	block.planned[record.Key] = struct{}{}
+}
+
+// Planned returns the keys of the deliveries planned for the block.
+func (block *pendingBlock) Planned() map[string]struct{} {
+	block.plannedLock.Lock()
+	defer block.plannedLock.Unlock()
+
+	planned := make(map[string]struct{}, len(block.planned))
+	for key := range block.planned {
+		planned[key] = struct{}{}
+	}
+	return planned
+}
+
+// Done marks a notification as dispatched. Nil receiver is a no-op.
+func (block *pendingBlock) Done(failed bool) {
+	if block == nil {
+		return
+	}
+	if failed {
+		atomic.AddInt32(&block.failed, 1)
+	}
+	block.pending.Done()
+}
+
+// Failed returns the number of notifications that could not be dispatched.
+func (block *pendingBlock) Failed() int {
+	return int(atomic.LoadInt32(&block.failed))
+}
+
+// ResetFailed resets the number of notifications that could not be dispatched.
+// It is used when the block is processed again, the notifications are retried then.
+func (block *pendingBlock) ResetFailed() {
+	atomic.StoreInt32(&block.failed, 0)
+}
+
+// Wait blocks until all the notifications are dispatched.
+// tomb.ErrDying is returned in case dying is closed first.
+func (block *pendingBlock) Wait(dying <-chan struct{}) error {
+	done := make(chan struct{})
+	go func() {
+		block.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-dying:
+		return tomb.ErrDying
+	}
+}
+
+// blockKey returns the key the block is tracked by while being processed.
+func blockKey(blockNum uint32) string {
+	return strconv.FormatUint(uint64(blockNum), 10)
+}
+
+// originKey returns the key the notifications for the event are tracked by,
+// i.e. the block the event was mined from or the explicit key of the event.
+// An empty string is returned when the event has neither.
+func originKey(origin *events.Origin) string {
+	switch {
+	case origin.Key != "":
+		return origin.Key
+	case origin.BlockNum != 0:
+		return blockKey(origin.BlockNum)
+	default:
+		return ""
+	}
+}
+
+// pendingBlocks keeps track of the blocks being processed by the workers
+// and of the events not mined from a block being dispatched, see originKey.
+type pendingBlocks struct {
+	blocks map[string]*pendingBlock
+	lock   sync.Mutex
+}
+
+func newPendingBlocks() *pendingBlocks {
+	return &pendingBlocks{
+		blocks: make(map[string]*pendingBlock),
+	}
+}
+
+// Begin starts tracking the block. The same block can be processed more than once
+// at the same time in case it replaces an orphaned block, hence the reference counting.
+func (blocks *pendingBlocks) Begin(key string) *pendingBlock {
+	blocks.lock.Lock()
+	defer blocks.lock.Unlock()
+
+	block, ok := blocks.blocks[key]
+	if !ok {
+		block = &pendingBlock{}
+		blocks.blocks[key] = block
+	}
+	block.refs++
+	return block
+}
+
+// End stops tracking the block.
+func (blocks *pendingBlocks) End(key string) {
+	blocks.lock.Lock()
+	defer blocks.lock.Unlock()
+
+	if block, ok := blocks.blocks[key]; ok {
+		block.refs--
+		if block.refs == 0 {
+			delete(blocks.blocks, key)
+		}
+	}
+}
+
+// Add registers a notification to be dispatched for the given block.
+// Nil is returned in case the block is not being tracked.
+func (blocks *pendingBlocks) Add(key string) *pendingBlock {
+	if key == "" {
+		return nil
+	}
+
+	blocks.lock.Lock()
+	defer blocks.lock.Unlock()
+
+	block, ok := blocks.blocks[key]
+	if !ok {
+		return nil
+	}
+	block.Add()
+	return block
+}
+
+// DispatchStats describe the state of the dispatch queue for a single notifier.
+type DispatchStats struct {
+	NotifierId string `json:"notifierId"`
+	Queued     int    `json:"queued"`
+	Capacity   int    `json:"capacity"`
+	Busy       int    `json:"busy"`
+	Workers    int    `json:"workers"`
+}
+
+type dispatchPool struct {
+	lanes  map[string]*dispatchLane
+	logger *logrus.Entry
+	t      *tomb.Tomb
+}
+
+func newDispatchPool(
+	notifiers map[string]Notifier,
+	queueSize uint,
+	concurrency map[string]uint,
+	deliveries *deliveryLog,
+	inFlight *sync.WaitGroup,
+	logger *logrus.Entry,
+	t *tomb.Tomb,
+) *dispatchPool {
+
+	lanes := make(map[string]*dispatchLane, len(notifiers))
+	for id, notifier := range notifiers {
+		numWorkers, ok := concurrency[id]
+		if !ok {
+			numWorkers, ok = concurrency[""]
+			if !ok {
+				numWorkers = DefaultNotifierConcurrency
+			}
+		}
+		if numWorkers == 0 {
+			numWorkers = 1
+		}
+
+		lane := &dispatchLane{
+			notifierId: id,
+			notifier:   notifier,
+			queue:      make(chan *dispatchJob, queueSize),
+			numWorkers: numWorkers,
+			deliveries: deliveries,
+			inFlight:   inFlight,
+		}
+		for i := uint(0); i < numWorkers; i++ {
+			t.Go(func() error {
+				return lane.worker(t.Dying())
+			})
+		}
+		lanes[id] = lane
+	}
+
+	return &dispatchPool{lanes, logger, t}
+}
+
+// Enqueue adds the job to the queue associated with the given notifier.
+// It blocks while the queue is full. False is returned in case
+// the notifier is unknown or the pool is being terminated.
+func (pool *dispatchPool) Enqueue(notifierId string, job *dispatchJob) bool {
+	lane, ok := pool.lanes[notifierId]
+	if !ok {
+		job.logger.WithField("notifier", notifierId).Error("notifier not found")
+		job.block.Done(true)
+		return false
+	}
+
+	lane.inFlight.Add(1)
+	select {
+	case lane.queue <- job:
+		return true
+	case <-pool.t.Dying():
+		lane.inFlight.Done()
+		job.block.Done(true)
+		return false
+	}
+}
+
+// Stats returns the current queue stats, sorted by notifier ID.
+func (pool *dispatchPool) Stats() []*DispatchStats {
+	stats := make([]*DispatchStats, 0, len(pool.lanes))
+	for _, lane := range pool.lanes {
+		stats = append(stats, &DispatchStats{
+			NotifierId: lane.notifierId,
+			Queued:     len(lane.queue),
+			Capacity:   cap(lane.queue),
+			Busy:       int(atomic.LoadInt32(&lane.numBusy)),
+			Workers:    int(lane.numWorkers),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].NotifierId < stats[j].NotifierId
+	})
+	return stats
+}
+
+// reporter logs the queue stats periodically, but only when there is something queued.
+func (pool *dispatchPool) reporter(interval time.Duration) error {
+	for {
+		select {
+		case <-time.After(interval):
+			for _, stats := range pool.Stats() {
+				if stats.Queued == 0 {
+					continue
+				}
+				pool.logger.WithFields(logrus.Fields{
+					"notifier": stats.NotifierId,
+					"queued":   stats.Queued,
+					"capacity": stats.Capacity,
+					"busy":     stats.Busy,
+					"workers":  stats.Workers,
+				}).Info("dispatch queue not empty")
+			}
+		case <-pool.t.Dying():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package notifications
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/tomb.v2"
+)
+
+func TestPendingBlocks(t *testing.T) {
+	testCases := []struct {
+		name    string
+		results []bool
+		failed  int
+	}{
+		{"no notifications", nil, 0},
+		{"all dispatched", []bool{false, false, false}, 0},
+		{"some failed", []bool{false, true, false, true}, 2},
+		{"all failed", []bool{true, true}, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			blocks := newPendingBlocks()
+			block := blocks.Begin("100")
+			defer blocks.End("100")
+
+			for range tc.results {
+				blocks.Add("100")
+			}
+			for _, failed := range tc.results {
+				go block.Done(failed)
+			}
+
+			if err := block.Wait(nil); err != nil {
+				t.Fatal(err)
+			}
+			if failed := block.Failed(); failed != tc.failed {
+				t.Errorf("expected %v failed, got %v", tc.failed, failed)
+			}
+		})
+	}
+}
+
+func TestPendingBlocks_WaitForDispatch(t *testing.T) {
+	blocks := newPendingBlocks()
+	block := blocks.Begin("100")
+	defer blocks.End("100")
+
+	blocks.Add("100")
+
+	acked := make(chan struct{})
+	go func() {
+		block.Wait(nil)
+		close(acked)
+	}()
+
+	select {
+	case <-acked:
+		t.Fatal("block acknowledged before the notification was dispatched")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	block.Done(false)
+
+	select {
+	case <-acked:
+	case <-time.After(time.Second):
+		t.Fatal("block not acknowledged after the notification was dispatched")
+	}
+}
+
+func TestPendingBlocks_Dying(t *testing.T) {
+	blocks := newPendingBlocks()
+	block := blocks.Begin("100")
+	defer blocks.End("100")
+
+	blocks.Add("100")
+
+	dying := make(chan struct{})
+	close(dying)
+	if err := block.Wait(dying); err != tomb.ErrDying {
+		t.Errorf("expected %v, got %v", tomb.ErrDying, err)
+	}
+	block.Done(false)
+}
+
+func TestPendingBlocks_ResetFailed(t *testing.T) {
+	blocks := newPendingBlocks()
+	block := blocks.Begin("100")
+	defer blocks.End("100")
+
+	blocks.Add("100").Done(true)
+	if err := block.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block is processed again, only the new results count.
+	block.ResetFailed()
+	blocks.Add("100").Done(false)
+	if err := block.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+	if failed := block.Failed(); failed != 0 {
+		t.Errorf("expected 0 failed, got %v", failed)
+	}
+}
+
+func TestPendingBlocks_Tracking(t *testing.T) {
+	blocks := newPendingBlocks()
+
+	if block := blocks.Add("100"); block != nil {
+		t.Error("expected blocks not being processed not to be tracked")
+	}
+
+	// The same block is being processed twice.
+	first := blocks.Begin("100")
+	second := blocks.Begin("100")
+	if first != second {
+		t.Error("expected the same block to be tracked once")
+	}
+
+	blocks.End("100")
+	if block := blocks.Add("100"); block != first {
+		t.Error("expected the block to be tracked until all workers are done")
+	} else {
+		block.Done(false)
+	}
+
+	blocks.End("100")
+	if block := blocks.Add("100"); block != nil {
+		t.Error("expected the block not to be tracked any more")
+	}
+}
+
+func TestPendingBlock_Planned(t *testing.T) {
+	var (
+		blocks = newPendingBlocks()
+		block  = blocks.Begin("100")
+		origin = &events.Origin{BlockNum: 100, TrxNum: 1, OpNum: 2}
+	)
+	defer blocks.End("100")
+
+	block.Plan(newDelivery(origin, "story.voted", "alice", "slack"))
+	block.Plan(newDelivery(origin, "story.voted", "bob", "slack"))
+	block.Plan(newDelivery(origin, "story.voted", "alice", "slack"))
+	block.Plan(nil)
+
+	planned := block.Planned()
+	if len(planned) != 2 {
+		t.Fatalf("expected 2 deliveries planned, got %v", planned)
+	}
+	for _, userId := range []string{"alice", "bob"} {
+		if _, ok := planned[newDelivery(origin, "story.voted", userId, "slack").Key]; !ok {
+			t.Errorf("expected the delivery for %v to be planned", userId)
+		}
+	}
+
+	// Nil receiver is a no-op, i.e. untracked events are not planned.
+	var untracked *pendingBlock
+	untracked.Plan(newDelivery(origin, "story.voted", "alice", "slack"))
+}
+
+func TestOriginKey(t *testing.T) {
+	testCases := []struct {
+		name   string
+		origin *events.Origin
+		key    string
+	}{
+		{"mined from a block", &events.Origin{BlockNum: 100, TrxNum: 1, OpNum: 2}, "100"},
+		{"explicit key", &events.Origin{Key: "scheduledEvents:1"}, "scheduledEvents:1"},
+		{"no origin", &events.Origin{}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if key := originKey(tc.origin); key != tc.key {
+				t.Errorf("expected %q, got %q", tc.key, key)
+			}
+		})
+	}
+
+	// Events without origin are never tracked.
+	blocks := newPendingBlocks()
+	blocks.Begin("")
+	if block := blocks.Add(originKey(&events.Origin{})); block != nil {
+		t.Error("expected events without origin not to be tracked")
+	}
+}
+
+func TestDispatchLane_Process(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		failed int
+	}{
+		{"dispatched", nil, 0},
+		{"failed", errors.New("notifier unavailable"), 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var inFlight sync.WaitGroup
+			lane := &dispatchLane{
+				notifierId: "test",
+				inFlight:   &inFlight,
+			}
+
+			blocks := newPendingBlocks()
+			block := blocks.Begin("100")
+			defer blocks.End("100")
+
+			inFlight.Add(1)
+			lane.process(&dispatchJob{
+				userId: "user",
+				dispatch: func(Notifier, bson.Raw) error {
+					return tc.err
+				},
+				block:  blocks.Add("100"),
+				logger: newTestLogger(),
+			})
+
+			if err := block.Wait(nil); err != nil {
+				t.Fatal(err)
+			}
+			if failed := block.Failed(); failed != tc.failed {
+				t.Errorf("expected %v failed, got %v", tc.failed, failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package events
+
+import "fmt"
+
+// Account metrics that can be watched using thresholds.
+const (
+	// MetricVotingPower is the current voting power in percent.
+	MetricVotingPower = "voting_power"
+	// MetricResourceCredits is the current amount of resource credits in percent of the maximum.
+	MetricResourceCredits = "resource_credits"
+	// MetricBalance is the liquid balance of the core asset, e.g. STEEM.
+	MetricBalance = "balance"
+)
+
+// AccountThresholdCrossed is emitted when a watched account metric drops below
+// the threshold set by the user.
+//
+// The event is not mined from a block, it is emitted by the account poller.
+// Origin only carries the time the value was observed.
+type AccountThresholdCrossed struct {
+	Account   string
+	Metric    string
+	Threshold float64
+	Value     float64
+
+	Origin
+}
+
+// MetricName returns the human-readable name of the metric.
+func (event *AccountThresholdCrossed) MetricName() string {
+	switch event.Metric {
+	case MetricVotingPower:
+		return "voting power"
+	case MetricResourceCredits:
+		return "resource credits"
+	case MetricBalance:
+		return "liquid balance"
+	default:
+		return event.Metric
+	}
+}
+
+// FormattedValue returns the current value including the unit, e.g. 79.52% or 1.000 STEEM.
+// The legacy core symbol is used for balances, the notifiers map it to the symbol of the chain.
+func (event *AccountThresholdCrossed) FormattedValue() string {
+	return formatMetric(event.Metric, event.Value)
+}
+
+// FormattedThreshold returns the threshold the same way FormattedValue does.
+func (event *AccountThresholdCrossed) FormattedThreshold() string {
+	return formatMetric(event.Metric, event.Threshold)
+}
+
+func formatMetric(metric string, value float64) string {
+	if metric == MetricBalance {
+		return fmt.Sprintf("%.3f STEEM", value)
+	}
+	return fmt.Sprintf("%.2f%%", value)
+}
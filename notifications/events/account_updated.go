@@ -7,6 +7,8 @@ import (
 
 type AccountUpdated struct {
 	Op *types.AccountUpdateOperation
+
+	Origin
 }
 
 type AccountUpdatedEventMiner struct{}
@@ -24,5 +26,5 @@ func (miner *AccountUpdatedEventMiner) MineEvent(
 	if !ok {
 		return nil, nil
 	}
-	return []interface{}{&AccountUpdated{op}}, nil
+	return []interface{}{&AccountUpdated{Op: op}}, nil
 }
@@ -7,6 +7,8 @@ import (
 
 type AccountWitnessVoted struct {
 	Op *types.AccountWitnessVoteOperation
+
+	Origin
 }
 
 type AccountWitnessVotedEventMiner struct{}
@@ -24,5 +26,5 @@ func (miner *AccountWitnessVotedEventMiner) MineEvent(
 	if !ok {
 		return nil, nil
 	}
-	return []interface{}{&AccountWitnessVoted{op}}, nil
+	return []interface{}{&AccountWitnessVoted{Op: op}}, nil
 }
@@ -0,0 +1,16 @@
+package events
+
+// BlockOrphaned is emitted when a block that was processed before becoming
+// irreversible was replaced by a different block due to a chain fork.
+//
+// The notifications sent for the orphaned block that the canonical block
+// did not produce again are not valid any more, so the users that received
+// any are notified about the fact.
+type BlockOrphaned struct {
+	BlockNum uint32
+
+	// Kinds lists the event kinds of the notifications no longer valid.
+	Kinds []string
+	// Count is the number of notifications no longer valid.
+	Count int
+}
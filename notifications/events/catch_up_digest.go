@@ -0,0 +1,44 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CatchUpDigest summarizes the events a user was not notified about
+// one by one because they happened while SteemWatch was catching up.
+type CatchUpDigest struct {
+	// From and To delimit the time range the events happened in.
+	From time.Time
+	To   time.Time
+
+	// Counts maps event kinds to the number of events of the given kind.
+	Counts map[string]int
+
+	Origin
+}
+
+// Total returns the total number of events in the digest.
+func (digest *CatchUpDigest) Total() int {
+	var total int
+	for _, n := range digest.Counts {
+		total += n
+	}
+	return total
+}
+
+// Summary returns the event counts as "kind: count" lines sorted by kind.
+func (digest *CatchUpDigest) Summary() []string {
+	kinds := make([]string, 0, len(digest.Counts))
+	for kind := range digest.Counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	lines := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		lines = append(lines, fmt.Sprintf("%v: %v", kind, digest.Counts[kind]))
+	}
+	return lines
+}
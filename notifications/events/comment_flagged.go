@@ -0,0 +1,51 @@
+package events
+
+import (
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// CommentFlagged is emitted when a comment is downvoted, i.e. the vote weight is negative,
+// or when a flag is removed from a comment or replaced by another vote.
+type CommentFlagged struct {
+	Op      *types.VoteOperation
+	Content *database.Content
+
+	// Value is the estimated payout value of the flag, e.g. -0.123 SBD.
+	// It is empty in case the value could not be estimated.
+	Value string
+
+	// Removed is set when the voter removed the flag or replaced it by another vote.
+	Removed bool
+
+	Origin
+}
+
+type CommentFlaggedEventMiner struct{}
+
+func NewCommentFlaggedEventMiner() *CommentFlaggedEventMiner {
+	return &CommentFlaggedEventMiner{}
+}
+
+func (miner *CommentFlaggedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content,
+) ([]interface{}, error) {
+
+	if content.IsStory() {
+		return nil, nil
+	}
+
+	op, ok := operation.Data().(*types.VoteOperation)
+	if !ok {
+		return nil, nil
+	}
+
+	// Removed flags cannot be told apart from removed votes here,
+	// the vote weight being 0 in both cases. These are handled together with CommentVoted.
+	if op.Weight >= 0 {
+		return nil, nil
+	}
+
+	return []interface{}{&CommentFlagged{Op: op, Content: content}}, nil
+}
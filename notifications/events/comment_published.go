@@ -1,6 +1,8 @@
 package events
 
 import (
+	"strings"
+
 	"github.com/go-steem/rpc/apis/database"
 	"github.com/go-steem/rpc/types"
 )
@@ -8,6 +10,25 @@ import (
 type CommentPublished struct {
 	Op      *types.CommentOperation
 	Content *database.Content
+
+	Origin
+}
+
+// RootPost returns the story the comment belongs to.
+//
+// The story is extracted from the content URL, which has the form of
+// /category/@rootAuthor/rootPermlink#@author/permlink for comments.
+func (event *CommentPublished) RootPost() (author, permlink, url string, ok bool) {
+	url = event.Content.URL
+	if i := strings.Index(url, "#"); i != -1 {
+		url = url[:i]
+	}
+
+	parts := strings.Split(url, "/")
+	if len(parts) != 4 || !strings.HasPrefix(parts[2], "@") {
+		return "", "", "", false
+	}
+	return parts[2][1:], parts[3], url, true
 }
 
 type CommentPublishedEventMiner struct{}
@@ -30,5 +51,5 @@ func (miner *CommentPublishedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&CommentPublished{op, content}}, nil
+	return []interface{}{&CommentPublished{Op: op, Content: content}}, nil
 }
@@ -0,0 +1,29 @@
+package events
+
+import (
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// CommentThreadReply is emitted when a comment is posted to a thread watched by the user.
+//
+// There is no miner for this event, it is derived from CommentPublished
+// when the thread the comment belongs to is being watched.
+type CommentThreadReply struct {
+	Op      *types.CommentOperation
+	Content *database.Content
+
+	RootAuthor   string
+	RootPermlink string
+
+	Origin
+}
+
+// Root returns the story the thread belongs to, filled in just enough to build its URL.
+func (event *CommentThreadReply) Root() *database.Content {
+	return &database.Content{
+		Author:   event.RootAuthor,
+		Permlink: event.RootPermlink,
+		Category: event.Content.Category,
+	}
+}
@@ -8,6 +8,15 @@ import (
 type CommentVoted struct {
 	Op      *types.VoteOperation
 	Content *database.Content
+
+	// Value is the estimated payout value of the vote, e.g. 0.123 SBD.
+	// It is empty in case the value could not be estimated.
+	Value string
+
+	// Removed is set when the voter removed the vote, i.e. the vote weight is 0.
+	Removed bool
+
+	Origin
 }
 
 type CommentVotedEventMiner struct{}
@@ -30,5 +39,5 @@ func (miner *CommentVotedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&CommentVoted{op, content}}, nil
+	return []interface{}{&CommentVoted{Op: op, Content: content, Removed: op.Weight == 0}}, nil
 }
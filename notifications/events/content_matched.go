@@ -0,0 +1,56 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// ContentMatched is emitted for every story or comment published.
+// Edits are not matched again, see IsEdit.
+//
+// The keywords and patterns matched are user-specific, so Matches is only
+// filled in right before the event is dispatched to a particular user.
+type ContentMatched struct {
+	Op      *types.CommentOperation
+	Content *database.Content
+	Matches []string
+
+	Origin
+}
+
+type ContentMatchedEventMiner struct{}
+
+func NewContentMatchedEventMiner() *ContentMatchedEventMiner {
+	return &ContentMatchedEventMiner{}
+}
+
+func (miner *ContentMatchedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content,
+) ([]interface{}, error) {
+
+	op, ok := operation.Data().(*types.CommentOperation)
+	if !ok {
+		return nil, nil
+	}
+
+	// Edits carrying a patch cannot be new content.
+	if strings.HasPrefix(op.Body, "@@ ") {
+		return nil, nil
+	}
+
+	return []interface{}{&ContentMatched{Op: op, Content: content}}, nil
+}
+
+// IsEdit returns true in case the content existed before the operation,
+// i.e. the story or the comment was edited by publishing the whole text again.
+// The origin must be set for the edits to be recognized.
+func (event *ContentMatched) IsEdit() bool {
+	created := event.Content.Created
+	if created == nil || created.Time == nil || event.Timestamp.IsZero() {
+		return false
+	}
+	return created.Time.Before(event.Timestamp)
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+// Origin identifies the operation an event was mined from.
+//
+// All events embed Origin. It is filled in by the block processor,
+// the event miners don't need to care about it.
+type Origin struct {
+	BlockNum  uint32
+	TrxNum    int
+	OpNum     int
+	Timestamp time.Time
+
+	// Delayed is set when the event is being delivered
+	// long after it happened, e.g. when catching up after downtime.
+	Delayed bool
+
+	// Key identifies the events not mined from a block, e.g. the scheduled event
+	// the event was fired for. It is used instead of the block position
+	// to track and deduplicate the notifications sent for the event.
+	Key string
+}
+
+// EventOrigin returns the origin of the event embedding Origin.
+func (origin *Origin) EventOrigin() *Origin {
+	return origin
+}
+
+// IsDelayed returns true when the event is being delivered late.
+// It is safe to call IsDelayed on nil.
+func (origin *Origin) IsDelayed() bool {
+	return origin != nil && origin.Delayed
+}
+
+// CorrelationId identifies the operation in the logs,
+// from mining the event all the way to the notifications being delivered.
+func (origin *Origin) CorrelationId() string {
+	if origin.Key != "" {
+		return origin.Key
+	}
+	return fmt.Sprintf("%v-%v-%v", origin.BlockNum, origin.TrxNum, origin.OpNum)
+}
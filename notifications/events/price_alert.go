@@ -0,0 +1,73 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+// Price alert kinds.
+const (
+	// PriceAbove means the price rose to or above Level.
+	PriceAbove = "above"
+	// PriceBelow means the price dropped to or below Level.
+	PriceBelow = "below"
+	// PriceMove means the price moved by at least Percent within Window.
+	PriceMove = "move"
+)
+
+// PriceAlert is emitted when the median price feed crosses a level
+// or moves by more than the given percentage within the given window.
+//
+// The prices are in the dollar asset per the core asset, e.g. SBD per STEEM.
+// The event is not mined from a block, Origin only carries the time the price was observed.
+type PriceAlert struct {
+	Kind string
+
+	// Level is set for PriceAbove and PriceBelow.
+	Level float64
+
+	// Percent and Window are set for PriceMove, Change is the actual move in percent.
+	Percent float64
+	Window  time.Duration
+	Change  float64
+
+	Price         float64
+	PreviousPrice float64
+
+	Origin
+}
+
+// Describe returns a short description of what happened, prices formatted using formatPrice.
+func (event *PriceAlert) Describe(formatPrice func(float64) string) string {
+	switch event.Kind {
+	case PriceAbove:
+		return fmt.Sprintf("The median price rose above %v.", formatPrice(event.Level))
+	case PriceBelow:
+		return fmt.Sprintf("The median price dropped below %v.", formatPrice(event.Level))
+	default:
+		direction := "rose"
+		if event.Change < 0 {
+			direction = "dropped"
+		}
+		return fmt.Sprintf("The median price %v by %.2f%% within %v.", direction, abs(event.Change), formatWindow(event.Window))
+	}
+}
+
+// formatWindow formats the window the way it is usually written, e.g. 1h or 30m.
+func formatWindow(window time.Duration) string {
+	switch {
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%dm", window/time.Minute)
+	default:
+		return window.String()
+	}
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
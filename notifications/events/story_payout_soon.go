@@ -0,0 +1,34 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+// StoryPayoutSoon is emitted shortly before a story by a watched author pays out.
+//
+// The event is not mined from a block, it is fired by the scheduler.
+// Content is fetched again at that time, so the pending payout is current.
+type StoryPayoutSoon struct {
+	Content     *database.Content
+	CashoutTime time.Time
+
+	Origin
+}
+
+// TimeLeft returns the time remaining until the payout, rounded to minutes.
+func (event *StoryPayoutSoon) TimeLeft() time.Duration {
+	left := event.CashoutTime.Sub(event.Timestamp)
+	if left < 0 {
+		return 0
+	}
+	return left.Round(time.Minute)
+}
+
+// FormattedTimeLeft returns the time remaining until the payout, e.g. 11h 59m.
+func (event *StoryPayoutSoon) FormattedTimeLeft() string {
+	left := event.TimeLeft()
+	return fmt.Sprintf("%dh %02dm", int(left.Hours()), int(left.Minutes())%60)
+}
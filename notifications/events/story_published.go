@@ -8,6 +8,8 @@ import (
 type StoryPublished struct {
 	Op      *types.CommentOperation
 	Content *database.Content
+
+	Origin
 }
 
 type StoryPublishedEventMiner struct{}
@@ -30,5 +32,5 @@ func (miner *StoryPublishedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&StoryPublished{op, content}}, nil
+	return []interface{}{&StoryPublished{Op: op, Content: content}}, nil
 }
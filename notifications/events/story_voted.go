@@ -8,6 +8,15 @@ import (
 type StoryVoted struct {
 	Op      *types.VoteOperation
 	Content *database.Content
+
+	// Value is the estimated payout value of the vote, e.g. 0.123 SBD.
+	// It is empty in case the value could not be estimated.
+	Value string
+
+	// Removed is set when the voter removed the vote, i.e. the vote weight is 0.
+	Removed bool
+
+	Origin
 }
 
 type StoryVotedEventMiner struct{}
@@ -30,5 +39,5 @@ func (miner *StoryVotedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&StoryVoted{op, content}}, nil
+	return []interface{}{&StoryVoted{Op: op, Content: content, Removed: op.Weight == 0}}, nil
 }
@@ -7,6 +7,8 @@ import (
 
 type TransferMade struct {
 	Op *types.TransferOperation
+
+	Origin
 }
 
 type TransferMadeEventMiner struct{}
@@ -24,5 +26,5 @@ func (miner *TransferMadeEventMiner) MineEvent(
 	if !ok {
 		return nil, nil
 	}
-	return []interface{}{&TransferMade{op}}, nil
+	return []interface{}{&TransferMade{Op: op}}, nil
 }
@@ -7,6 +7,8 @@ import (
 
 type UserFollowStatusChanged struct {
 	Op *types.FollowOperation
+
+	Origin
 }
 
 func (event *UserFollowStatusChanged) Followed() bool {
@@ -42,5 +44,5 @@ func (miner *UserFollowStatusChangedEventMiner) MineEvent(
 		return nil, err
 	}
 
-	return []interface{}{&UserFollowStatusChanged{data.(*types.FollowOperation)}}, nil
+	return []interface{}{&UserFollowStatusChanged{Op: data.(*types.FollowOperation)}}, nil
 }
@@ -11,6 +11,8 @@ type UserMentioned struct {
 	Op      *types.CommentOperation
 	Content *database.Content
 	User    string
+
+	Origin
 }
 
 type UserMentionedEventMiner struct {
@@ -37,7 +39,7 @@ func (miner *UserMentionedEventMiner) MineEvent(
 
 	events := make([]interface{}, 0, len(match))
 	for _, m := range match {
-		events = append(events, &UserMentioned{op, content, m[1]})
+		events = append(events, &UserMentioned{Op: op, Content: content, User: m[1]})
 	}
 	return events, nil
 }
@@ -0,0 +1,458 @@
+package notifications
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrOperationNotFound = errors.New("operation not found")
+
+// Explanation describes how a single operation was handled for a single user.
+type Explanation struct {
+	BlockNum uint32              `json:"blockNumber"`
+	TrxNum   int                 `json:"transactionIndex"`
+	OpNum    int                 `json:"operationIndex"`
+	OpType   string              `json:"operationType"`
+	Events   []*EventExplanation `json:"events"`
+}
+
+// EventExplanation describes whether the user was notified about an event and why.
+type EventExplanation struct {
+	Kind      string   `json:"kind"`
+	Notified  bool     `json:"notified"`
+	Reasons   []string `json:"reasons"`
+	Notifiers []string `json:"notifiers"`
+}
+
+// Explainer runs operations through the same miners and matching logic
+// the block processor uses, collecting the reasons for every decision made.
+//
+// The user settings are loaded from the database directly,
+// so the current settings are used, not the ones valid at the time the block was processed.
+// The same applies to the content associated with the operation.
+type Explainer struct {
+	client      *rpc.Client
+	caller      interfaces.Caller
+	db          *mgo.Database
+	eventMiners map[types.OpType][]EventMiner
+	logger      *logrus.Entry
+}
+
+func NewExplainer(cc interfaces.CallCloser, db *mgo.Database, logger *logrus.Entry) (*Explainer, error) {
+	client, err := rpc.NewClient(cc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate the steemd RPC client")
+	}
+	return &Explainer{
+		client:      client,
+		caller:      cc,
+		db:          db,
+		eventMiners: newEventMiners(),
+		logger:      logger,
+	}, nil
+}
+
+// ExplainBlockOperation explains the operation with the given index within the block.
+// The operations are indexed across all the transactions contained in the block.
+// All the operations in the block are explained in case opNum is negative.
+func (explainer *Explainer) ExplainBlockOperation(
+	userId string,
+	blockNum uint32,
+	opNum int,
+) ([]*Explanation, error) {
+
+	block, err := explainer.client.Database.GetBlock(blockNum)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get block %v", blockNum)
+	}
+	if block == nil {
+		return nil, ErrOperationNotFound
+	}
+	block.Number = blockNum
+
+	var (
+		selected = make(map[*types.Transaction][]int)
+		i        int
+	)
+	for _, tx := range block.Transactions {
+		for j := range tx.Operations {
+			if opNum < 0 || opNum == i {
+				selected[tx] = append(selected[tx], j)
+			}
+			i++
+		}
+	}
+	if len(selected) == 0 {
+		return nil, ErrOperationNotFound
+	}
+
+	return explainer.explain(userId, block, func(tx *types.Transaction) []int {
+		return selected[tx]
+	})
+}
+
+// ExplainTransactionOperation explains the operation with the given index within the transaction.
+// All the operations in the transaction are explained in case opNum is negative.
+func (explainer *Explainer) ExplainTransactionOperation(
+	userId string,
+	trxId string,
+	opNum int,
+) ([]*Explanation, error) {
+
+	var trx struct {
+		BlockNum uint32 `json:"block_num"`
+		TrxNum   int    `json:"transaction_num"`
+	}
+	if err := explainer.caller.Call("get_transaction", []interface{}{trxId}, &trx); err != nil {
+		return nil, errors.Wrapf(err, "failed to get transaction %v", trxId)
+	}
+	if trx.BlockNum == 0 {
+		return nil, ErrOperationNotFound
+	}
+
+	block, err := explainer.client.Database.GetBlock(trx.BlockNum)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get block %v", trx.BlockNum)
+	}
+	if block == nil || trx.TrxNum >= len(block.Transactions) {
+		return nil, ErrOperationNotFound
+	}
+	block.Number = trx.BlockNum
+
+	tx := block.Transactions[trx.TrxNum]
+	if opNum >= len(tx.Operations) {
+		return nil, ErrOperationNotFound
+	}
+
+	return explainer.explain(userId, block, func(t *types.Transaction) []int {
+		if t != tx {
+			return nil
+		}
+		if opNum >= 0 {
+			return []int{opNum}
+		}
+		ops := make([]int, len(tx.Operations))
+		for i := range ops {
+			ops[i] = i
+		}
+		return ops
+	})
+}
+
+func (explainer *Explainer) explain(
+	userId string,
+	block *database.Block,
+	selectOps func(*types.Transaction) []int,
+) ([]*Explanation, error) {
+
+	user, err := explainer.loadUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var explanations []*Explanation
+	for trxNum, tx := range block.Transactions {
+		for _, opNum := range selectOps(tx) {
+			op := tx.Operations[opNum]
+
+			explanation := &Explanation{
+				BlockNum: block.Number,
+				TrxNum:   trxNum,
+				OpNum:    opNum,
+				OpType:   string(op.Type()),
+				Events:   []*EventExplanation{},
+			}
+			explanations = append(explanations, explanation)
+
+			miners, ok := explainer.eventMiners[op.Type()]
+			if !ok {
+				continue
+			}
+
+			content, err := getOperationContent(explainer.client, op)
+			if err != nil {
+				return nil, errors.Wrapf(err, "block %v", block.Number)
+			}
+
+			for _, eventMiner := range miners {
+				events, err := eventMiner.MineEvent(op, content)
+				if err != nil {
+					return nil, errors.Wrapf(err, "block %v", block.Number)
+				}
+				for _, event := range events {
+					setEventOrigin(event, block, trxNum, opNum)
+
+					e, err := explainer.explainEvent(user, event)
+					if err != nil {
+						return nil, err
+					}
+					explanation.Events = append(explanation.Events, e)
+				}
+			}
+		}
+	}
+	return explanations, nil
+}
+
+// explainedUser holds the settings of the user the operations are explained for.
+type explainedUser struct {
+	id            bson.ObjectId
+	subscriptions map[string]*Subscription
+	accounts      map[string]struct{}
+	muted         map[string]struct{}
+	notifiers     []string
+}
+
+func (explainer *Explainer) loadUser(userId string) (*explainedUser, error) {
+	user := &explainedUser{
+		id:            bson.ObjectIdHex(userId),
+		subscriptions: make(map[string]*Subscription),
+		accounts:      make(map[string]struct{}),
+		muted:         make(map[string]struct{}),
+	}
+
+	// Load event subscriptions.
+	iter := explainer.db.C("events").Find(bson.M{"ownerId": user.id}).Iter()
+	for {
+		var doc bson.M
+		if !iter.Next(&doc) {
+			break
+		}
+		if sub := newSubscription(doc); sub != nil {
+			user.subscriptions[sub.Kind] = sub
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errors.Wrapf(err, "failed to load event subscriptions for user %v", userId)
+	}
+
+	// Load enabled notifiers.
+	var notifier NotifierDoc
+	iter = explainer.db.C("notifiers").Find(bson.M{"ownerId": user.id, "enabled": true}).Iter()
+	for iter.Next(&notifier) {
+		user.notifiers = append(user.notifiers, notifier.NotifierId)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errors.Wrapf(err, "failed to load notifiers for user %v", userId)
+	}
+	sort.Strings(user.notifiers)
+
+	// Load the user profile.
+	var profile struct {
+		Accounts      []string `bson:"accounts"`
+		MutedAccounts []string `bson:"mutedAccounts"`
+	}
+	err := explainer.db.C("users").FindId(user.id).Select(bson.M{
+		"accounts":      1,
+		"mutedAccounts": 1,
+	}).One(&profile)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Wrapf(err, "failed to load user profile for user %v", userId)
+	}
+	for _, account := range profile.Accounts {
+		user.accounts[account] = struct{}{}
+	}
+	for _, account := range profile.MutedAccounts {
+		user.muted[account] = struct{}{}
+	}
+
+	return user, nil
+}
+
+func (explainer *Explainer) explainEvent(user *explainedUser, event interface{}) (*EventExplanation, error) {
+	var (
+		matched bool
+		reasons []string
+		kind    string
+	)
+
+	// Match the event the same way the block processor does.
+	if e, ok := event.(*events.ContentMatched); ok {
+		kind = "content.matched"
+		matched, reasons = explainer.explainContentMatched(user, e)
+	} else {
+		criteria := matchCriteria(event)
+		if criteria == nil {
+			return nil, errors.Errorf("unknown event type: %T", event)
+		}
+		kind = criteria.Kind
+		matched, reasons = explainCriteria(user.subscriptions[kind], criteria)
+	}
+
+	// Comments are also delivered to the users watching the thread, as thread replies.
+	if e, ok := event.(*events.CommentPublished); ok && !matched {
+		watching, reason, err := explainer.explainThreadWatch(user, e)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+		if watching {
+			kind = "comment.thread_reply"
+		}
+		matched = watching
+	}
+
+	explanation := &EventExplanation{
+		Kind:      kind,
+		Notifiers: []string{},
+	}
+
+	// Check the mute list.
+	if matched {
+		for _, actor := range eventActors(event) {
+			if _, ok := user.muted[actor]; ok {
+				reasons = append(reasons, fmt.Sprintf("@%v is on your mute list", actor))
+				matched = false
+			}
+		}
+	}
+
+	// Check the notifiers.
+	if matched {
+		if len(user.notifiers) == 0 {
+			reasons = append(reasons, "you have no notifiers enabled")
+		} else {
+			explanation.Notified = true
+			explanation.Notifiers = user.notifiers
+		}
+	}
+
+	if reasons == nil {
+		reasons = []string{}
+	}
+	explanation.Reasons = reasons
+	return explanation, nil
+}
+
+// explainCriteria follows subscriptionIndex.Match for a single subscription.
+func explainCriteria(sub *Subscription, criteria *Criteria) (bool, []string) {
+	if sub == nil {
+		return false, []string{
+			fmt.Sprintf("you are not subscribed to %v events", criteria.Kind),
+		}
+	}
+
+	var (
+		included bool
+		excluded bool
+		reasons  []string
+	)
+	for _, list := range sortedKeys(criteria.Include) {
+		values := criteria.Include[list]
+		if len(values) == 0 {
+			continue
+		}
+
+		var found []string
+		for _, value := range values {
+			if sub.Contains(list, value) {
+				found = append(found, value)
+			}
+		}
+		if len(found) != 0 {
+			included = true
+			reasons = append(reasons, fmt.Sprintf("%v list contains %v", list, strings.Join(found, ", ")))
+		} else {
+			reasons = append(reasons, fmt.Sprintf("%v list does not contain %v", list, strings.Join(values, ", ")))
+		}
+	}
+
+	for _, list := range sortedKeys(criteria.Exclude) {
+		var found []string
+		for _, value := range criteria.Exclude[list] {
+			if sub.Contains(list, value) {
+				found = append(found, value)
+			}
+		}
+		if len(found) != 0 {
+			excluded = true
+			reasons = append(reasons, fmt.Sprintf("%v list contains %v", list, strings.Join(found, ", ")))
+		}
+	}
+
+	return included && !excluded, reasons
+}
+
+func (explainer *Explainer) explainContentMatched(
+	user *explainedUser,
+	event *events.ContentMatched,
+) (bool, []string) {
+
+	sub := user.subscriptions["content.matched"]
+	if sub == nil {
+		return false, []string{"you are not subscribed to content.matched events"}
+	}
+	if event.IsEdit() {
+		return false, []string{"the content was edited, only newly published content is matched"}
+	}
+
+	text := event.Content.Title + "\n" + event.Content.Body
+	matches := newContentMatcher([]*Subscription{sub}, explainer.logger).Match(text)[user.id]
+	if len(matches) == 0 {
+		return false, []string{"the content does not contain any of your keywords or patterns"}
+	}
+	return true, []string{
+		fmt.Sprintf("the content matches %v", strings.Join(matches, ", ")),
+	}
+}
+
+// explainThreadWatch follows handleThreadReply for a single user.
+func (explainer *Explainer) explainThreadWatch(
+	user *explainedUser,
+	event *events.CommentPublished,
+) (bool, string, error) {
+
+	rootAuthor, rootPermlink, _, ok := event.RootPost()
+	if !ok {
+		return false, "", nil
+	}
+
+	query := bson.M{
+		"ownerId":      user.id,
+		"rootAuthor":   rootAuthor,
+		"rootPermlink": rootPermlink,
+		"expiresAt":    bson.M{"$gt": time.Now()},
+	}
+	n, err := explainer.db.C("threadWatches").Find(query).Count()
+	if err != nil {
+		return false, "", errors.Wrapf(err, "failed to get thread watches [query=%+v]", query)
+	}
+	if n == 0 {
+		return false, "", nil
+	}
+
+	if _, ok := user.accounts[event.Content.Author]; ok {
+		return false, fmt.Sprintf(
+			"you are watching thread @%v/%v, but the reply was posted by your own account",
+			rootAuthor, rootPermlink), nil
+	}
+	return true, fmt.Sprintf("you are watching thread @%v/%v", rootAuthor, rootPermlink), nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (explainer *Explainer) Close() error {
+	return explainer.client.Close()
+}
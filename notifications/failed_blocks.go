@@ -0,0 +1,216 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sourcegraph/jsonrpc2"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/tomb.v2"
+)
+
+const (
+	DefaultBlockMaxAttempts    = 5
+	DefaultBlockRetryMinDelay  = 1 * time.Second
+	DefaultBlockRetryMaxDelay  = 1 * time.Minute
+	failedBlocksCollectionName = "failedBlocks"
+)
+
+// SetBlockRetryPolicy sets how many times a block is processed before it is given up on
+// and how long to wait between the attempts. The delay doubles after every attempt.
+func SetBlockRetryPolicy(maxAttempts uint, minDelay, maxDelay time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.blockMaxAttempts = maxAttempts
+		processor.blockRetryMinDelay = minDelay
+		processor.blockRetryMaxDelay = maxDelay
+	}
+}
+
+// FailedBlock records a block that could not be processed.
+type FailedBlock struct {
+	BlockNum  uint32    `bson:"_id"`
+	Error     string    `bson:"error"`
+	Attempts  uint      `bson:"attempts"`
+	Transient bool      `bson:"transient"`
+	FailedAt  time.Time `bson:"failedAt"`
+}
+
+func recordFailedBlock(db *mgo.Database, blockNum uint32, attempts uint, err error) error {
+	_, upsertErr := db.C(failedBlocksCollectionName).UpsertId(blockNum, &FailedBlock{
+		BlockNum:  blockNum,
+		Error:     err.Error(),
+		Attempts:  attempts,
+		Transient: isTransient(err),
+		FailedAt:  time.Now(),
+	})
+	return errors.Wrapf(upsertErr, "failed to record failed block %v", blockNum)
+}
+
+// ListFailedBlocks returns the failed blocks recorded, sorted by the block number.
+func ListFailedBlocks(db *mgo.Database) ([]*FailedBlock, error) {
+	var blocks []*FailedBlock
+	if err := db.C(failedBlocksCollectionName).Find(nil).Sort("_id").All(&blocks); err != nil {
+		return nil, errors.Wrap(err, "failed to load failed blocks")
+	}
+	return blocks, nil
+}
+
+// OptionsFunc returns the options to create a BlockProcessor with.
+// It is called for every processor created so that the notifiers and the callers
+// owned by the processor are not shared with the processors created later.
+type OptionsFunc func() ([]Option, error)
+
+// RetryFailedBlocks replays the recorded failed blocks one by one.
+// The blocks processed successfully are removed from the record,
+// the blocks that failed again are returned.
+//
+// A block only counts as processed successfully once all the resulting notifications
+// are dispatched, otherwise it is recorded again so that it can be retried later.
+//
+// Dry run must not be requested, the blocks would be removed from the record otherwise.
+func RetryFailedBlocks(
+	client *rpc.Client,
+	connect ConnectFunc,
+	db *mgo.Database,
+	newOptions OptionsFunc,
+) (fixed []uint32, failed []*FailedBlock, err error) {
+
+	blocks, err := ListFailedBlocks(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, block := range blocks {
+		opts, err := newOptions()
+		if err != nil {
+			return fixed, failed, err
+		}
+
+		err = Replay(client, connect, db, block.BlockNum, block.BlockNum, opts...)
+		if _, ok := errors.Cause(err).(*DispatchError); ok {
+			if err := recordFailedBlock(db, block.BlockNum, block.Attempts+1, err); err != nil {
+				return fixed, failed, err
+			}
+		} else if err != nil {
+			return fixed, failed, err
+		}
+
+		// The record is updated in case the block fails again.
+		var current FailedBlock
+		if err := db.C(failedBlocksCollectionName).FindId(block.BlockNum).One(&current); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return fixed, failed, errors.Wrapf(err, "failed to load failed block %v", block.BlockNum)
+		}
+		if !current.FailedAt.Equal(block.FailedAt) {
+			failed = append(failed, &current)
+			continue
+		}
+
+		if err := db.C(failedBlocksCollectionName).RemoveId(block.BlockNum); err != nil {
+			if err != mgo.ErrNotFound {
+				return fixed, failed, errors.Wrapf(
+					err, "failed to remove failed block %v", block.BlockNum)
+			}
+		}
+		fixed = append(fixed, block.BlockNum)
+	}
+	return fixed, failed, nil
+}
+
+// permanentError marks errors that are caused by the block itself,
+// i.e. processing the block again would not help.
+type permanentError struct {
+	error
+}
+
+func permanent(err error) error {
+	return &permanentError{err}
+}
+
+// isTransient returns true in case the error is probably caused by steemd or MongoDB
+// being temporarily unavailable. Errors of unknown origin are considered transient,
+// they are only retried a limited number of times anyway.
+func isTransient(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *permanentError:
+		return false
+	case *jsonrpc2.Error:
+		// steemd processed the request and rejected it.
+		return false
+	case *mgo.QueryError:
+		// MongoDB processed the request and rejected it.
+		return false
+	case *mgo.LastError:
+		// Write errors other than duplicate keys are usually caused by failovers.
+		return !mgo.IsDup(cause)
+	default:
+		return true
+	}
+}
+
+// handleBlock processes the block, retrying on transient errors.
+// In case the block cannot be processed even after retrying, it is recorded
+// in the failed blocks collection and skipped so that the processor can carry on.
+// tomb.ErrDying is returned in case the processor is interrupted while retrying.
+// recorded is set when the block has been recorded as failed.
+//
+// The notifications queued by the failed attempt are dispatched before the block
+// is processed again, so that the delivery log tells which of them were delivered.
+func (processor *BlockProcessor) handleBlock(
+	client *rpc.Client,
+	block *database.Block,
+	pending *pendingBlock,
+) (recorded bool, err error) {
+
+	logger := processor.logger.WithField("block", block.Number)
+	delay := processor.blockRetryMinDelay
+
+	for attempt := uint(1); ; attempt++ {
+		err := processor.processBlock(client, block)
+		if err == nil {
+			return false, nil
+		}
+		if !processor.t.Alive() {
+			return false, tomb.ErrDying
+		}
+
+		if !isTransient(err) || attempt >= processor.blockMaxAttempts {
+			blocksFailed.Inc()
+
+			// Fail loudly when the deliveries are only being reported.
+			if processor.dryRun != nil {
+				return false, errors.Wrapf(err, "block %v", block.Number)
+			}
+
+			logger.WithError(err).WithField("attempts", attempt).Error("Giving up on block")
+			return true, recordFailedBlock(processor.db, block.Number, attempt, err)
+		}
+
+		logger.WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt,
+			"delay":   delay.String(),
+		}).Warn("Failed processing block, retrying ...")
+		blockRetries.Inc()
+
+		select {
+		case <-time.After(delay):
+		case <-processor.t.Dying():
+			return false, tomb.ErrDying
+		}
+
+		if err := pending.Wait(processor.t.Dying()); err != nil {
+			return false, err
+		}
+		pending.ResetFailed()
+
+		delay *= 2
+		if delay > processor.blockRetryMaxDelay {
+			delay = processor.blockRetryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// flagTTL is how long the flags are remembered.
+// Votes cannot be changed once the content pays out, i.e. 7 days after it is published.
+const flagTTL = 8 * 24 * time.Hour
+
+// flagRemovedTTL is how long the removed flags are remembered.
+// It covers the blocks being processed in parallel or retried.
+const flagRemovedTTL = time.Hour
+
+// flagPruneInterval is how often the expired flags are dropped from memory.
+const flagPruneInterval = time.Hour
+
+func ensureFlagIndexes(db *mgo.Database) error {
+	// The documents are removed by MongoDB once expired.
+	err := db.C("flags").EnsureIndex(mgo.Index{
+		Key:         []string{"flaggedAt"},
+		Background:  true,
+		ExpireAfter: flagTTL,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for flags.flaggedAt")
+	}
+	return nil
+}
+
+func flagKey(op *types.VoteOperation) string {
+	return op.Author + "/" + op.Permlink + "/" + op.Voter
+}
+
+// flagLog remembers the flags being watched so that the vote replacing a flag
+// can be recognized as a removed flag. The vote operation itself only carries
+// the new weight, which is 0 when the vote is removed no matter what it was.
+//
+// The flags are kept in memory so that no vote needs a database round-trip
+// unless it replaces a recorded flag. The flags collection is only used
+// to load the flags again on start.
+//
+// The blocks are processed in parallel, so the vote replacing a flag can be handled
+// before the flag itself. Every flag records the block it was cast in and the updates
+// coming from older blocks are ignored. A removed flag is kept for a while for the
+// same reason so that the flag being handled late is not recorded again.
+type flagLog struct {
+	c        *mgo.Collection
+	flags    map[string]*flagDoc
+	prunedAt time.Time
+	lock     sync.Mutex
+}
+
+type flagDoc struct {
+	Key      string `bson:"_id"`
+	BlockNum uint32 `bson:"blockNum"`
+	Removed  bool   `bson:"removed,omitempty"`
+
+	// FlaggedAt is backdated for the removed flags so that they expire after flagRemovedTTL.
+	FlaggedAt time.Time `bson:"flaggedAt"`
+}
+
+func newFlagLog(db *mgo.Database) (*flagLog, error) {
+	var (
+		c     = db.C("flags")
+		now   = time.Now()
+		flags = make(map[string]*flagDoc)
+	)
+
+	iter := c.Find(bson.M{"flaggedAt": bson.M{"$gt": now.Add(-flagTTL)}}).Iter()
+	for {
+		doc := &flagDoc{}
+		if !iter.Next(doc) {
+			break
+		}
+		flags[doc.Key] = doc
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to load flags")
+	}
+
+	return &flagLog{
+		c:        c,
+		flags:    flags,
+		prunedAt: now,
+	}, nil
+}
+
+// Contains returns true in case the voter flagged the content and the flag is still recorded.
+func (log *flagLog) Contains(op *types.VoteOperation) bool {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	doc, ok := log.flags[flagKey(op)]
+	return ok && !doc.Removed && time.Since(doc.FlaggedAt) < flagTTL
+}
+
+// Record remembers the flag cast by the vote operation included in the given block.
+func (log *flagLog) Record(op *types.VoteOperation, blockNum uint32) error {
+	now := time.Now()
+	doc := &flagDoc{
+		Key:       flagKey(op),
+		BlockNum:  blockNum,
+		FlaggedAt: now,
+	}
+
+	log.lock.Lock()
+	if !log.update(doc) {
+		log.lock.Unlock()
+		return nil
+	}
+	if now.Sub(log.prunedAt) > flagPruneInterval {
+		for k, d := range log.flags {
+			if now.Sub(d.FlaggedAt) >= flagTTL {
+				delete(log.flags, k)
+			}
+		}
+		log.prunedAt = now
+	}
+	log.lock.Unlock()
+
+	return log.store(doc)
+}
+
+// Forget forgets the flag replaced by the vote operation included in the given block, if any.
+// True is returned in case a flag was recorded for the voter and the content.
+//
+// watched tells whether the flag would be recorded in case it was cast.
+// The removal is only remembered then, in case the flag is handled late.
+func (log *flagLog) Forget(op *types.VoteOperation, blockNum uint32, watched bool) (bool, error) {
+	now := time.Now()
+	doc := &flagDoc{
+		Key:       flagKey(op),
+		BlockNum:  blockNum,
+		Removed:   true,
+		FlaggedAt: now.Add(flagRemovedTTL - flagTTL),
+	}
+
+	log.lock.Lock()
+	current, ok := log.flags[doc.Key]
+	flagged := ok && !current.Removed && now.Sub(current.FlaggedAt) < flagTTL
+	if !flagged && !watched {
+		log.lock.Unlock()
+		return false, nil
+	}
+	if !log.update(doc) {
+		log.lock.Unlock()
+		return false, nil
+	}
+	log.lock.Unlock()
+
+	return flagged, log.store(doc)
+}
+
+// update replaces the recorded flag with doc unless it was recorded for a newer block.
+// The caller is expected to hold the lock.
+func (log *flagLog) update(doc *flagDoc) bool {
+	if current, ok := log.flags[doc.Key]; ok && current.BlockNum > doc.BlockNum {
+		return false
+	}
+	log.flags[doc.Key] = doc
+	return true
+}
+
+// store saves the flag unless a newer one is stored already.
+func (log *flagLog) store(doc *flagDoc) error {
+	selector := bson.M{
+		"_id": doc.Key,
+		"$or": []bson.M{
+			{"blockNum": bson.M{"$lte": doc.BlockNum}},
+			{"blockNum": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"blockNum":  doc.BlockNum,
+			"removed":   doc.Removed,
+			"flaggedAt": doc.FlaggedAt,
+		},
+	}
+	// The upsert fails on the duplicate key in case a newer flag is stored.
+	if _, err := log.c.Upsert(selector, update); err != nil && !mgo.IsDup(err) {
+		return errors.Wrapf(err, "failed to store flag %v", doc.Key)
+	}
+	return nil
+}
+
+// recordFlag remembers the flag cast by the vote operation included in the given block.
+// Nothing is recorded in case this is a dry run.
+func (processor *BlockProcessor) recordFlag(op *types.VoteOperation, blockNum uint32) error {
+	if processor.dryRun != nil {
+		return nil
+	}
+	return processor.flags.Record(op, blockNum)
+}
+
+// forgetFlag forgets the flag replaced by the vote operation included in the given block, if any.
+// True is returned in case a flag was recorded for the voter and the content.
+// The flag is only checked in case this is a dry run.
+func (processor *BlockProcessor) forgetFlag(op *types.VoteOperation, blockNum uint32, watched bool) (bool, error) {
+	if processor.dryRun != nil {
+		return processor.flags.Contains(op), nil
+	}
+	return processor.flags.Forget(op, blockNum, watched)
+}
@@ -0,0 +1,317 @@
+package notifications
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFlagLog_Contains(t *testing.T) {
+	now := time.Now()
+
+	log := &flagLog{
+		flags: map[string]*flagDoc{
+			"alice/story/whale":   {FlaggedAt: now.Add(-time.Hour)},
+			"alice/story/dolphin": {FlaggedAt: now.Add(-flagTTL - time.Hour)},
+			"alice/story/orca":    {FlaggedAt: now.Add(-time.Hour), Removed: true},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		op       *types.VoteOperation
+		contains bool
+	}{
+		{"recorded flag", &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"}, true},
+		{"expired flag", &types.VoteOperation{Voter: "dolphin", Author: "alice", Permlink: "story"}, false},
+		{"removed flag", &types.VoteOperation{Voter: "orca", Author: "alice", Permlink: "story"}, false},
+		{"other voter", &types.VoteOperation{Voter: "minnow", Author: "alice", Permlink: "story"}, false},
+		{"other content", &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "other"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if contains := log.Contains(tc.op); contains != tc.contains {
+				t.Errorf("expected %v, got %v", tc.contains, contains)
+			}
+		})
+	}
+}
+
+func TestFlagLog_ForgetUnknown(t *testing.T) {
+	// The collection is not set, so the database must not be touched.
+	log := &flagLog{flags: make(map[string]*flagDoc)}
+
+	flagged, err := log.Forget(&types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"}, 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flagged {
+		t.Error("expected no flag to be forgotten")
+	}
+	if len(log.flags) != 0 {
+		t.Error("expected the removal of an unwatched flag not to be remembered")
+	}
+}
+
+func TestFlagLog_Update(t *testing.T) {
+	now := time.Now()
+	log := &flagLog{flags: make(map[string]*flagDoc)}
+
+	// The flag removed in block 101 is handled before the flag cast in block 100.
+	removed := &flagDoc{Key: "alice/story/whale", BlockNum: 101, Removed: true, FlaggedAt: now}
+	if !log.update(removed) {
+		t.Fatal("expected the removal to be recorded")
+	}
+	if log.update(&flagDoc{Key: "alice/story/whale", BlockNum: 100, FlaggedAt: now}) {
+		t.Error("expected the flag from an older block to be ignored")
+	}
+	if log.Contains(&types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"}) {
+		t.Error("expected the flag to stay removed")
+	}
+
+	// The same voter flags the content again later.
+	if !log.update(&flagDoc{Key: "alice/story/whale", BlockNum: 102, FlaggedAt: now}) {
+		t.Error("expected the flag from a newer block to be recorded")
+	}
+	if !log.Contains(&types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"}) {
+		t.Error("expected the flag to be recorded")
+	}
+}
+
+func TestVoteEventMiners(t *testing.T) {
+	testCases := []struct {
+		name    string
+		weight  types.Int16
+		voted   bool
+		flagged bool
+		removed bool
+	}{
+		{"upvote", 10000, true, false, false},
+		{"downvote", -10000, true, true, false},
+		{"removed vote", 0, true, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			op := &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story", Weight: tc.weight}
+			content := &database.Content{Author: "alice", Permlink: "story"}
+
+			voted, err := events.NewStoryVotedEventMiner().MineEvent(op, content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if emitted := len(voted) != 0; emitted != tc.voted {
+				t.Errorf("expected story.voted to be emitted: %v", tc.voted)
+			}
+			if len(voted) != 0 && voted[0].(*events.StoryVoted).Removed != tc.removed {
+				t.Errorf("expected removed to be %v", tc.removed)
+			}
+
+			flagged, err := events.NewStoryFlaggedEventMiner().MineEvent(op, content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if emitted := len(flagged) != 0; emitted != tc.flagged {
+				t.Errorf("expected story.flagged to be emitted: %v", tc.flagged)
+			}
+		})
+	}
+}
+
+func TestHandleStoryVotedEvent_Flags(t *testing.T) {
+	var (
+		alice = bson.NewObjectId() // story.voted
+		bob   = bson.NewObjectId() // story.voted and story.flagged
+		carol = bson.NewObjectId() // story.flagged
+		names = map[string]string{alice.Hex(): "alice", bob.Hex(): "bob", carol.Hex(): "carol"}
+	)
+
+	testCases := []struct {
+		name       string
+		weight     types.Int16
+		recorded   bool
+		deliveries []string
+	}{
+		{
+			name:       "upvote",
+			weight:     10000,
+			deliveries: []string{"alice story.voted", "bob story.voted"},
+		},
+		{
+			name:       "downvote is a vote and a flag, but only sent once",
+			weight:     -10000,
+			deliveries: []string{"alice story.voted", "bob story.flagged", "carol story.flagged"},
+		},
+		{
+			name:       "removed vote",
+			weight:     0,
+			deliveries: []string{"alice story.voted", "bob story.voted"},
+		},
+		{
+			name:       "removed flag",
+			weight:     0,
+			recorded:   true,
+			deliveries: []string{"alice story.voted", "bob story.flagged", "carol story.flagged"},
+		},
+		{
+			name:       "flag replaced by an upvote",
+			weight:     10000,
+			recorded:   true,
+			deliveries: []string{"alice story.voted", "bob story.flagged", "carol story.flagged"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			index := newTestSubscriptionIndex(
+				newTestSubscription(alice, "story.voted", map[string][]string{"voters": {"whale"}}),
+				newTestSubscription(bob, "story.voted", map[string][]string{"voters": {"whale"}}),
+				newTestSubscription(bob, "story.flagged", map[string][]string{"voters": {"whale"}}),
+				newTestSubscription(carol, "story.flagged", map[string][]string{"voters": {"whale"}}),
+			)
+			index.notifiers = map[bson.ObjectId][]*NotifierDoc{
+				alice: {{NotifierId: "slack"}},
+				bob:   {{NotifierId: "slack"}},
+				carol: {{NotifierId: "slack"}},
+			}
+
+			var deliveries []string
+			processor := &BlockProcessor{
+				index:  index,
+				flags:  &flagLog{flags: make(map[string]*flagDoc)},
+				logger: newTestLogger(),
+				dryRun: func(delivery *PlannedDelivery) {
+					deliveries = append(deliveries, names[delivery.UserId]+" "+delivery.Kind)
+				},
+			}
+
+			op := &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story", Weight: tc.weight}
+			content := &database.Content{Author: "alice", Permlink: "story"}
+			if tc.recorded {
+				processor.flags.flags[flagKey(op)] = &flagDoc{FlaggedAt: time.Now()}
+			}
+
+			// The events the miners emit for the vote operation.
+			if err := processor.HandleStoryVotedEvent(&events.StoryVoted{
+				Op:      op,
+				Content: content,
+				Removed: tc.weight == 0,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if tc.weight < 0 {
+				if err := processor.HandleStoryFlaggedEvent(&events.StoryFlagged{
+					Op:      op,
+					Content: content,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sort.Strings(deliveries)
+			if len(deliveries) != len(tc.deliveries) {
+				t.Fatalf("expected %v, got %v", tc.deliveries, deliveries)
+			}
+			for i := range deliveries {
+				if deliveries[i] != tc.deliveries[i] {
+					t.Fatalf("expected %v, got %v", tc.deliveries, deliveries)
+				}
+			}
+		})
+	}
+}
+
+func TestOperationFilter_Flags(t *testing.T) {
+	var (
+		alice = bson.NewObjectId()
+		flag  = &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "flagged", Weight: 0}
+	)
+
+	testCases := []struct {
+		name     string
+		subs     []*Subscription
+		op       *types.VoteOperation
+		relevant bool
+	}{
+		{
+			name:     "nobody watching",
+			op:       &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"},
+			relevant: false,
+		},
+		{
+			name: "flagged voter watched",
+			subs: []*Subscription{
+				newTestSubscription(alice, "story.flagged", map[string][]string{"voters": {"whale"}}),
+			},
+			op:       &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"},
+			relevant: true,
+		},
+		{
+			name: "flagged author watched",
+			subs: []*Subscription{
+				newTestSubscription(alice, "comment.flagged", map[string][]string{"authors": {"alice"}}),
+			},
+			op:       &types.VoteOperation{Voter: "whale", Author: "alice", Permlink: "story"},
+			relevant: true,
+		},
+		{
+			name:     "recorded flag replaced",
+			op:       flag,
+			relevant: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := &BlockProcessor{
+				index:            newTestSubscriptionIndex(tc.subs...),
+				flags:            &flagLog{flags: map[string]*flagDoc{flagKey(flag): {FlaggedAt: time.Now()}}},
+				filterOperations: true,
+			}
+			if relevant := processor.isRelevant(tc.op); relevant != tc.relevant {
+				t.Errorf("expected relevant to be %v, got %v", tc.relevant, relevant)
+			}
+		})
+	}
+}
+
+func TestExcludeOwners(t *testing.T) {
+	var (
+		alice = bson.NewObjectId()
+		bob   = bson.NewObjectId()
+		carol = bson.NewObjectId()
+	)
+
+	testCases := []struct {
+		name     string
+		owners   []bson.ObjectId
+		excluded []bson.ObjectId
+		expected []bson.ObjectId
+	}{
+		{"nothing excluded", []bson.ObjectId{alice, bob}, nil, []bson.ObjectId{alice, bob}},
+		{"some excluded", []bson.ObjectId{alice, bob, carol}, []bson.ObjectId{bob}, []bson.ObjectId{alice, carol}},
+		{"all excluded", []bson.ObjectId{alice}, []bson.ObjectId{alice, bob}, nil},
+		{"no owners", nil, []bson.ObjectId{alice}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			owners := excludeOwners(tc.owners, tc.excluded)
+			if len(owners) != len(tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, owners)
+			}
+			for i := range owners {
+				if owners[i] != tc.expected[i] {
+					t.Fatalf("expected %v, got %v", tc.expected, owners)
+				}
+			}
+		})
+	}
+}
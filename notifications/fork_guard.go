@@ -0,0 +1,222 @@
+package notifications
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ModeIrreversible makes the processor wait for every block to become irreversible.
+	// The latency is higher, but no notifications are sent for blocks that are later orphaned.
+	ModeIrreversible = "irreversible"
+
+	// ModeHead makes the processor handle blocks immediately. Blocks are verified
+	// once they become irreversible and the users are notified in case a block
+	// they received notifications for was orphaned.
+	ModeHead = "head"
+)
+
+const (
+	DefaultMode                   = ModeHead
+	DefaultForkGuardCheckInterval = 3 * time.Second
+)
+
+func SetMode(mode string) Option {
+	return func(processor *BlockProcessor) {
+		processor.mode = mode
+	}
+}
+
+func SetForkGuardCheckInterval(interval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.forkGuardCheckInterval = interval
+	}
+}
+
+// UnconfirmedBlock is a block processed in head mode that is not irreversible yet.
+type UnconfirmedBlock struct {
+	Num              uint32 `bson:"num"`
+	WitnessSignature string `bson:"witnessSignature"`
+}
+
+// forkGuard keeps track of the last irreversible block.
+//
+// In irreversible mode it holds blocks until they become irreversible.
+// In head mode it remembers the blocks that are not irreversible yet
+// and it checks them against the canonical chain later on.
+type forkGuard struct {
+	mode     string
+	client   *rpc.Client
+	orphaned func(canonical *database.Block) error
+	logger   *logrus.Entry
+
+	lib         uint32
+	libUpdated  chan struct{}
+	unconfirmed map[uint32]string
+	lock        sync.Mutex
+}
+
+func newForkGuard(
+	mode string,
+	client *rpc.Client,
+	config *BlockProcessorConfig,
+	orphaned func(canonical *database.Block) error,
+	logger *logrus.Entry,
+) (*forkGuard, error) {
+
+	switch mode {
+	case ModeIrreversible, ModeHead:
+	default:
+		return nil, errors.Errorf("unknown block processing mode: %v", mode)
+	}
+
+	unconfirmed := make(map[uint32]string, len(config.UnconfirmedBlocks))
+	for _, block := range config.UnconfirmedBlocks {
+		unconfirmed[block.Num] = block.WitnessSignature
+	}
+
+	return &forkGuard{
+		mode:        mode,
+		client:      client,
+		orphaned:    orphaned,
+		lib:         config.LastIrreversibleBlockNum,
+		libUpdated:  make(chan struct{}),
+		unconfirmed: unconfirmed,
+		logger:      logger,
+	}, nil
+}
+
+// Accept must be called for every block before it is processed.
+//
+// In irreversible mode it blocks until the block is irreversible and it returns
+// the canonical version of the block. False is returned when interrupted.
+func (guard *forkGuard) Accept(block *database.Block, dying <-chan struct{}) (*database.Block, bool, error) {
+	guard.lock.Lock()
+	isIrreversible := block.Number <= guard.lib
+	if !isIrreversible && guard.mode == ModeHead {
+		guard.unconfirmed[block.Number] = block.WitnessSignature
+	}
+	guard.lock.Unlock()
+
+	if isIrreversible || guard.mode == ModeHead {
+		return block, true, nil
+	}
+
+	// Irreversible mode, wait for the block to become irreversible.
+	for {
+		guard.lock.Lock()
+		lib, updated := guard.lib, guard.libUpdated
+		guard.lock.Unlock()
+
+		if block.Number <= lib {
+			break
+		}
+
+		select {
+		case <-updated:
+		case <-dying:
+			return nil, false, nil
+		}
+	}
+
+	// The block might have been replaced in the meantime.
+	canonical, err := guard.client.Database.GetBlock(block.Number)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to get block %v", block.Number)
+	}
+	return canonical, true, nil
+}
+
+// Checkpoint stores the fork guard state into the config.
+func (guard *forkGuard) Checkpoint(config *BlockProcessorConfig) {
+	guard.lock.Lock()
+	defer guard.lock.Unlock()
+
+	config.LastIrreversibleBlockNum = guard.lib
+	config.UnconfirmedBlocks = make([]*UnconfirmedBlock, 0, len(guard.unconfirmed))
+	for num, signature := range guard.unconfirmed {
+		config.UnconfirmedBlocks = append(config.UnconfirmedBlocks, &UnconfirmedBlock{num, signature})
+	}
+	sort.Slice(config.UnconfirmedBlocks, func(i, j int) bool {
+		return config.UnconfirmedBlocks[i].Num < config.UnconfirmedBlocks[j].Num
+	})
+}
+
+func (guard *forkGuard) LastIrreversibleBlockNum() uint32 {
+	guard.lock.Lock()
+	defer guard.lock.Unlock()
+	return guard.lib
+}
+
+// watcher keeps the last irreversible block number up to date
+// and it verifies unconfirmed blocks once they become irreversible.
+func (guard *forkGuard) watcher(interval time.Duration, dying <-chan struct{}) error {
+	for {
+		guard.check()
+
+		select {
+		case <-time.After(interval):
+		case <-dying:
+			return nil
+		}
+	}
+}
+
+func (guard *forkGuard) check() {
+	props, err := guard.client.Database.GetDynamicGlobalProperties()
+	if err != nil {
+		guard.logger.WithError(err).Warn("failed to get steemd dynamic global properties")
+		return
+	}
+	lib := props.LastIrreversibleBlockNum
+
+	guard.lock.Lock()
+	if lib > guard.lib {
+		guard.lib = lib
+		close(guard.libUpdated)
+		guard.libUpdated = make(chan struct{})
+	}
+
+	var confirmed []*UnconfirmedBlock
+	for num, signature := range guard.unconfirmed {
+		if num <= lib {
+			confirmed = append(confirmed, &UnconfirmedBlock{num, signature})
+		}
+	}
+	guard.lock.Unlock()
+
+	sort.Slice(confirmed, func(i, j int) bool {
+		return confirmed[i].Num < confirmed[j].Num
+	})
+
+	for _, block := range confirmed {
+		if err := guard.verify(block); err != nil {
+			// Try again next time.
+			guard.logger.WithError(err).Warn("failed to verify block")
+			return
+		}
+
+		guard.lock.Lock()
+		delete(guard.unconfirmed, block.Num)
+		guard.lock.Unlock()
+	}
+}
+
+func (guard *forkGuard) verify(block *UnconfirmedBlock) error {
+	canonical, err := guard.client.Database.GetBlock(block.Num)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get block %v", block.Num)
+	}
+	if canonical.WitnessSignature == block.WitnessSignature {
+		return nil
+	}
+
+	guard.logger.WithField("block", block.Num).Warn("block orphaned")
+	return guard.orphaned(canonical)
+}
@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+func TestNewForkGuard(t *testing.T) {
+	testCases := []struct {
+		mode  string
+		valid bool
+	}{
+		{ModeHead, true},
+		{ModeIrreversible, true},
+		{"", false},
+		{"optimistic", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			_, err := newForkGuard(tc.mode, nil, &BlockProcessorConfig{}, nil, newTestLogger())
+			if valid := err == nil; valid != tc.valid {
+				t.Errorf("expected valid to be %v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestForkGuard_Accept(t *testing.T) {
+	dying := make(chan struct{})
+	close(dying)
+
+	testCases := []struct {
+		name        string
+		mode        string
+		lib         uint32
+		blocks      []uint32
+		accepted    []bool
+		unconfirmed []*UnconfirmedBlock
+	}{
+		{
+			name:        "head mode remembers reversible blocks",
+			mode:        ModeHead,
+			lib:         100,
+			blocks:      []uint32{100, 101, 102},
+			accepted:    []bool{true, true, true},
+			unconfirmed: []*UnconfirmedBlock{{101, "sig101"}, {102, "sig102"}},
+		},
+		{
+			name:        "irreversible mode holds reversible blocks",
+			mode:        ModeIrreversible,
+			lib:         100,
+			blocks:      []uint32{99, 100, 101},
+			accepted:    []bool{true, true, false},
+			unconfirmed: []*UnconfirmedBlock{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			guard, err := newForkGuard(
+				tc.mode, nil, &BlockProcessorConfig{LastIrreversibleBlockNum: tc.lib}, nil, newTestLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, num := range tc.blocks {
+				block := &database.Block{Number: num, WitnessSignature: "sig" + strconv.Itoa(int(num))}
+
+				// Dying is closed, so the blocks being held are not accepted.
+				accepted, ok, err := guard.Accept(block, dying)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != tc.accepted[i] {
+					t.Errorf("block %v: expected accepted to be %v, got %v", num, tc.accepted[i], ok)
+				}
+				if ok && accepted != block {
+					t.Errorf("block %v: expected the block to be passed through", num)
+				}
+			}
+
+			var config BlockProcessorConfig
+			guard.Checkpoint(&config)
+			if config.LastIrreversibleBlockNum != tc.lib {
+				t.Errorf("expected last irreversible block %v, got %v", tc.lib, config.LastIrreversibleBlockNum)
+			}
+			if !reflect.DeepEqual(config.UnconfirmedBlocks, tc.unconfirmed) {
+				t.Errorf("expected unconfirmed blocks %v, got %v", tc.unconfirmed, config.UnconfirmedBlocks)
+			}
+		})
+	}
+}
+
+func TestForkGuard_RestoreCheckpoint(t *testing.T) {
+	config := &BlockProcessorConfig{
+		LastIrreversibleBlockNum: 100,
+		UnconfirmedBlocks: []*UnconfirmedBlock{
+			{102, "sig102"},
+			{101, "sig101"},
+		},
+	}
+
+	guard, err := newForkGuard(ModeHead, nil, config, nil, newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored BlockProcessorConfig
+	guard.Checkpoint(&restored)
+
+	expected := []*UnconfirmedBlock{{101, "sig101"}, {102, "sig102"}}
+	if !reflect.DeepEqual(restored.UnconfirmedBlocks, expected) {
+		t.Errorf("expected unconfirmed blocks %v, got %v", expected, restored.UnconfirmedBlocks)
+	}
+	if lib := guard.LastIrreversibleBlockNum(); lib != 100 {
+		t.Errorf("expected last irreversible block 100, got %v", lib)
+	}
+}
@@ -0,0 +1,114 @@
+// Package matching implements multi-pattern string matching.
+//
+// The matcher is an Aho-Corasick automaton, so the time needed to scan a text
+// depends on the text length and the number of matches, not on the number
+// of patterns being searched for.
+package matching
+
+type node struct {
+	next    map[byte]int
+	fail    int
+	outputs []int
+}
+
+type Matcher struct {
+	nodes    []*node
+	patterns []string
+}
+
+// New builds a matcher for the given patterns.
+//
+// The patterns are matched byte by byte, so any normalization
+// (e.g. lowercasing) must be applied to both the patterns and the text.
+func New(patterns []string) *Matcher {
+	matcher := &Matcher{
+		nodes:    []*node{{next: make(map[byte]int)}},
+		patterns: patterns,
+	}
+
+	// Build the trie.
+	for i, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+
+		current := 0
+		for j := 0; j < len(pattern); j++ {
+			c := pattern[j]
+			next, ok := matcher.nodes[current].next[c]
+			if !ok {
+				next = len(matcher.nodes)
+				matcher.nodes = append(matcher.nodes, &node{next: make(map[byte]int)})
+				matcher.nodes[current].next[c] = next
+			}
+			current = next
+		}
+		matcher.nodes[current].outputs = append(matcher.nodes[current].outputs, i)
+	}
+
+	// Compute failure links using BFS.
+	queue := make([]int, 0, len(matcher.nodes))
+	for _, child := range matcher.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for c, child := range matcher.nodes[current].next {
+			queue = append(queue, child)
+
+			fail := matcher.nodes[current].fail
+			for {
+				if next, ok := matcher.nodes[fail].next[c]; ok {
+					fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = matcher.nodes[fail].fail
+			}
+
+			matcher.nodes[child].fail = fail
+			matcher.nodes[child].outputs = append(
+				matcher.nodes[child].outputs, matcher.nodes[fail].outputs...)
+		}
+	}
+
+	return matcher
+}
+
+// Len returns the number of patterns the matcher was built from.
+func (matcher *Matcher) Len() int {
+	return len(matcher.patterns)
+}
+
+// Pattern returns the pattern with the given index.
+func (matcher *Matcher) Pattern(index int) string {
+	return matcher.patterns[index]
+}
+
+// Match scans the text and calls fn for every occurrence of any pattern.
+// The occurrence is passed as the pattern index and the byte range in the text.
+func (matcher *Matcher) Match(text string, fn func(index, start, end int)) {
+	current := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		for {
+			if next, ok := matcher.nodes[current].next[c]; ok {
+				current = next
+				break
+			}
+			if current == 0 {
+				break
+			}
+			current = matcher.nodes[current].fail
+		}
+
+		for _, index := range matcher.nodes[current].outputs {
+			end := i + 1
+			fn(index, end-len(matcher.patterns[index]), end)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package notifications
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	blocksProcessed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "blocks_processed_total",
+		Help:      "Number of blocks processed.",
+	})
+
+	blockRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "block_retries_total",
+		Help:      "Number of times a block was processed again after a transient error.",
+	})
+
+	blocksFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "blocks_failed_total",
+		Help:      "Number of blocks given up on and recorded as failed.",
+	})
+
+	lastBlockNum = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "steemwatch",
+		Name:      "last_processed_block_number",
+		Help:      "Number of the last block processed.",
+	})
+
+	blockLag = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "steemwatch",
+		Name:      "block_lag_seconds",
+		Help:      "How far the last processed block is behind the wall clock.",
+	}, func() float64 {
+		// The lag is computed on every scrape so that it grows while the processor is stuck.
+		timestamp, _ := LastBlock()
+		if timestamp.IsZero() {
+			return 0
+		}
+		return time.Since(timestamp).Seconds()
+	})
+
+	eventsMined = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "events_mined_total",
+		Help:      "Number of events mined, by operation type.",
+	}, []string{"op_type"})
+
+	operationsFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "operations_filtered_total",
+		Help:      "Number of operations dropped since no subscription can match them, by operation type.",
+	}, []string{"op_type"})
+
+	usersMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "users_matched_total",
+		Help:      "Number of users matched, by event kind.",
+	}, []string{"kind"})
+
+	notificationsDispatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "notifications_dispatched_total",
+		Help:      "Number of notifications dispatched, by notifier and result.",
+	}, []string{"notifier", "result"})
+
+	dispatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "steemwatch",
+		Name:      "notification_dispatch_duration_seconds",
+		Help:      "Time it takes to dispatch a notification, by notifier.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"notifier"})
+
+	contentCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "steemwatch",
+		Name:      "content_cache_lookups_total",
+		Help:      "Number of content lookups, by result (hit, miss, coalesced).",
+	}, []string{"result"})
+
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "steemwatch",
+		Name:      "steemd_rpc_duration_seconds",
+		Help:      "Time it takes for steemd to respond, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		blocksProcessed,
+		blockRetries,
+		blocksFailed,
+		lastBlockNum,
+		blockLag,
+		eventsMined,
+		operationsFiltered,
+		usersMatched,
+		notificationsDispatched,
+		dispatchDuration,
+		contentCacheLookups,
+		rpcDuration,
+	)
+}
+
+func observeDuration(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// dispatchPoolCollector exports the dispatch queue stats.
+type dispatchPoolCollector struct {
+	pool *dispatchPool
+}
+
+var (
+	dispatchQueueLengthDesc = prometheus.NewDesc(
+		"steemwatch_dispatch_queue_length",
+		"Number of notifications waiting to be dispatched, by notifier.",
+		[]string{"notifier"}, nil)
+
+	dispatchQueueCapacityDesc = prometheus.NewDesc(
+		"steemwatch_dispatch_queue_capacity",
+		"Number of notifications that can be waiting to be dispatched, by notifier.",
+		[]string{"notifier"}, nil)
+
+	dispatchWorkersBusyDesc = prometheus.NewDesc(
+		"steemwatch_dispatch_workers_busy",
+		"Number of notifications being dispatched, by notifier.",
+		[]string{"notifier"}, nil)
+)
+
+func registerDispatchPoolCollector(pool *dispatchPool) error {
+	return prometheus.Register(&dispatchPoolCollector{pool})
+}
+
+func (collector *dispatchPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dispatchQueueLengthDesc
+	ch <- dispatchQueueCapacityDesc
+	ch <- dispatchWorkersBusyDesc
+}
+
+func (collector *dispatchPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, lane := range collector.pool.lanes {
+		ch <- prometheus.MustNewConstMetric(dispatchQueueLengthDesc,
+			prometheus.GaugeValue, float64(len(lane.queue)), lane.notifierId)
+		ch <- prometheus.MustNewConstMetric(dispatchQueueCapacityDesc,
+			prometheus.GaugeValue, float64(cap(lane.queue)), lane.notifierId)
+		ch <- prometheus.MustNewConstMetric(dispatchWorkersBusyDesc,
+			prometheus.GaugeValue, float64(atomic.LoadInt32(&lane.numBusy)), lane.notifierId)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 	"github.com/tchap/steemwatch/notifications/notifiers/slack"
 	"github.com/tchap/steemwatch/notifications/notifiers/steemitchat"
@@ -13,12 +14,13 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
-var availableNotifiers = map[string]Notifier{
-	"slack": slack.NewNotifier(),
-}
+var availableNotifiers = map[string]Notifier{}
 
 // XXX: Ugly. Would be better to pass the values directly somehow.
-func initNotifiers() {
+func initNotifiers(profile *chain.Profile) {
+	// Slack
+	availableNotifiers["slack"] = slack.NewNotifier(slack.SetChainProfile(profile))
+
 	mustGetenv := func(key string) string {
 		// steemit.chat
 		v := os.Getenv(key)
@@ -28,10 +30,14 @@ func initNotifiers() {
 		return v
 	}
 
-	userID := mustGetenv("STEEMWATCH_STEEMIT_CHAT_USER_ID")
-	authToken := mustGetenv("STEEMWATCH_STEEMIT_CHAT_AUTH_TOKEN")
+	// steemit.chat is only there for Steem.
+	if profile.ChatAvailable {
+		userID := mustGetenv("STEEMWATCH_STEEMIT_CHAT_USER_ID")
+		authToken := mustGetenv("STEEMWATCH_STEEMIT_CHAT_AUTH_TOKEN")
 
-	availableNotifiers["steemit-chat"] = steemitchat.NewNotifier(userID, authToken)
+		availableNotifiers["steemit-chat"] = steemitchat.NewNotifier(
+			userID, authToken, steemitchat.SetChainProfile(profile))
+	}
 
 	// Telegram
 	botToken := mustGetenv("STEEMWATCH_TELEGRAM_BOT_TOKEN")
@@ -40,7 +46,7 @@ func initNotifiers() {
 		panic(err)
 	}
 
-	availableNotifiers["telegram"] = telegram.NewNotifier(bot)
+	availableNotifiers["telegram"] = telegram.NewNotifier(bot, telegram.SetChainProfile(profile))
 }
 
 type Notifier interface {
@@ -52,7 +58,16 @@ type Notifier interface {
 	DispatchStoryPublishedEvent(userId string, userSettings bson.Raw, event *events.StoryPublished) error
 	DispatchStoryVotedEvent(userId string, userSettings bson.Raw, event *events.StoryVoted) error
 	DispatchCommentPublishedEvent(userId string, userSettings bson.Raw, event *events.CommentPublished) error
+	DispatchCommentThreadReplyEvent(userId string, userSettings bson.Raw, event *events.CommentThreadReply) error
 	DispatchCommentVotedEvent(userId string, userSettings bson.Raw, event *events.CommentVoted) error
+	DispatchStoryFlaggedEvent(userId string, userSettings bson.Raw, event *events.StoryFlagged) error
+	DispatchCommentFlaggedEvent(userId string, userSettings bson.Raw, event *events.CommentFlagged) error
+	DispatchContentMatchedEvent(userId string, userSettings bson.Raw, event *events.ContentMatched) error
+	DispatchStoryPayoutSoonEvent(userId string, userSettings bson.Raw, event *events.StoryPayoutSoon) error
+	DispatchAccountThresholdCrossedEvent(userId string, userSettings bson.Raw, event *events.AccountThresholdCrossed) error
+	DispatchPriceAlertEvent(userId string, userSettings bson.Raw, event *events.PriceAlert) error
+	DispatchBlockOrphanedEvent(userId string, userSettings bson.Raw, event *events.BlockOrphaned) error
+	DispatchCatchUpDigestEvent(userId string, userSettings bson.Raw, event *events.CatchUpDigest) error
 
 	io.Closer
 }
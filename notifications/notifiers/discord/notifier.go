@@ -2,6 +2,7 @@ package discord
 
 import (
 	"github.com/bwmarrin/discordgo"
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/errs"
 	"github.com/tchap/steemwatch/notifications/events"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/discord"
@@ -18,6 +19,7 @@ const DefaultMaxConcurrentRequests = 1000
 
 type Notifier struct {
 	dg                    *discordgo.Session
+	profile               *chain.Profile
 	maxConcurrentRequests uint
 	requestSemaphore      chan struct{}
 	termCh                chan struct{}
@@ -26,6 +28,7 @@ type Notifier struct {
 func NewNotifier(dg *discordgo.Session, opts ...NotifierOption) *Notifier {
 	notifier := &Notifier{
 		dg: dg,
+		profile:               chain.Steem,
 		maxConcurrentRequests: DefaultMaxConcurrentRequests,
 		termCh:                make(chan struct{}),
 	}
@@ -47,13 +50,21 @@ func SetMaxConcurrentRequests(maxConcurrentRequests uint) NotifierOption {
 	}
 }
 
+// SetChainProfile sets the chain the notifications are rendered for.
+// chain.Steem is used by default.
+func SetChainProfile(profile *chain.Profile) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.profile = profile
+	}
+}
+
 func (notifier *Notifier) DispatchAccountUpdatedEvent(
 	userId string,
 	userSettings bson.Raw,
 	event *events.AccountUpdated,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderAccountUpdatedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderAccountUpdatedEvent(profile, event)
 	})
 }
 
@@ -62,8 +73,8 @@ func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
 	userSettings bson.Raw,
 	event *events.AccountWitnessVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderAccountWitnessVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderAccountWitnessVotedEvent(profile, event)
 	})
 }
 
@@ -72,8 +83,8 @@ func (notifier *Notifier) DispatchTransferMadeEvent(
 	userSettings bson.Raw,
 	event *events.TransferMade,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderTransferMadeEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderTransferMadeEvent(profile, event)
 	})
 }
 
@@ -82,8 +93,8 @@ func (notifier *Notifier) DispatchUserMentionedEvent(
 	userSettings bson.Raw,
 	event *events.UserMentioned,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderUserMentionedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderUserMentionedEvent(profile, event)
 	})
 }
 
@@ -92,8 +103,8 @@ func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
 	userSettings bson.Raw,
 	event *events.UserFollowStatusChanged,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderUserFollowStatusChangedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderUserFollowStatusChangedEvent(profile, event)
 	})
 }
 
@@ -102,8 +113,8 @@ func (notifier *Notifier) DispatchStoryPublishedEvent(
 	userSettings bson.Raw,
 	event *events.StoryPublished,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderStoryPublishedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderStoryPublishedEvent(profile, event)
 	})
 }
 
@@ -112,8 +123,8 @@ func (notifier *Notifier) DispatchStoryVotedEvent(
 	userSettings bson.Raw,
 	event *events.StoryVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderStoryVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderStoryVotedEvent(profile, event)
 	})
 }
 
@@ -122,8 +133,18 @@ func (notifier *Notifier) DispatchCommentPublishedEvent(
 	userSettings bson.Raw,
 	event *events.CommentPublished,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderCommentPublishedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderCommentPublishedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentThreadReplyEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentThreadReply,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderCommentThreadReplyEvent(profile, event)
 	})
 }
 
@@ -132,22 +153,115 @@ func (notifier *Notifier) DispatchCommentVotedEvent(
 	userSettings bson.Raw,
 	event *events.CommentVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderCommentVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderCommentVotedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryFlaggedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryFlagged,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderStoryFlaggedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentFlaggedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentFlagged,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderCommentFlaggedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchContentMatchedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.ContentMatched,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderContentMatchedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryPayoutSoonEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryPayoutSoon,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderStoryPayoutSoonEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountThresholdCrossedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountThresholdCrossed,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderAccountThresholdCrossedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPriceAlertEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PriceAlert,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) string {
+		return renderPriceAlertEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockOrphanedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockOrphaned,
+) error {
+	return notifier.dispatch(userId, userSettings, nil, func(profile *chain.Profile) string {
+		return renderBlockOrphanedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCatchUpDigestEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CatchUpDigest,
+) error {
+	return notifier.dispatch(userId, userSettings, nil, func(profile *chain.Profile) string {
+		return renderCatchUpDigestEvent(profile, event)
 	})
 }
 
 func (notifier *Notifier) dispatch(
 	userId string,
 	userSettings bson.Raw,
-	render func() string,
+	origin *events.Origin,
+	render func(*chain.Profile) string,
 ) error {
 	var settings discord.Settings
 	if err := userSettings.Unmarshal(&settings); err != nil {
 		return errors.Wrap(err, "failed to unmarshal user settings")
 	}
 
-	return notifier.send(&settings, render())
+	// Render the links for the front-end chosen by the user.
+	var preferences chain.Preferences
+	if err := userSettings.Unmarshal(&preferences); err != nil {
+		return errors.Wrap(err, "failed to unmarshal user preferences")
+	}
+	profile := notifier.profile.WithFrontEnd(preferences.FrontEnd)
+
+	text := render(profile)
+	if origin.IsDelayed() {
+		text = markDelayed(text, origin)
+	}
+
+	return notifier.send(&settings, text)
 }
 
 func (notifier *Notifier) send(settings *discord.Settings, text string) error {
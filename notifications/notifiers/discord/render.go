@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 )
 
@@ -18,18 +20,21 @@ func steemdLink(account string) string {
 
 // AccountUpdated
 
-func renderAccountUpdatedEvent(event *events.AccountUpdated) string {
+func renderAccountUpdatedEvent(profile *chain.Profile, event *events.AccountUpdated) string {
 	return fmt.Sprintf(`
 **-----**
 Account update detected for %v.
+
+**Link:** %v
 `,
 		steemitLink(event.Op.Account),
+		profile.FrontEnd.Account(event.Op.Account),
 	)
 }
 
 // AccountWitnessVoted
 
-func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
+func renderAccountWitnessVotedEvent(profile *chain.Profile, event *events.AccountWitnessVoted) string {
 	var verb string
 	if event.Op.Approve {
 		verb = "approved"
@@ -49,44 +54,45 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
 
 // TransferMade
 
-func renderTransferMadeEvent(event *events.TransferMade) string {
+func renderTransferMadeEvent(profile *chain.Profile, event *events.TransferMade) string {
 	op := event.Op
+
+	var memo string
 	if op.Memo != "" {
-		return fmt.Sprintf(`
+		memo = " using memo " + op.Memo
+	}
+
+	return fmt.Sprintf(`
 **-----**
-%v transferred %v to %v using memo %v.
+%v transferred %v to %v%v.
+
+**Link:** %v
 `,
-			steemitLink(op.From),
-			op.Amount,
-			steemitLink(op.To),
-			op.Memo,
-		)
-	}
-	return fmt.Sprintf(
-		"%v transferred %v to %v.",
 		steemitLink(op.From),
-		op.Amount,
+		profile.FormatAmount(op.Amount),
 		steemitLink(op.To),
+		memo,
+		profile.FrontEnd.Transfers(op.To),
 	)
 }
 
 // UserMentioned
 
-func renderUserMentionedEvent(event *events.UserMentioned) string {
+func renderUserMentionedEvent(profile *chain.Profile, event *events.UserMentioned) string {
 	c := event.Content
 	return fmt.Sprintf(`
 **-----**
-%v was mentioned by %v in https://steemit.com%v.
+%v was mentioned by %v in %v.
 `,
 		steemitLink(event.User),
 		steemitLink(c.Author),
-		c.URL,
+		profile.FrontEnd.Post(c),
 	)
 }
 
 // UserFollowStatusChanged
 
-func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) string {
+func renderUserFollowStatusChangedEvent(profile *chain.Profile, event *events.UserFollowStatusChanged) string {
 	op := event.Op
 
 	follower := steemitLink(op.Follower)
@@ -107,7 +113,7 @@ func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) s
 
 // StoryPublished
 
-func renderStoryPublishedEvent(event *events.StoryPublished) string {
+func renderStoryPublishedEvent(profile *chain.Profile, event *events.StoryPublished) string {
 	c := event.Content
 
 	return fmt.Sprintf(`
@@ -116,42 +122,50 @@ func renderStoryPublishedEvent(event *events.StoryPublished) string {
 
 **Title:** %v
 **Tags:** %v
-**Link:** https://steemit.com%v
+**Link:** %v
 `,
 		steemitLink(c.Author),
 		c.Title,
 		c.JsonMetadata.Tags,
-		c.URL,
+		profile.FrontEnd.Post(c),
 	)
 }
 
 // StoryVoted
 
-func renderStoryVotedEvent(event *events.StoryVoted) string {
+func renderStoryVotedEvent(profile *chain.Profile, event *events.StoryVoted) string {
 	o := event.Op
 	c := event.Content
 
+	action := "cast a vote on"
+	if event.Removed {
+		action = "removed a vote from"
+	}
+
 	return fmt.Sprintf(`
 **-----**
-%v cast a vote on a story by %v.
+%v %v a story by %v.
 
 **Title:** %v
-**Link:** https://steemit.com%v
+**Link:** %v
 **Vote weight:** %v
+**Vote value:** %v
 **Pending Payout:** %v
 `,
 		steemitLink(o.Voter),
+		action,
 		steemitLink(o.Author),
 		c.Title,
-		c.URL,
+		profile.FrontEnd.Post(c),
 		o.Weight,
-		c.PendingPayoutValue,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
 	)
 }
 
 // CommentPublished
 
-func renderCommentPublishedEvent(event *events.CommentPublished) string {
+func renderCommentPublishedEvent(profile *chain.Profile, event *events.CommentPublished) string {
 	c := event.Content
 
 	commentLines := make([]string, 0, 5)
@@ -167,42 +181,287 @@ func renderCommentPublishedEvent(event *events.CommentPublished) string {
 
 	extract := strings.Join(extractLines, "\n")
 	if len(commentLines) > 5 {
-		extract += fmt.Sprintf("\n<https://steemit.com%v|Read more...>", c.URL)
+		extract += fmt.Sprintf("\nRead more: %v", profile.FrontEnd.Post(c))
 	}
 
 	return fmt.Sprintf(`
 **-----**
 %v commented on @%v/%v.
 
+**Link:** %v
 **Content:** %v
 `,
 		steemitLink(c.Author),
-		c.URL,
 		c.ParentAuthor,
 		c.ParentPermlink,
+		profile.FrontEnd.Post(c),
+		extract,
+	)
+}
+
+// CommentThreadReply
+
+func renderCommentThreadReplyEvent(profile *chain.Profile, event *events.CommentThreadReply) string {
+	c := event.Content
+
+	commentLines := make([]string, 0, 5)
+	scanner := bufio.NewScanner(strings.NewReader(c.Body))
+	for scanner.Scan() {
+		commentLines = append(commentLines, scanner.Text())
+	}
+
+	extractLines := commentLines
+	if len(extractLines) > 5 {
+		extractLines = extractLines[:5]
+	}
+
+	extract := strings.Join(extractLines, "\n")
+	if len(commentLines) > 5 {
+		extract += fmt.Sprintf("\nRead more: %v", profile.FrontEnd.Post(c))
+	}
+
+	return fmt.Sprintf(`
+**-----**
+%v replied to @%v/%v in the thread of @%v/%v you are watching.
+
+**Link:** %v
+**Content:** %v
+`,
+		steemitLink(c.Author),
+		c.ParentAuthor,
+		c.ParentPermlink,
+		event.RootAuthor,
+		event.RootPermlink,
+		profile.FrontEnd.Post(c),
 		extract,
 	)
 }
 
 // CommentVoted
 
-func renderCommentVotedEvent(event *events.CommentVoted) string {
+func renderCommentVotedEvent(profile *chain.Profile, event *events.CommentVoted) string {
+	o := event.Op
+	c := event.Content
+
+	action := "cast a vote on"
+	if event.Removed {
+		action = "removed a vote from"
+	}
+
+	return fmt.Sprintf(`
+**-----**
+%v %v a comment @%v/%v.
+
+**Link:** %v
+**Weight:** %v
+**Vote value:** %v
+**Pending Payout:** %v
+`,
+		steemitLink(o.Voter),
+		action,
+		c.Author,
+		c.Permlink,
+		profile.FrontEnd.Post(c),
+		o.Weight,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
+	)
+}
+
+// StoryFlagged
+
+func renderStoryFlaggedEvent(profile *chain.Profile, event *events.StoryFlagged) string {
+	o := event.Op
+	c := event.Content
+
+	action := "flagged"
+	if event.Removed {
+		action = "removed a flag from"
+	}
+
+	return fmt.Sprintf(`
+**-----**
+%v %v a story by %v.
+
+**Title:** %v
+**Link:** %v
+**Vote weight:** %v
+**Flag value:** %v
+**Pending Payout:** %v
+`,
+		steemitLink(o.Voter),
+		action,
+		steemitLink(o.Author),
+		c.Title,
+		profile.FrontEnd.Post(c),
+		o.Weight,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
+	)
+}
+
+// CommentFlagged
+
+func renderCommentFlaggedEvent(profile *chain.Profile, event *events.CommentFlagged) string {
 	o := event.Op
 	c := event.Content
 
+	action := "flagged"
+	if event.Removed {
+		action = "removed a flag from"
+	}
+
 	return fmt.Sprintf(`
 **-----**
-%v cast a vote on a comment @%v/%v.
+%v %v a comment @%v/%v.
 
-**Link:** https://steemit.com%v
+**Link:** %v
 **Weight:** %v
+**Flag value:** %v
 **Pending Payout:** %v
 `,
 		steemitLink(o.Voter),
+		action,
 		c.Author,
 		c.Permlink,
-		c.URL,
+		profile.FrontEnd.Post(c),
 		o.Weight,
-		c.PendingPayoutValue,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
 	)
 }
+
+// ContentMatched
+
+func renderContentMatchedEvent(profile *chain.Profile, event *events.ContentMatched) string {
+	c := event.Content
+
+	what := "comment"
+	title := fmt.Sprintf("@%v/%v", c.Author, c.Permlink)
+	if c.IsStory() {
+		what = "story"
+		title = c.Title
+	}
+
+	return fmt.Sprintf(`
+**-----**
+%v published a %v matching your keywords.
+
+**Title:** %v
+**Link:** %v
+**Matched:** %v
+`,
+		steemitLink(c.Author),
+		what,
+		title,
+		profile.FrontEnd.Post(c),
+		strings.Join(event.Matches, ", "),
+	)
+}
+
+// StoryPayoutSoon
+
+func renderStoryPayoutSoonEvent(profile *chain.Profile, event *events.StoryPayoutSoon) string {
+	c := event.Content
+
+	return fmt.Sprintf(`
+**-----**
+A story by %v pays out in %v.
+
+**Title:** %v
+**Link:** %v
+**Pending Payout:** %v
+**Payout Time:** %v
+`,
+		steemitLink(c.Author),
+		event.FormattedTimeLeft(),
+		c.Title,
+		profile.FrontEnd.Post(c),
+		profile.FormatAmount(c.PendingPayoutValue),
+		event.CashoutTime.UTC().Format(time.RFC1123),
+	)
+}
+
+// AccountThresholdCrossed
+
+func renderAccountThresholdCrossedEvent(profile *chain.Profile, event *events.AccountThresholdCrossed) string {
+	link := profile.FrontEnd.Account(event.Account)
+	if event.Metric == events.MetricBalance {
+		link = profile.FrontEnd.Transfers(event.Account)
+	}
+
+	return fmt.Sprintf(`
+**-----**
+The %v of %v dropped below %v.
+
+**Current value:** %v
+**Link:** %v
+`,
+		event.MetricName(),
+		steemitLink(event.Account),
+		profile.FormatAmount(event.FormattedThreshold()),
+		profile.FormatAmount(event.FormattedValue()),
+		link,
+	)
+}
+
+// PriceAlert
+
+func renderPriceAlertEvent(profile *chain.Profile, event *events.PriceAlert) string {
+	return fmt.Sprintf(`
+**-----**
+%v
+
+**Median price:** %v
+**Previous price:** %v
+`,
+		event.Describe(profile.FormatPrice),
+		profile.FormatPrice(event.Price),
+		profile.FormatPrice(event.PreviousPrice),
+	)
+}
+
+// BlockOrphaned
+
+func renderBlockOrphanedEvent(profile *chain.Profile, event *events.BlockOrphaned) string {
+	return fmt.Sprintf(`
+**-----**
+Block %v was orphaned due to a chain fork.
+The following notifications you received for this block are no longer valid.
+
+**Notifications:** %v
+**Event Kinds:** %v
+`,
+		event.BlockNum,
+		event.Count,
+		strings.Join(event.Kinds, ", "),
+	)
+}
+
+// CatchUpDigest
+
+func renderCatchUpDigestEvent(profile *chain.Profile, event *events.CatchUpDigest) string {
+	return fmt.Sprintf(`
+**-----**
+%v events happened while SteemWatch was catching up.
+
+**From:** %v
+**To:** %v
+
+%v
+`,
+		event.Total(),
+		event.From.UTC().Format(time.RFC1123),
+		event.To.UTC().Format(time.RFC1123),
+		strings.Join(event.Summary(), "\n"),
+	)
+}
+
+// markDelayed makes it clear that the notification is being delivered late.
+func markDelayed(text string, origin *events.Origin) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text + fmt.Sprintf("*Delayed notification, the event happened at %v.*\n",
+		origin.Timestamp.UTC().Format(time.RFC1123))
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 
 	"github.com/pkg/errors"
@@ -54,22 +56,46 @@ func makeMessage(attachment *Attachment) *Payload {
 	}
 }
 
+// markDelayed makes it clear that the notification is being delivered late.
+func markDelayed(payload *Payload, origin *events.Origin) {
+	// Messages without attachments only carry the text.
+	if len(payload.Attachments) == 0 {
+		if payload.Text != "" {
+			payload.Text += "\n"
+		}
+		payload.Text += fmt.Sprintf("_Delayed notification, the event happened at %v._",
+			origin.Timestamp.UTC().Format(time.RFC1123))
+		return
+	}
+
+	for _, attachment := range payload.Attachments {
+		attachment.Footer = "Delayed notification, the event happened earlier"
+		attachment.Timestamp = uint64(origin.Timestamp.Unix())
+	}
+}
+
+// accountLink links the account page in the front-end chosen by the user.
+func accountLink(profile *chain.Profile, account string) string {
+	return fmt.Sprintf("<%v|@%v>", profile.FrontEnd.Account(account), account)
+}
+
 // AccountUpdated
 
-func renderAccountUpdatedEvent(event *events.AccountUpdated) (*Payload, error) {
+func renderAccountUpdatedEvent(profile *chain.Profile, event *events.AccountUpdated) (*Payload, error) {
 	summary := fmt.Sprintf("@%v's account was updated", event.Op.Account)
 
 	return makeMessage(&Attachment{
-		Title:    "Account Update Detected",
-		Fallback: summary,
-		Color:    "#DC143C",
-		Text:     summary,
+		Title:     "Account Update Detected",
+		TitleLink: profile.FrontEnd.Account(event.Op.Account),
+		Fallback:  summary,
+		Color:     "#DC143C",
+		Text:      summary,
 	}), nil
 }
 
 // AccountWitnessVoted
 
-func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) (*Payload, error) {
+func renderAccountWitnessVotedEvent(profile *chain.Profile, event *events.AccountWitnessVoted) (*Payload, error) {
 	var verb string
 	if event.Op.Approve {
 		verb = "approved"
@@ -77,7 +103,8 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) (*Payload
 		verb = "unapproved"
 	}
 
-	txt := fmt.Sprintf("@%v %v witness @%v", event.Op.Account, verb, event.Op.Witness)
+	txt := fmt.Sprintf("%v %v witness %v",
+		accountLink(profile, event.Op.Account), verb, accountLink(profile, event.Op.Witness))
 
 	return &Payload{
 		Text: txt,
@@ -86,15 +113,17 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) (*Payload
 
 // TransferMade
 
-func renderTransferMadeEvent(event *events.TransferMade) (*Payload, error) {
+func renderTransferMadeEvent(profile *chain.Profile, event *events.TransferMade) (*Payload, error) {
 	op := event.Op
 
-	summary := fmt.Sprintf("@%v transferred %v to @%v", op.From, op.Amount, op.To)
+	summary := fmt.Sprintf("@%v transferred %v to @%v", op.From, profile.FormatAmount(op.Amount), op.To)
 
 	attachment := &Attachment{
-		Fallback: summary,
-		Color:    "#00B2EE",
-		Pretext:  "A transfer you are interested in was made.",
+		Fallback:  summary,
+		Color:     "#00B2EE",
+		Pretext:   "A transfer you are interested in was made.",
+		Title:     fmt.Sprintf("Transfers of @%v", op.To),
+		TitleLink: profile.FrontEnd.Transfers(op.To),
 		Fields: []*Field{
 			{
 				Title: "From",
@@ -108,7 +137,7 @@ func renderTransferMadeEvent(event *events.TransferMade) (*Payload, error) {
 			},
 			{
 				Title: "Amount",
-				Value: op.Amount,
+				Value: profile.FormatAmount(op.Amount),
 				Short: true,
 			},
 		},
@@ -124,11 +153,11 @@ func renderTransferMadeEvent(event *events.TransferMade) (*Payload, error) {
 
 // UserMentioned
 
-func renderUserMentionedEvent(event *events.UserMentioned) (*Payload, error) {
+func renderUserMentionedEvent(profile *chain.Profile, event *events.UserMentioned) (*Payload, error) {
 	c := event.Content
 
-	txt := fmt.Sprintf("@%v was <https://steemit.com%v|mentioned> by @%v in %v",
-		event.User, c.URL, c.Author, c.Permlink)
+	txt := fmt.Sprintf("%v was <%v|mentioned> by %v in %v",
+		accountLink(profile, event.User), profile.FrontEnd.Post(c), accountLink(profile, c.Author), c.Permlink)
 
 	return &Payload{
 		Text: txt,
@@ -137,17 +166,20 @@ func renderUserMentionedEvent(event *events.UserMentioned) (*Payload, error) {
 
 // UserFollowStatusChanged
 
-func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) (*Payload, error) {
+func renderUserFollowStatusChangedEvent(profile *chain.Profile, event *events.UserFollowStatusChanged) (*Payload, error) {
 	op := event.Op
 
+	follower := accountLink(profile, op.Follower)
+	following := accountLink(profile, op.Following)
+
 	var txt string
 	switch {
 	case event.Followed():
-		txt = fmt.Sprintf("@%v started following @%v.", op.Follower, op.Following)
+		txt = fmt.Sprintf("%v started following %v.", follower, following)
 	case event.Muted():
-		txt = fmt.Sprintf("@%v muted @%v.", op.Follower, op.Following)
+		txt = fmt.Sprintf("%v muted %v.", follower, following)
 	case event.Reset():
-		txt = fmt.Sprintf("@%v reset the follow status for @%v.", op.Follower, op.Following)
+		txt = fmt.Sprintf("%v reset the follow status for %v.", follower, following)
 	}
 
 	return &Payload{
@@ -157,7 +189,7 @@ func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) (
 
 // StoryPublished
 
-func renderStoryPublishedEvent(event *events.StoryPublished) (*Payload, error) {
+func renderStoryPublishedEvent(profile *chain.Profile, event *events.StoryPublished) (*Payload, error) {
 	c := event.Content
 	r := bufio.NewReader(strings.NewReader(c.Body))
 
@@ -173,11 +205,13 @@ func renderStoryPublishedEvent(event *events.StoryPublished) (*Payload, error) {
 	}
 
 	return makeMessage(&Attachment{
-		Fallback:  fmt.Sprintf(`@%v has published "%v".`, c.Author, c.Title),
-		Color:     "#00C957",
-		Pretext:   fmt.Sprintf("@%v has published or updated a story.", c.Author),
-		Title:     c.Title,
-		TitleLink: "https://steemit.com" + c.URL,
+		Fallback:   fmt.Sprintf(`@%v has published "%v".`, c.Author, c.Title),
+		Color:      "#00C957",
+		Pretext:    fmt.Sprintf("@%v has published or updated a story.", c.Author),
+		AuthorName: "@" + c.Author,
+		AuthorLink: profile.FrontEnd.Account(c.Author),
+		Title:      c.Title,
+		TitleLink:  profile.FrontEnd.Post(c),
 		Fields: []*Field{
 			{
 				Title: "Summary",
@@ -188,33 +222,41 @@ func renderStoryPublishedEvent(event *events.StoryPublished) (*Payload, error) {
 				Value: fmt.Sprintf("%v", c.JsonMetadata.Tags),
 			},
 		},
-		ThumbURL: "https://steemit.com/images/favicons/favicon-96x96.png",
+		ThumbURL: profile.IconURL,
 	}), nil
 }
 
 // StoryVoted
 
-func renderStoryVotedEvent(event *events.StoryVoted) (*Payload, error) {
+func renderStoryVotedEvent(profile *chain.Profile, event *events.StoryVoted) (*Payload, error) {
 	o := event.Op
 	c := event.Content
 
 	evt := fmt.Sprintf("@%v cast a vote on a story by @%v.", o.Voter, o.Author)
+	if event.Removed {
+		evt = fmt.Sprintf("@%v removed a vote from a story by @%v.", o.Voter, o.Author)
+	}
 
 	return makeMessage(&Attachment{
 		Fallback:  evt,
 		Color:     "#BDFCC9",
 		Pretext:   evt,
 		Title:     c.Title,
-		TitleLink: "https://steemit.com" + c.URL,
+		TitleLink: profile.FrontEnd.Post(c),
 		Fields: []*Field{
 			{
 				Title: "Vote Weight",
 				Value: fmt.Sprintf("%v", o.Weight),
 				Short: true,
 			},
+			{
+				Title: "Vote Value",
+				Value: profile.FormatEstimate(event.Value),
+				Short: true,
+			},
 			{
 				Title: "Story Pending Payout",
-				Value: c.PendingPayoutValue,
+				Value: profile.FormatAmount(c.PendingPayoutValue),
 				Short: true,
 			},
 		},
@@ -223,7 +265,7 @@ func renderStoryVotedEvent(event *events.StoryVoted) (*Payload, error) {
 
 // CommentPublished
 
-func renderCommentPublishedEvent(event *events.CommentPublished) (*Payload, error) {
+func renderCommentPublishedEvent(profile *chain.Profile, event *events.CommentPublished) (*Payload, error) {
 	c := event.Content
 
 	commentLines := make([]string, 0, 5)
@@ -242,12 +284,12 @@ func renderCommentPublishedEvent(event *events.CommentPublished) (*Payload, erro
 
 	extract := strings.Join(extractLines, "\n")
 	if len(commentLines) > 5 {
-		extract += fmt.Sprintf("\n<https://steemit.com%v|Read more...>", c.URL)
+		extract += fmt.Sprintf("\n<%v|Read more...>", profile.FrontEnd.Post(c))
 	}
 
 	evt := fmt.Sprintf("@%v commented on @%v/%v", c.Author, c.ParentAuthor, c.ParentPermlink)
-	pre := fmt.Sprintf("@%v <https://steemit.com%v|commented> on @%v/%v",
-		c.Author, c.URL, c.ParentAuthor, c.ParentPermlink)
+	pre := fmt.Sprintf("@%v <%v|commented> on @%v/%v",
+		c.Author, profile.FrontEnd.Post(c), c.ParentAuthor, c.ParentPermlink)
 
 	return makeMessage(&Attachment{
 		Fallback: evt,
@@ -262,29 +304,324 @@ func renderCommentPublishedEvent(event *events.CommentPublished) (*Payload, erro
 	}), nil
 }
 
+// CommentThreadReply
+
+func renderCommentThreadReplyEvent(profile *chain.Profile, event *events.CommentThreadReply) (*Payload, error) {
+	c := event.Content
+
+	commentLines := make([]string, 0, 5)
+	scanner := bufio.NewScanner(strings.NewReader(c.Body))
+	for scanner.Scan() {
+		commentLines = append(commentLines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read comment body")
+	}
+
+	extractLines := commentLines
+	if len(extractLines) > 5 {
+		extractLines = extractLines[:5]
+	}
+
+	extract := strings.Join(extractLines, "\n")
+	if len(commentLines) > 5 {
+		extract += fmt.Sprintf("\n<%v|Read more...>", profile.FrontEnd.Post(c))
+	}
+
+	evt := fmt.Sprintf("@%v replied to @%v/%v in the thread of @%v/%v",
+		c.Author, c.ParentAuthor, c.ParentPermlink, event.RootAuthor, event.RootPermlink)
+	pre := fmt.Sprintf("@%v <%v|replied> to @%v/%v in the <%v|thread> you are watching",
+		c.Author, profile.FrontEnd.Post(c), c.ParentAuthor, c.ParentPermlink, profile.FrontEnd.Post(event.Root()))
+
+	return makeMessage(&Attachment{
+		Fallback: evt,
+		Color:    "#FFB90F",
+		Pretext:  pre,
+		Fields: []*Field{
+			{
+				Title: "Comment Body",
+				Value: extract,
+			},
+		},
+	}), nil
+}
+
 // CommentVoted
 
-func renderCommentVotedEvent(event *events.CommentVoted) (*Payload, error) {
+func renderCommentVotedEvent(profile *chain.Profile, event *events.CommentVoted) (*Payload, error) {
 	o := event.Op
 	c := event.Content
 
 	evt := fmt.Sprintf("@%v cast a vote on comment @%v/%v", o.Voter, o.Author, o.Permlink)
+	if event.Removed {
+		evt = fmt.Sprintf("@%v removed a vote from comment @%v/%v", o.Voter, o.Author, o.Permlink)
+	}
 
 	return makeMessage(&Attachment{
 		Fallback:  evt,
 		Color:     "#FFEBCD",
 		Pretext:   evt,
 		Title:     fmt.Sprintf("@%v/%v", c.Author, c.Permlink),
-		TitleLink: "https://steemit.com" + c.URL,
+		TitleLink: profile.FrontEnd.Post(c),
+		Fields: []*Field{
+			{
+				Title: "Vote Weight",
+				Value: fmt.Sprintf("%v", o.Weight),
+				Short: true,
+			},
+			{
+				Title: "Vote Value",
+				Value: profile.FormatEstimate(event.Value),
+				Short: true,
+			},
+			{
+				Title: "Comment Pending Payout",
+				Value: profile.FormatAmount(c.PendingPayoutValue),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// StoryFlagged
+
+func renderStoryFlaggedEvent(profile *chain.Profile, event *events.StoryFlagged) (*Payload, error) {
+	o := event.Op
+	c := event.Content
+
+	evt := fmt.Sprintf("@%v flagged a story by @%v.", o.Voter, o.Author)
+	if event.Removed {
+		evt = fmt.Sprintf("@%v removed a flag from a story by @%v.", o.Voter, o.Author)
+	}
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     "#B22222",
+		Pretext:   evt,
+		Title:     c.Title,
+		TitleLink: profile.FrontEnd.Post(c),
+		Fields: []*Field{
+			{
+				Title: "Vote Weight",
+				Value: fmt.Sprintf("%v", o.Weight),
+				Short: true,
+			},
+			{
+				Title: "Flag Value",
+				Value: profile.FormatEstimate(event.Value),
+				Short: true,
+			},
+			{
+				Title: "Story Pending Payout",
+				Value: profile.FormatAmount(c.PendingPayoutValue),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// CommentFlagged
+
+func renderCommentFlaggedEvent(profile *chain.Profile, event *events.CommentFlagged) (*Payload, error) {
+	o := event.Op
+	c := event.Content
+
+	evt := fmt.Sprintf("@%v flagged comment @%v/%v", o.Voter, o.Author, o.Permlink)
+	if event.Removed {
+		evt = fmt.Sprintf("@%v removed a flag from comment @%v/%v", o.Voter, o.Author, o.Permlink)
+	}
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     "#CD5C5C",
+		Pretext:   evt,
+		Title:     fmt.Sprintf("@%v/%v", c.Author, c.Permlink),
+		TitleLink: profile.FrontEnd.Post(c),
 		Fields: []*Field{
 			{
 				Title: "Vote Weight",
 				Value: fmt.Sprintf("%v", o.Weight),
 				Short: true,
 			},
+			{
+				Title: "Flag Value",
+				Value: profile.FormatEstimate(event.Value),
+				Short: true,
+			},
 			{
 				Title: "Comment Pending Payout",
-				Value: c.PendingPayoutValue,
+				Value: profile.FormatAmount(c.PendingPayoutValue),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// ContentMatched
+
+func renderContentMatchedEvent(profile *chain.Profile, event *events.ContentMatched) (*Payload, error) {
+	c := event.Content
+
+	what := "comment"
+	title := fmt.Sprintf("@%v/%v", c.Author, c.Permlink)
+	if c.IsStory() {
+		what = "story"
+		title = c.Title
+	}
+
+	evt := fmt.Sprintf("@%v published a %v matching your keywords.", c.Author, what)
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     "#9A32CD",
+		Pretext:   evt,
+		Title:     title,
+		TitleLink: profile.FrontEnd.Post(c),
+		Fields: []*Field{
+			{
+				Title: "Matched",
+				Value: strings.Join(event.Matches, ", "),
+			},
+		},
+	}), nil
+}
+
+// StoryPayoutSoon
+
+func renderStoryPayoutSoonEvent(profile *chain.Profile, event *events.StoryPayoutSoon) (*Payload, error) {
+	c := event.Content
+
+	evt := fmt.Sprintf("A story by @%v pays out in %v.", c.Author, event.FormattedTimeLeft())
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     "#DAA520",
+		Pretext:   evt,
+		Title:     c.Title,
+		TitleLink: profile.FrontEnd.Post(c),
+		Fields: []*Field{
+			{
+				Title: "Pending Payout",
+				Value: profile.FormatAmount(c.PendingPayoutValue),
+				Short: true,
+			},
+			{
+				Title: "Payout Time",
+				Value: event.CashoutTime.UTC().Format(time.RFC1123),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// AccountThresholdCrossed
+
+func renderAccountThresholdCrossedEvent(
+	profile *chain.Profile,
+	event *events.AccountThresholdCrossed,
+) (*Payload, error) {
+	evt := fmt.Sprintf("The %v of @%v dropped below %v.",
+		event.MetricName(), event.Account, profile.FormatAmount(event.FormattedThreshold()))
+
+	link := profile.FrontEnd.Account(event.Account)
+	if event.Metric == events.MetricBalance {
+		link = profile.FrontEnd.Transfers(event.Account)
+	}
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     "#FF8C00",
+		Pretext:   evt,
+		Title:     "@" + event.Account,
+		TitleLink: link,
+		Fields: []*Field{
+			{
+				Title: "Current Value",
+				Value: profile.FormatAmount(event.FormattedValue()),
+				Short: true,
+			},
+			{
+				Title: "Threshold",
+				Value: profile.FormatAmount(event.FormattedThreshold()),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// PriceAlert
+
+func renderPriceAlertEvent(profile *chain.Profile, event *events.PriceAlert) (*Payload, error) {
+	evt := event.Describe(profile.FormatPrice)
+
+	color := "#228B22"
+	if event.Price < event.PreviousPrice {
+		color = "#B22222"
+	}
+
+	return makeMessage(&Attachment{
+		Fallback: evt,
+		Color:    color,
+		Pretext:  evt,
+		Fields: []*Field{
+			{
+				Title: "Median Price",
+				Value: profile.FormatPrice(event.Price),
+				Short: true,
+			},
+			{
+				Title: "Previous Price",
+				Value: profile.FormatPrice(event.PreviousPrice),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// BlockOrphaned
+
+func renderBlockOrphanedEvent(profile *chain.Profile, event *events.BlockOrphaned) (*Payload, error) {
+	evt := fmt.Sprintf("Block %v was orphaned due to a chain fork.", event.BlockNum)
+
+	return makeMessage(&Attachment{
+		Fallback: evt,
+		Color:    "#B22222",
+		Pretext:  evt,
+		Text:     "The following notifications you received for this block are no longer valid.",
+		Fields: []*Field{
+			{
+				Title: "Notifications",
+				Value: fmt.Sprintf("%v", event.Count),
+				Short: true,
+			},
+			{
+				Title: "Event Kinds",
+				Value: strings.Join(event.Kinds, ", "),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// CatchUpDigest
+
+func renderCatchUpDigestEvent(profile *chain.Profile, event *events.CatchUpDigest) (*Payload, error) {
+	evt := fmt.Sprintf("%v events happened while SteemWatch was catching up.", event.Total())
+
+	return makeMessage(&Attachment{
+		Fallback: evt,
+		Color:    "#708090",
+		Pretext:  evt,
+		Text:     strings.Join(event.Summary(), "\n"),
+		Fields: []*Field{
+			{
+				Title: "From",
+				Value: event.From.UTC().Format(time.RFC1123),
+				Short: true,
+			},
+			{
+				Title: "To",
+				Value: event.To.UTC().Format(time.RFC1123),
 				Short: true,
 			},
 		},
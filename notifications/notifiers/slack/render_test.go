@@ -0,0 +1,59 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+func TestMarkDelayed(t *testing.T) {
+	origin := &events.Origin{
+		Timestamp: time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC),
+		Delayed:   true,
+	}
+	const notice = "_Delayed notification, the event happened at Sun, 01 Jan 2017 12:00:00 UTC._"
+
+	testCases := []struct {
+		name    string
+		payload *Payload
+		text    string
+		footers bool
+	}{
+		{
+			name:    "attachments",
+			payload: makeMessage(&Attachment{Text: "Story voted"}),
+			text:    "",
+			footers: true,
+		},
+		{
+			name:    "text only",
+			payload: &Payload{Text: "Story voted"},
+			text:    "Story voted\n" + notice,
+		},
+		{
+			name:    "empty",
+			payload: &Payload{},
+			text:    notice,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			markDelayed(tc.payload, origin)
+
+			if tc.payload.Text != tc.text {
+				t.Errorf("expected text %q, got %q", tc.text, tc.payload.Text)
+			}
+			for _, attachment := range tc.payload.Attachments {
+				if marked := strings.HasPrefix(attachment.Footer, "Delayed"); marked != tc.footers {
+					t.Errorf("expected footer marker to be %v, got %q", tc.footers, attachment.Footer)
+				}
+				if attachment.Timestamp != uint64(origin.Timestamp.Unix()) {
+					t.Errorf("expected timestamp %v, got %v", origin.Timestamp.Unix(), attachment.Timestamp)
+				}
+			}
+		})
+	}
+}
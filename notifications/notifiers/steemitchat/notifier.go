@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/errs"
 	"github.com/tchap/steemwatch/notifications/events"
 
@@ -61,6 +62,7 @@ type Notifier struct {
 	daemonAuthToken string
 
 	webhookTimeout        time.Duration
+	profile               *chain.Profile
 	maxConcurrentRequests uint
 	requestSemaphore      chan struct{}
 	termCh                chan struct{}
@@ -71,6 +73,7 @@ func NewNotifier(daemonUserID string, daemonAuthToken string, opts ...NotifierOp
 		daemonUserID:          daemonUserID,
 		daemonAuthToken:       daemonAuthToken,
 		webhookTimeout:        30 * time.Second,
+		profile:               chain.Steem,
 		maxConcurrentRequests: DefaultMaxConcurrentRequests,
 		termCh:                make(chan struct{}),
 	}
@@ -98,13 +101,21 @@ func SetMaxConcurrentRequests(maxConcurrentRequests uint) NotifierOption {
 	}
 }
 
+// SetChainProfile sets the chain the notifications are rendered for.
+// chain.Steem is used by default.
+func SetChainProfile(profile *chain.Profile) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.profile = profile
+	}
+}
+
 func (notifier *Notifier) DispatchAccountUpdatedEvent(
 	userId string,
 	userSettings bson.Raw,
 	event *events.AccountUpdated,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderAccountUpdatedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderAccountUpdatedEvent(profile, event)
 	})
 }
 
@@ -113,8 +124,8 @@ func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
 	userSettings bson.Raw,
 	event *events.AccountWitnessVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderAccountWitnessVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderAccountWitnessVotedEvent(profile, event)
 	})
 }
 
@@ -123,8 +134,8 @@ func (notifier *Notifier) DispatchTransferMadeEvent(
 	userSettings bson.Raw,
 	event *events.TransferMade,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderTransferMadeEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderTransferMadeEvent(profile, event)
 	})
 }
 
@@ -133,8 +144,8 @@ func (notifier *Notifier) DispatchUserMentionedEvent(
 	userSettings bson.Raw,
 	event *events.UserMentioned,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderUserMentionedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderUserMentionedEvent(profile, event)
 	})
 }
 
@@ -143,8 +154,8 @@ func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
 	userSettings bson.Raw,
 	event *events.UserFollowStatusChanged,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderUserFollowStatusChangedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderUserFollowStatusChangedEvent(profile, event)
 	})
 }
 
@@ -153,8 +164,8 @@ func (notifier *Notifier) DispatchStoryPublishedEvent(
 	userSettings bson.Raw,
 	event *events.StoryPublished,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderStoryPublishedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderStoryPublishedEvent(profile, event)
 	})
 }
 
@@ -163,8 +174,8 @@ func (notifier *Notifier) DispatchStoryVotedEvent(
 	userSettings bson.Raw,
 	event *events.StoryVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderStoryVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderStoryVotedEvent(profile, event)
 	})
 }
 
@@ -173,8 +184,18 @@ func (notifier *Notifier) DispatchCommentPublishedEvent(
 	userSettings bson.Raw,
 	event *events.CommentPublished,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderCommentPublishedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderCommentPublishedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentThreadReplyEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentThreadReply,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderCommentThreadReplyEvent(profile, event)
 	})
 }
 
@@ -183,25 +204,116 @@ func (notifier *Notifier) DispatchCommentVotedEvent(
 	userSettings bson.Raw,
 	event *events.CommentVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderCommentVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderCommentVotedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryFlaggedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryFlagged,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderStoryFlaggedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentFlaggedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentFlagged,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderCommentFlaggedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchContentMatchedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.ContentMatched,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderContentMatchedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryPayoutSoonEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryPayoutSoon,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderStoryPayoutSoonEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountThresholdCrossedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountThresholdCrossed,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderAccountThresholdCrossedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPriceAlertEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PriceAlert,
+) error {
+	return notifier.dispatch(userId, userSettings, &event.Origin, func(profile *chain.Profile) (*Payload, error) {
+		return renderPriceAlertEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockOrphanedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockOrphaned,
+) error {
+	return notifier.dispatch(userId, userSettings, nil, func(profile *chain.Profile) (*Payload, error) {
+		return renderBlockOrphanedEvent(profile, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCatchUpDigestEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CatchUpDigest,
+) error {
+	return notifier.dispatch(userId, userSettings, nil, func(profile *chain.Profile) (*Payload, error) {
+		return renderCatchUpDigestEvent(profile, event)
 	})
 }
 
 func (notifier *Notifier) dispatch(
 	userId string,
 	userSettings bson.Raw,
-	render func() (*Payload, error),
+	origin *events.Origin,
+	render func(*chain.Profile) (*Payload, error),
 ) error {
 	settings, err := UnmarshalSettings(userId, userSettings)
 	if err != nil {
 		return err
 	}
 
-	payload, err := render()
+	// Render the links for the front-end chosen by the user.
+	var preferences chain.Preferences
+	if err := userSettings.Unmarshal(&preferences); err != nil {
+		return errors.Wrap(err, "failed to unmarshal user preferences")
+	}
+	profile := notifier.profile.WithFrontEnd(preferences.FrontEnd)
+
+	payload, err := render(profile)
 	if err != nil {
 		return err
 	}
+	if origin.IsDelayed() {
+		markDelayed(payload, origin)
+	}
 
 	payload.Channel = "@" + settings.Username
 
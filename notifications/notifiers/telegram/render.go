@@ -4,32 +4,34 @@ import (
 	"bufio"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 )
 
-func steemitLink(account string) string {
-	return fmt.Sprintf("[@%v](https://steemit.com/@%v)", account, account)
+func accountLink(profile *chain.Profile, account string) string {
+	return fmt.Sprintf("[@%v](%v)", account, profile.FrontEnd.Account(account))
 }
 
-func steemdLink(account string) string {
-	return fmt.Sprintf("[@%v](https://steemd.com/@%v)", account, account)
+func explorerLink(profile *chain.Profile, account string) string {
+	return fmt.Sprintf("[@%v](%v)", account, profile.ExplorerAccountLink(account))
 }
 
 // AccountUpdated
 
-func renderAccountUpdatedEvent(event *events.AccountUpdated) string {
+func renderAccountUpdatedEvent(profile *chain.Profile, event *events.AccountUpdated) string {
 	return fmt.Sprintf(`
 <=====>
 Account update detected for %v.
 `,
-		steemitLink(event.Op.Account),
+		accountLink(profile, event.Op.Account),
 	)
 }
 
 // AccountWitnessVoted
 
-func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
+func renderAccountWitnessVotedEvent(profile *chain.Profile, event *events.AccountWitnessVoted) string {
 	var verb string
 	if event.Op.Approve {
 		verb = "approved"
@@ -41,57 +43,59 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
 <=====>
 %v %v witness %v.
 `,
-		steemitLink(event.Op.Account),
+		accountLink(profile, event.Op.Account),
 		verb,
-		steemitLink(event.Op.Witness),
+		accountLink(profile, event.Op.Witness),
 	)
 }
 
 // TransferMade
 
-func renderTransferMadeEvent(event *events.TransferMade) string {
+func renderTransferMadeEvent(profile *chain.Profile, event *events.TransferMade) string {
 	op := event.Op
+
+	var memo string
 	if op.Memo != "" {
-		return fmt.Sprintf(`
+		memo = " using memo " + op.Memo
+	}
+
+	return fmt.Sprintf(`
 <=====>
-%v transferred %v to %v using memo %v.
+%v transferred %v to %v%v.
+
+[Transfers of @%v](%v)
 `,
-			steemitLink(op.From),
-			op.Amount,
-			steemitLink(op.To),
-			op.Memo,
-		)
-	}
-	return fmt.Sprintf(
-		"%v transferred %v to %v.",
-		steemitLink(op.From),
-		op.Amount,
-		steemitLink(op.To),
+		accountLink(profile, op.From),
+		profile.FormatAmount(op.Amount),
+		accountLink(profile, op.To),
+		memo,
+		op.To,
+		profile.FrontEnd.Transfers(op.To),
 	)
 }
 
 // UserMentioned
 
-func renderUserMentionedEvent(event *events.UserMentioned) string {
+func renderUserMentionedEvent(profile *chain.Profile, event *events.UserMentioned) string {
 	c := event.Content
 	return fmt.Sprintf(`
 <=====>
 %v was [mentioned](%v) by %v in %v.
 `,
-		steemitLink(event.User),
-		c.URL,
-		steemitLink(c.Author),
+		accountLink(profile, event.User),
+		profile.FrontEnd.Post(c),
+		accountLink(profile, c.Author),
 		c.Permlink,
 	)
 }
 
 // UserFollowStatusChanged
 
-func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) string {
+func renderUserFollowStatusChangedEvent(profile *chain.Profile, event *events.UserFollowStatusChanged) string {
 	op := event.Op
 
-	follower := steemitLink(op.Follower)
-	following := steemitLink(op.Following)
+	follower := accountLink(profile, op.Follower)
+	following := accountLink(profile, op.Following)
 
 	var text string
 	switch {
@@ -108,22 +112,22 @@ func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) s
 
 // StoryPublished
 
-func renderStoryPublishedEvent(event *events.StoryPublished) string {
+func renderStoryPublishedEvent(profile *chain.Profile, event *events.StoryPublished) string {
 	c := event.Content
 
 	summary, _ := bufio.NewReader(strings.NewReader(c.Body)).ReadString('\n')
 
 	return fmt.Sprintf(`
 <=====>
-%v has published or updated a [story](https://steemit.com%v).
+%v has published or updated a [story](%v).
 
 *Title:* %v
 
 *Summary:* %v
 *Tags:* %v
 `,
-		steemitLink(c.Author),
-		c.URL,
+		accountLink(profile, c.Author),
+		profile.FrontEnd.Post(c),
 		c.Title,
 		summary,
 		c.JsonMetadata.Tags,
@@ -132,30 +136,38 @@ func renderStoryPublishedEvent(event *events.StoryPublished) string {
 
 // StoryVoted
 
-func renderStoryVotedEvent(event *events.StoryVoted) string {
+func renderStoryVotedEvent(profile *chain.Profile, event *events.StoryVoted) string {
 	o := event.Op
 	c := event.Content
 
+	action := "cast a vote on"
+	if event.Removed {
+		action = "removed a vote from"
+	}
+
 	return fmt.Sprintf(`
 <=====>
-%v cast a vote on a [story](https://steemit.com%v) by %v.
+%v %v a [story](%v) by %v.
 
 *Title:* %v
 *Vote weight:* %v
+*Vote value:* %v
 *Pending Payout:* %v
 `,
-		steemitLink(o.Voter),
-		c.URL,
-		steemitLink(o.Author),
+		accountLink(profile, o.Voter),
+		action,
+		profile.FrontEnd.Post(c),
+		accountLink(profile, o.Author),
 		c.Title,
 		o.Weight,
-		c.PendingPayoutValue,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
 	)
 }
 
 // CommentPublished
 
-func renderCommentPublishedEvent(event *events.CommentPublished) string {
+func renderCommentPublishedEvent(profile *chain.Profile, event *events.CommentPublished) string {
 	c := event.Content
 
 	commentLines := make([]string, 0, 5)
@@ -171,40 +183,276 @@ func renderCommentPublishedEvent(event *events.CommentPublished) string {
 
 	extract := strings.Join(extractLines, "\n")
 	if len(commentLines) > 5 {
-		extract += fmt.Sprintf("\n<https://steemit.com%v|Read more...>", c.URL)
+		extract += fmt.Sprintf("\n[Read more...](%v)", profile.FrontEnd.Post(c))
 	}
 
 	return fmt.Sprintf(`
 <=====>
-%v added a [comment](https://steemit.com%v) to @%v/%v.
+%v added a [comment](%v) to @%v/%v.
 
 *Content:* %v
 `,
-		steemitLink(c.Author),
-		c.URL,
+		accountLink(profile, c.Author),
+		profile.FrontEnd.Post(c),
 		c.ParentAuthor,
 		c.ParentPermlink,
 		extract,
 	)
 }
 
+// CommentThreadReply
+
+func renderCommentThreadReplyEvent(profile *chain.Profile, event *events.CommentThreadReply) string {
+	c := event.Content
+
+	commentLines := make([]string, 0, 5)
+	scanner := bufio.NewScanner(strings.NewReader(c.Body))
+	for scanner.Scan() {
+		commentLines = append(commentLines, scanner.Text())
+	}
+
+	extractLines := commentLines
+	if len(extractLines) > 5 {
+		extractLines = extractLines[:5]
+	}
+
+	extract := strings.Join(extractLines, "\n")
+	if len(commentLines) > 5 {
+		extract += fmt.Sprintf("\n[Read more...](%v)", profile.FrontEnd.Post(c))
+	}
+
+	return fmt.Sprintf(`
+<=====>
+%v added a [reply](%v) to @%v/%v in the [thread](%v) you are watching.
+
+*Content:* %v
+`,
+		accountLink(profile, c.Author),
+		profile.FrontEnd.Post(c),
+		c.ParentAuthor,
+		c.ParentPermlink,
+		profile.FrontEnd.Post(event.Root()),
+		extract,
+	)
+}
+
 // CommentVoted
 
-func renderCommentVotedEvent(event *events.CommentVoted) string {
+func renderCommentVotedEvent(profile *chain.Profile, event *events.CommentVoted) string {
 	o := event.Op
 	c := event.Content
 
+	action := "cast a vote on"
+	if event.Removed {
+		action = "removed a vote from"
+	}
+
 	return fmt.Sprintf(`
 <=====>
-%v cast a vote on a [comment](https://steemit.com%v) by %v.
+%v %v a [comment](%v) by %v.
 
 *Weight:* %v
+*Vote value:* %v
+*Pending Payout:* %v
+`,
+		accountLink(profile, o.Voter),
+		action,
+		profile.FrontEnd.Post(c),
+		accountLink(profile, o.Author),
+		o.Weight,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
+	)
+}
+
+// StoryFlagged
+
+func renderStoryFlaggedEvent(profile *chain.Profile, event *events.StoryFlagged) string {
+	o := event.Op
+	c := event.Content
+
+	action := "flagged"
+	if event.Removed {
+		action = "removed a flag from"
+	}
+
+	return fmt.Sprintf(`
+<=====>
+%v %v a [story](%v) by %v.
+
+*Title:* %v
+*Vote weight:* %v
+*Flag value:* %v
 *Pending Payout:* %v
 `,
-		steemitLink(o.Voter),
-		c.URL,
-		steemitLink(o.Author),
+		accountLink(profile, o.Voter),
+		action,
+		profile.FrontEnd.Post(c),
+		accountLink(profile, o.Author),
+		c.Title,
 		o.Weight,
-		c.PendingPayoutValue,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
 	)
 }
+
+// CommentFlagged
+
+func renderCommentFlaggedEvent(profile *chain.Profile, event *events.CommentFlagged) string {
+	o := event.Op
+	c := event.Content
+
+	action := "flagged"
+	if event.Removed {
+		action = "removed a flag from"
+	}
+
+	return fmt.Sprintf(`
+<=====>
+%v %v a [comment](%v) by %v.
+
+*Weight:* %v
+*Flag value:* %v
+*Pending Payout:* %v
+`,
+		accountLink(profile, o.Voter),
+		action,
+		profile.FrontEnd.Post(c),
+		accountLink(profile, o.Author),
+		o.Weight,
+		profile.FormatEstimate(event.Value),
+		profile.FormatAmount(c.PendingPayoutValue),
+	)
+}
+
+// ContentMatched
+
+func renderContentMatchedEvent(profile *chain.Profile, event *events.ContentMatched) string {
+	c := event.Content
+
+	what := "comment"
+	title := fmt.Sprintf("@%v/%v", c.Author, c.Permlink)
+	if c.IsStory() {
+		what = "story"
+		title = c.Title
+	}
+
+	return fmt.Sprintf(`
+<=====>
+%v published a [%v](%v) matching your keywords.
+
+*Title:* %v
+*Matched:* %v
+`,
+		accountLink(profile, c.Author),
+		what,
+		profile.FrontEnd.Post(c),
+		title,
+		strings.Join(event.Matches, ", "),
+	)
+}
+
+// StoryPayoutSoon
+
+func renderStoryPayoutSoonEvent(profile *chain.Profile, event *events.StoryPayoutSoon) string {
+	c := event.Content
+
+	return fmt.Sprintf(`
+<=====>
+A [story](%v) by %v pays out in %v.
+
+*Title:* %v
+*Pending Payout:* %v
+*Payout Time:* %v
+`,
+		profile.FrontEnd.Post(c),
+		accountLink(profile, c.Author),
+		event.FormattedTimeLeft(),
+		c.Title,
+		profile.FormatAmount(c.PendingPayoutValue),
+		event.CashoutTime.UTC().Format(time.RFC1123),
+	)
+}
+
+// AccountThresholdCrossed
+
+func renderAccountThresholdCrossedEvent(profile *chain.Profile, event *events.AccountThresholdCrossed) string {
+	link := profile.FrontEnd.Account(event.Account)
+	if event.Metric == events.MetricBalance {
+		link = profile.FrontEnd.Transfers(event.Account)
+	}
+
+	return fmt.Sprintf(`
+<=====>
+The %v of [@%v](%v) dropped below %v.
+
+*Current value:* %v
+`,
+		event.MetricName(),
+		event.Account,
+		link,
+		profile.FormatAmount(event.FormattedThreshold()),
+		profile.FormatAmount(event.FormattedValue()),
+	)
+}
+
+// PriceAlert
+
+func renderPriceAlertEvent(profile *chain.Profile, event *events.PriceAlert) string {
+	return fmt.Sprintf(`
+<=====>
+%v
+
+*Median price:* %v
+*Previous price:* %v
+`,
+		event.Describe(profile.FormatPrice),
+		profile.FormatPrice(event.Price),
+		profile.FormatPrice(event.PreviousPrice),
+	)
+}
+
+// BlockOrphaned
+
+func renderBlockOrphanedEvent(profile *chain.Profile, event *events.BlockOrphaned) string {
+	return fmt.Sprintf(`
+<=====>
+Block %v was orphaned due to a chain fork.
+The following notifications you received for this block are no longer valid.
+
+*Notifications:* %v
+*Event Kinds:* %v
+`,
+		event.BlockNum,
+		event.Count,
+		strings.Join(event.Kinds, ", "),
+	)
+}
+
+// CatchUpDigest
+
+func renderCatchUpDigestEvent(profile *chain.Profile, event *events.CatchUpDigest) string {
+	return fmt.Sprintf(`
+<=====>
+%v events happened while SteemWatch was catching up.
+
+*From:* %v
+*To:* %v
+
+%v
+`,
+		event.Total(),
+		event.From.UTC().Format(time.RFC1123),
+		event.To.UTC().Format(time.RFC1123),
+		strings.Join(event.Summary(), "\n"),
+	)
+}
+
+// markDelayed makes it clear that the notification is being delivered late.
+func markDelayed(text string, origin *events.Origin) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text + fmt.Sprintf("_Delayed notification, the event happened at %v._\n",
+		origin.Timestamp.UTC().Format(time.RFC1123))
+}
@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+func TestMarkDelayed(t *testing.T) {
+	origin := &events.Origin{
+		Timestamp: time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC),
+		Delayed:   true,
+	}
+	const notice = "_Delayed notification, the event happened at Sun, 01 Jan 2017 12:00:00 UTC._\n"
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"text ending with a newline", "Story voted\n", "Story voted\n" + notice},
+		{"text without a trailing newline", "Story voted", "Story voted\n" + notice},
+		{"empty", "", notice},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if text := markDelayed(tc.text, origin); text != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, text)
+			}
+		})
+	}
+}
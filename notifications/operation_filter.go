@@ -0,0 +1,121 @@
+package notifications
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/go-steem/rpc/types"
+)
+
+// SetOperationFilter enables or disables dropping the operations no subscription can match
+// before the associated content is fetched and the events are mined. Enabled by default.
+func SetOperationFilter(enabled bool) Option {
+	return func(processor *BlockProcessor) {
+		processor.filterOperations = enabled
+	}
+}
+
+var mentionRegexp = regexp.MustCompile(`@([a-z0-9\-]+)`)
+
+// isRelevant returns false in case no subscription can match any event mined from the operation.
+//
+// The check is conservative, i.e. true is returned whenever the answer cannot be known
+// without fetching the associated content. The values checked are the ones used in matchCriteria,
+// so the two must be kept in sync.
+func (processor *BlockProcessor) isRelevant(op types.Operation) bool {
+	if !processor.filterOperations {
+		return true
+	}
+
+	index := processor.index
+	switch body := op.Data().(type) {
+	case *types.AccountUpdateOperation:
+		return index.Contains("account.updated", "accounts", body.Account)
+
+	case *types.AccountWitnessVoteOperation:
+		return index.Contains("account.witness_voted", "accounts", body.Account) ||
+			index.Contains("account.witness_voted", "witnesses", body.Witness)
+
+	case *types.TransferOperation:
+		return index.Contains("transfer.made", "from", body.From) ||
+			index.Contains("transfer.made", "to", body.To)
+
+	case *types.VoteOperation:
+		for _, kind := range []string{"story.voted", "comment.voted", "story.flagged", "comment.flagged"} {
+			if index.Contains(kind, "authors", body.Author) ||
+				index.Contains(kind, "voters", body.Voter) {
+				return true
+			}
+		}
+		// The flags recorded must be forgotten once replaced.
+		return processor.flags.Contains(body)
+
+	case *types.CustomJSONOperation:
+		return index.HasKind("user.follow_changed")
+
+	case *types.CommentOperation:
+		return processor.isRelevantComment(body)
+
+	default:
+		return true
+	}
+}
+
+func (processor *BlockProcessor) isRelevantComment(op *types.CommentOperation) bool {
+	index := processor.index
+
+	// Edits only carry a patch, the text is only known once the content is fetched.
+	isPatch := strings.HasPrefix(op.Body, "@@ ")
+
+	// user.mentioned
+	if index.HasKind("user.mentioned") {
+		if isPatch {
+			return true
+		}
+		for _, m := range mentionRegexp.FindAllStringSubmatch(op.Body, -1) {
+			if index.Contains("user.mentioned", "users", m[1]) {
+				return true
+			}
+		}
+	}
+
+	// content.matched, edits carrying a patch are not matched again
+	if index.HasKind("content.matched") && !isPatch {
+		if len(index.MatchContent(op.Title+"\n"+op.Body)) != 0 {
+			return true
+		}
+	}
+
+	// story.published, story.payout_soon
+	if op.ParentAuthor == "" {
+		if index.Contains("story.published", "authors", op.Author) ||
+			index.Contains("story.payout_soon", "authors", op.Author) {
+			return true
+		}
+		if index.HasList("story.published", "tags") {
+			var metadata struct {
+				Tags []string `json:"tags"`
+			}
+			if err := json.Unmarshal([]byte(op.JsonMetadata), &metadata); err != nil {
+				return true
+			}
+			for _, tag := range metadata.Tags {
+				if index.Contains("story.published", "tags", tag) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	// comment.published
+	if index.Contains("comment.published", "authors", op.Author) ||
+		index.Contains("comment.published", "parentAuthors", op.ParentAuthor) {
+		return true
+	}
+
+	// Thread watches are keyed by the root post, which is only known from the content.
+	// The thread is also to be watched in case the comment author is owned by any user.
+	return index.HasThreadWatches() || len(index.AccountOwners(op.Author)) != 0
+}
@@ -0,0 +1,120 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultPayoutReminderLeadTime = 12 * time.Hour
+
+// SetPayoutReminderLeadTime sets how long before the payout story.payout_soon is fired.
+func SetPayoutReminderLeadTime(leadTime time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.payoutReminderLeadTime = leadTime
+	}
+}
+
+// payoutReminderWatchers returns the users watching the payouts of the given author.
+func (processor *BlockProcessor) payoutReminderWatchers(author string) []bson.ObjectId {
+	return processor.index.Match(&Criteria{
+		Kind: "story.payout_soon",
+		Include: map[string][]string{
+			"authors": {author},
+		},
+	})
+}
+
+// schedulePayoutReminders schedules story.payout_soon for the users watching the story author.
+// Publishing the story again, i.e. editing it, only updates the scheduled events.
+// Nothing is written to the database in case this is a dry run.
+func (processor *BlockProcessor) schedulePayoutReminders(event *events.StoryPublished) error {
+	if processor.dryRun != nil {
+		return nil
+	}
+
+	c := event.Content
+	owners := processor.payoutReminderWatchers(c.Author)
+	if len(owners) == 0 {
+		return nil
+	}
+
+	// The cashout time is in the past for stories already paid out.
+	if c.CashoutTime == nil || c.CashoutTime.Time == nil {
+		return nil
+	}
+	fireAt := c.CashoutTime.Add(-processor.payoutReminderLeadTime)
+	if !fireAt.After(time.Now()) {
+		return nil
+	}
+
+	for _, ownerId := range owners {
+		err := processor.scheduler.Schedule(&ScheduledEvent{
+			Kind:    "story.payout_soon",
+			OwnerId: ownerId,
+			Key:     c.Author + "/" + c.Permlink,
+			Args: map[string]string{
+				"author":   c.Author,
+				"permlink": c.Permlink,
+			},
+			FireAt: fireAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firePayoutReminder returns the handler dispatching the scheduled story.payout_soon events.
+// The story is fetched again so that the current pending payout is sent.
+func (processor *BlockProcessor) firePayoutReminder(client *rpc.Client) scheduledEventHandler {
+	return func(scheduled *ScheduledEvent) error {
+		author, permlink := scheduled.Args["author"], scheduled.Args["permlink"]
+
+		// Make sure the user is still watching the author.
+		watching := false
+		for _, ownerId := range processor.payoutReminderWatchers(author) {
+			if ownerId == scheduled.OwnerId {
+				watching = true
+				break
+			}
+		}
+		if !watching {
+			return nil
+		}
+
+		content, err := client.Database.GetContent(author, permlink)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get content @%v/%v", author, permlink)
+		}
+
+		// Skip stories that were deleted or already paid out.
+		now := time.Now()
+		if content.Author == "" || content.CashoutTime == nil || content.CashoutTime.Time == nil ||
+			!content.CashoutTime.After(now) {
+			return nil
+		}
+
+		event := &events.StoryPayoutSoon{
+			Content:     content,
+			CashoutTime: *content.CashoutTime.Time,
+			Origin: events.Origin{
+				Key:       "scheduledEvents:" + scheduled.Id.Hex(),
+				Timestamp: now,
+			},
+		}
+		// The event is fired again once the lease expires in case the dispatch fails.
+		dispatched := processor.dispatchDetached(&event.Origin, func() {
+			processor.DispatchStoryPayoutSoonEvent(scheduled.OwnerId.Hex(), event)
+		})
+		if !dispatched {
+			return errors.Errorf("failed to dispatch payout reminder for @%v/%v", author, permlink)
+		}
+		return nil
+	}
+}
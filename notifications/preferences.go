@@ -0,0 +1,50 @@
+package notifications
+
+import (
+	"github.com/tchap/steemwatch/chain"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// bsonDocumentKind is the BSON element kind of an embedded document.
+const bsonDocumentKind = 0x03
+
+// withPreferences returns the notifier settings extended with the chain preferences
+// of the user, the notifiers unmarshal them into chain.Preferences to render the links.
+//
+// The settings are returned unchanged in case the user has no preferences set.
+func withPreferences(settings bson.Raw, preferences *chain.Preferences) (bson.Raw, error) {
+	if preferences.FrontEnd == nil {
+		return settings, nil
+	}
+
+	var doc bson.D
+	if len(settings.Data) != 0 {
+		if err := settings.Unmarshal(&doc); err != nil {
+			return settings, errors.Wrap(err, "failed to unmarshal notifier settings")
+		}
+	}
+
+	// Replace any existing value so that the notifier settings cannot shadow the preferences.
+	extended := make(bson.D, 0, len(doc)+1)
+	for _, elem := range doc {
+		if elem.Name != "frontEnd" {
+			extended = append(extended, elem)
+		}
+	}
+	extended = append(extended, bson.DocElem{Name: "frontEnd", Value: preferences.FrontEnd})
+
+	data, err := bson.Marshal(extended)
+	if err != nil {
+		return settings, errors.Wrap(err, "failed to marshal notifier settings")
+	}
+	return bson.Raw{Kind: bsonDocumentKind, Data: data}, nil
+}
+
+// userPreferences returns the chain preferences of the given user.
+func (processor *BlockProcessor) userPreferences(ownerId bson.ObjectId) *chain.Preferences {
+	return &chain.Preferences{
+		FrontEnd: processor.chainProfile.ResolveFrontEnd(processor.index.FrontEnd(ownerId)),
+	}
+}
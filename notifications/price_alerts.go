@@ -0,0 +1,347 @@
+package notifications
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DefaultPricePollInterval = 5 * time.Minute
+	DefaultPriceMoveWindow   = time.Hour
+)
+
+// priceHistoryTTL is how long the price points are kept.
+// Price moves can only be watched within windows shorter than that.
+const priceHistoryTTL = 30 * 24 * time.Hour
+
+// SetPriceFeedPolling enables price.alert.
+//
+// The median price feed is fetched using the given caller every interval
+// and it is recorded in the priceHistory collection.
+// The processor takes ownership of the caller and closes it on exit.
+func SetPriceFeedPolling(caller interfaces.CallCloser, interval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.pricePollCaller = caller
+		processor.pricePollInterval = interval
+	}
+}
+
+// PricePoint is the median price feed observed at the given time.
+// Price is the price of the core asset in the dollar asset, i.e. Base / Quote.
+type PricePoint struct {
+	Id    bson.ObjectId `bson:"_id,omitempty"`
+	At    time.Time     `bson:"at"`
+	Price float64       `bson:"price"`
+	Base  string        `bson:"base"`
+	Quote string        `bson:"quote"`
+}
+
+// priceRule is a single entry of a price.alert subscription.
+type priceRule struct {
+	kind    string
+	level   float64
+	percent float64
+	window  time.Duration
+}
+
+// key identifies the rule within the subscription.
+func (rule *priceRule) key() string {
+	if rule.kind == events.PriceMove {
+		return fmt.Sprintf("%v:%v/%v", rule.kind, rule.percent, rule.window)
+	}
+	return fmt.Sprintf("%v:%v", rule.kind, rule.level)
+}
+
+// parsePriceRules parses the price.alert subscription lists:
+//
+//	above: price levels, e.g. 1.05
+//	below: price levels, e.g. 0.95
+//	moves: percentages with an optional window, e.g. 5 or 10/24h
+//
+// The entries that cannot be parsed are skipped.
+func parsePriceRules(sub *Subscription) []*priceRule {
+	var rules []*priceRule
+
+	for _, kind := range []string{events.PriceAbove, events.PriceBelow} {
+		for _, entry := range sub.Lists[kind] {
+			level, err := strconv.ParseFloat(strings.TrimSpace(entry), 64)
+			if err != nil || level <= 0 {
+				continue
+			}
+			rules = append(rules, &priceRule{kind: kind, level: level})
+		}
+	}
+
+	for _, entry := range sub.Lists["moves"] {
+		var (
+			parts  = strings.SplitN(strings.TrimSpace(entry), "/", 2)
+			window = DefaultPriceMoveWindow
+		)
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(parts[0], "%"), 64)
+		if err != nil || percent <= 0 {
+			continue
+		}
+		if len(parts) == 2 {
+			window, err = time.ParseDuration(parts[1])
+			if err != nil || window <= 0 || window > priceHistoryTTL {
+				continue
+			}
+		}
+		rules = append(rules, &priceRule{kind: events.PriceMove, percent: percent, window: window})
+	}
+
+	return rules
+}
+
+// startPriceWatcher starts polling the median price feed, if enabled.
+func (processor *BlockProcessor) startPriceWatcher() error {
+	caller := processor.pricePollCaller
+	if caller == nil {
+		return nil
+	}
+
+	// The alerts are not retried when failing, the price moves on anyway.
+	dispatch := func(userId string, event *events.PriceAlert) {
+		processor.dispatchDetached(&event.Origin, func() {
+			processor.DispatchPriceAlertEvent(userId, event)
+		})
+	}
+
+	watcher, err := newPriceWatcher(
+		processor.db, caller, processor.index, dispatch,
+		processor.logger.WithField("component", "price_watcher"))
+	if err != nil {
+		caller.Close()
+		return err
+	}
+	processor.t.Go(func() error {
+		defer caller.Close()
+		return watcher.loop(processor.pricePollInterval, processor.t.Dying())
+	})
+	return nil
+}
+
+// priceWatcher records the median price feed and fires price.alert
+// every time the price changes in a way the users are interested in.
+type priceWatcher struct {
+	c        *mgo.Collection
+	caller   interfaces.Caller
+	index    *subscriptionIndex
+	dispatch func(userId string, event *events.PriceAlert)
+	logger   *logrus.Entry
+
+	last *PricePoint
+}
+
+func newPriceWatcher(
+	db *mgo.Database,
+	caller interfaces.Caller,
+	index *subscriptionIndex,
+	dispatch func(userId string, event *events.PriceAlert),
+	logger *logrus.Entry,
+) (*priceWatcher, error) {
+
+	c := db.C("priceHistory")
+
+	// The documents are removed by MongoDB once expired.
+	err := c.EnsureIndex(mgo.Index{
+		Key:         []string{"at"},
+		Background:  true,
+		ExpireAfter: priceHistoryTTL,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create index for priceHistory.at")
+	}
+
+	// Continue from the last price recorded.
+	var last PricePoint
+	if err := c.Find(nil).Sort("-at").One(&last); err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Wrap(err, "failed to load the last price point")
+	}
+
+	watcher := &priceWatcher{
+		c:        c,
+		caller:   caller,
+		index:    index,
+		dispatch: dispatch,
+		logger:   logger,
+	}
+	if last.Id != "" {
+		watcher.last = &last
+	}
+	return watcher, nil
+}
+
+func (watcher *priceWatcher) loop(interval time.Duration, dying <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := watcher.poll(); err != nil {
+			watcher.logger.WithError(err).Warn("Failed checking the median price feed")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-dying:
+			return nil
+		}
+	}
+}
+
+func (watcher *priceWatcher) poll() error {
+	var median struct {
+		Base  string `json:"base"`
+		Quote string `json:"quote"`
+	}
+	if err := watcher.caller.Call("get_current_median_history_price", []interface{}{}, &median); err != nil {
+		return errors.Wrap(err, "failed to get the current median history price")
+	}
+
+	base, err := parseAmount(median.Base)
+	if err != nil {
+		return errors.Wrap(err, "invalid median price base")
+	}
+	quote, err := parseAmount(median.Quote)
+	if err != nil || quote <= 0 {
+		return errors.Errorf("invalid median price quote: %v", median.Quote)
+	}
+
+	// Only the changes are recorded.
+	price := base / quote
+	if watcher.last != nil && watcher.last.Price == price {
+		return nil
+	}
+
+	point := &PricePoint{
+		Id:    bson.NewObjectId(),
+		At:    time.Now(),
+		Price: price,
+		Base:  median.Base,
+		Quote: median.Quote,
+	}
+	if err := watcher.c.Insert(point); err != nil {
+		return errors.Wrap(err, "failed to record price point")
+	}
+
+	previous := watcher.last
+	watcher.last = point
+	if previous == nil {
+		return nil
+	}
+
+	watcher.logger.WithFields(logrus.Fields{
+		"price":    price,
+		"previous": previous.Price,
+	}).Debug("Median price changed")
+
+	return watcher.evaluate(previous, point)
+}
+
+// evaluate fires the alerts triggered by the price changing from previous to current.
+//
+// A level alert fires when the price crosses the level. A move alert fires when the move
+// within the window crosses the percentage, i.e. it only fires again once the move
+// drops under the percentage and exceeds it again later.
+func (watcher *priceWatcher) evaluate(previous, current *PricePoint) error {
+	type moves struct {
+		current  float64
+		previous float64
+		ok       bool
+	}
+	windows := make(map[time.Duration]*moves)
+
+	// movesWithin returns the moves within the window as of the previous and the current point.
+	movesWithin := func(window time.Duration) (*moves, error) {
+		if m, ok := windows[window]; ok {
+			return m, nil
+		}
+
+		m := &moves{}
+		windows[window] = m
+
+		currentBase, err := watcher.priceAt(current.At.Add(-window))
+		if err != nil || currentBase == nil {
+			return m, err
+		}
+		previousBase, err := watcher.priceAt(previous.At.Add(-window))
+		if err != nil || previousBase == nil {
+			return m, err
+		}
+
+		m.current = 100 * (current.Price - currentBase.Price) / currentBase.Price
+		m.previous = 100 * (previous.Price - previousBase.Price) / previousBase.Price
+		m.ok = true
+		return m, nil
+	}
+
+	for _, sub := range watcher.index.Subscriptions("price.alert") {
+		for _, rule := range parsePriceRules(sub) {
+			event := &events.PriceAlert{
+				Kind:          rule.kind,
+				Price:         current.Price,
+				PreviousPrice: previous.Price,
+				Origin: events.Origin{
+					Key:       fmt.Sprintf("priceHistory:%v:%v", current.Id.Hex(), rule.key()),
+					Timestamp: current.At,
+				},
+			}
+
+			switch rule.kind {
+			case events.PriceAbove:
+				if !(previous.Price < rule.level && current.Price >= rule.level) {
+					continue
+				}
+				event.Level = rule.level
+
+			case events.PriceBelow:
+				if !(previous.Price > rule.level && current.Price <= rule.level) {
+					continue
+				}
+				event.Level = rule.level
+
+			case events.PriceMove:
+				m, err := movesWithin(rule.window)
+				if err != nil {
+					return err
+				}
+				if !m.ok {
+					continue
+				}
+				up := m.current >= rule.percent && m.previous < rule.percent
+				down := m.current <= -rule.percent && m.previous > -rule.percent
+				if !up && !down {
+					continue
+				}
+				event.Percent = rule.percent
+				event.Window = rule.window
+				event.Change = m.current
+			}
+
+			watcher.dispatch(sub.OwnerId.Hex(), event)
+		}
+	}
+	return nil
+}
+
+// priceAt returns the price valid at the given time, nil when not known.
+func (watcher *priceWatcher) priceAt(t time.Time) (*PricePoint, error) {
+	var point PricePoint
+	if err := watcher.c.Find(bson.M{"at": bson.M{"$lte": t}}).Sort("-at").One(&point); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get price point")
+	}
+	return &point, nil
+}
@@ -0,0 +1,35 @@
+package notifications
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type blockProgress struct {
+	timestamp   time.Time
+	processedAt time.Time
+}
+
+var progress atomic.Value
+
+// recordProgress is called every time a block is processed
+// together with all the blocks preceding it.
+func recordProgress(config *BlockProcessorConfig) {
+	lastBlockNum.Set(float64(config.NextBlockNum - 1))
+
+	var timestamp time.Time
+	if ts := config.LastBlockTimestamp; ts != nil {
+		timestamp = *ts
+	}
+	progress.Store(&blockProgress{timestamp, time.Now()})
+}
+
+// LastBlock returns the timestamp of the last processed block and the time it was processed at.
+// Zero values are returned in case no block has been processed yet.
+func LastBlock() (timestamp, processedAt time.Time) {
+	p, ok := progress.Load().(*blockProgress)
+	if !ok {
+		return time.Time{}, time.Time{}
+	}
+	return p.timestamp, p.processedAt
+}
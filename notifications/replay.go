@@ -0,0 +1,125 @@
+package notifications
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc"
+	"github.com/pkg/errors"
+	"github.com/steemwatch/blockfetcher"
+	"gopkg.in/mgo.v2"
+)
+
+type blockRange struct {
+	from uint32
+	to   uint32
+}
+
+// SetBlockRange makes the processor handle the given block range only.
+// The BlockProcessor checkpoint is neither loaded nor stored in that case.
+func SetBlockRange(from, to uint32) Option {
+	return func(processor *BlockProcessor) {
+		processor.blockRange = &blockRange{from, to}
+	}
+}
+
+// PlannedDelivery describes a notification that would be sent in case this was not a dry run.
+type PlannedDelivery struct {
+	UserId     string
+	NotifierId string
+	Kind       string
+	Origin     events.Origin
+}
+
+// SetDryRun makes the processor pass the deliveries to the given function
+// instead of dispatching them. Thread watches are not stored either.
+func SetDryRun(report func(*PlannedDelivery)) Option {
+	return func(processor *BlockProcessor) {
+		processor.dryRun = report
+	}
+}
+
+// RestrictToUser makes the processor drop notifications for all other users.
+func RestrictToUser(userId string) Option {
+	return func(processor *BlockProcessor) {
+		processor.onlyUserId = userId
+	}
+}
+
+// DispatchError is returned by Replay in case some of the notifications could not be dispatched.
+type DispatchError struct {
+	Failed int
+}
+
+func (err *DispatchError) Error() string {
+	return fmt.Sprintf("%v notifications could not be dispatched", err.Failed)
+}
+
+// Replay processes the given block range, blocking until all the notifications are dispatched.
+// Only irreversible blocks are processed and the BlockProcessor checkpoint is not touched.
+//
+// The processor takes ownership of the notifiers and the callers passed using the options,
+// i.e. the options cannot be used for another Replay call.
+// *DispatchError is returned in case any notification could not be dispatched.
+func Replay(
+	client *rpc.Client,
+	connect ConnectFunc,
+	db *mgo.Database,
+	from uint32,
+	to uint32,
+	opts ...Option,
+) error {
+
+	if from == 0 || to < from {
+		return errors.Errorf("invalid block range: %v-%v", from, to)
+	}
+
+	opts = append(opts, SetBlockRange(from, to), SetMode(ModeIrreversible))
+
+	processor, err := New(client, connect, db, opts...)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := blockfetcher.Run(client, processor)
+	if err != nil {
+		processor.Finalize()
+		return err
+	}
+	if err := ctx.Wait(); err != nil {
+		processor.Finalize()
+		return err
+	}
+
+	if err := processor.Drain(); err != nil {
+		processor.Finalize()
+		return err
+	}
+	if err := processor.Finalize(); err != nil {
+		return err
+	}
+
+	if n := atomic.LoadInt32(&processor.dispatchFailures); n != 0 {
+		return &DispatchError{int(n)}
+	}
+	return nil
+}
+
+// Drain blocks until all the blocks handed over to the processor are processed
+// and all the resulting notifications are dispatched.
+func (processor *BlockProcessor) Drain() error {
+	drained := make(chan struct{})
+	go func() {
+		processor.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-processor.t.Dying():
+		return processor.t.Wait()
+	}
+}
@@ -0,0 +1,37 @@
+// Package revision keeps track of the subscriptions revision.
+//
+// The block processor keeps subscriptions, notifiers and user profiles in memory
+// and it reloads them every time the revision changes. The server touches
+// the revision every time the user configuration is modified.
+package revision
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SubscriptionsId is the ID of the configuration document holding the subscriptions revision.
+const SubscriptionsId = "Subscriptions"
+
+// Touch increments the subscriptions revision.
+func Touch(mongo *mgo.Database) error {
+	_, err := mongo.C("configuration").UpsertId(SubscriptionsId, bson.M{
+		"$inc": bson.M{
+			"revision": 1,
+		},
+	})
+	return errors.Wrap(err, "failed to increment subscriptions revision")
+}
+
+// Get returns the current subscriptions revision, 0 in case it has never been touched.
+func Get(mongo *mgo.Database) (int, error) {
+	var doc struct {
+		Revision int `bson:"revision"`
+	}
+	err := mongo.C("configuration").FindId(SubscriptionsId).One(&doc)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, errors.Wrap(err, "failed to get subscriptions revision")
+	}
+	return doc.Revision, nil
+}
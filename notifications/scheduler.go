@@ -0,0 +1,243 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultSchedulerPollInterval = 30 * time.Second
+
+const (
+	// scheduledEventLease is for how long a claimed event is not fired again.
+	// The event is retried once the lease expires, e.g. after a crash.
+	scheduledEventLease = 5 * time.Minute
+
+	// scheduledEventMaxAttempts is how many times an event is fired before it is dropped.
+	scheduledEventMaxAttempts = 5
+)
+
+func SetSchedulerPollInterval(interval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.schedulerPollInterval = interval
+	}
+}
+
+// ScheduledEvent is an event to be fired at the given time in the future.
+//
+// The events are stored in MongoDB, so they are fired even when the process
+// is restarted in the meantime. An event is removed once fired successfully.
+type ScheduledEvent struct {
+	Id      bson.ObjectId `bson:"_id,omitempty"`
+	Kind    string        `bson:"kind"`
+	OwnerId bson.ObjectId `bson:"ownerId"`
+
+	// Key identifies the event along with Kind and OwnerId.
+	// Scheduling the same event again only updates FireAt and Args.
+	Key  string            `bson:"key"`
+	Args map[string]string `bson:"args,omitempty"`
+
+	FireAt time.Time `bson:"fireAt"`
+
+	// LeaseUntil is set when the event is claimed for firing.
+	LeaseUntil time.Time `bson:"leaseUntil"`
+	Attempts   int       `bson:"attempts"`
+}
+
+// scheduledEventHandler fires the event. It returns once the resulting notifications
+// are dispatched, the event is removed then. In case an error is returned, the event
+// is kept and fired again once the lease expires.
+type scheduledEventHandler func(event *ScheduledEvent) error
+
+// scheduler keeps the scheduled events and fires them once they are due.
+type scheduler struct {
+	c        *mgo.Collection
+	handlers map[string]scheduledEventHandler
+	logger   *logrus.Entry
+}
+
+func newScheduler(db *mgo.Database, logger *logrus.Entry) (*scheduler, error) {
+	c := db.C("scheduledEvents")
+
+	indexes := []mgo.Index{
+		{
+			Key:        []string{"kind", "ownerId", "key"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"fireAt"},
+			Background: true,
+		},
+	}
+
+	for _, index := range indexes {
+		if err := c.EnsureIndex(index); err != nil {
+			return nil, errors.Wrapf(err, "failed to create index for scheduledEvents.%v", index.Key)
+		}
+	}
+
+	return &scheduler{
+		c:        c,
+		handlers: make(map[string]scheduledEventHandler),
+		logger:   logger,
+	}, nil
+}
+
+// Handle registers the handler for the given event kind.
+func (s *scheduler) Handle(kind string, handler scheduledEventHandler) {
+	s.handlers[kind] = handler
+}
+
+// Schedule stores the event to be fired at event.FireAt.
+func (s *scheduler) Schedule(event *ScheduledEvent) error {
+	selector := bson.M{
+		"kind":    event.Kind,
+		"ownerId": event.OwnerId,
+		"key":     event.Key,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"args":   event.Args,
+			"fireAt": event.FireAt,
+		},
+		"$setOnInsert": bson.M{
+			"leaseUntil": time.Time{},
+			"attempts":   0,
+		},
+	}
+	if _, err := s.c.Upsert(selector, update); err != nil {
+		return errors.Wrapf(err, "failed to schedule event [select=%+v]", selector)
+	}
+	return nil
+}
+
+// loop fires the due events every interval until dying is closed.
+func (s *scheduler) loop(interval time.Duration, dying <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.fireDue(dying)
+
+		select {
+		case <-ticker.C:
+		case <-dying:
+			return nil
+		}
+	}
+}
+
+// fireDue fires the events that are due, one by one.
+func (s *scheduler) fireDue(dying <-chan struct{}) {
+	for {
+		select {
+		case <-dying:
+			return
+		default:
+		}
+
+		event, err := s.claim()
+		if err != nil {
+			if err != mgo.ErrNotFound {
+				s.logger.WithError(err).Error("Failed claiming scheduled event")
+			}
+			return
+		}
+
+		logger := s.logger.WithFields(logrus.Fields{
+			"kind":    event.Kind,
+			"user":    event.OwnerId.Hex(),
+			"key":     event.Key,
+			"attempt": event.Attempts,
+		})
+
+		handler, ok := s.handlers[event.Kind]
+		if !ok {
+			logger.Warn("No handler for scheduled event, dropping it")
+			s.remove(event, logger)
+			continue
+		}
+
+		if err := handler(event); err != nil {
+			if event.Attempts >= scheduledEventMaxAttempts {
+				logger.WithError(err).Error("Failed firing scheduled event, giving up")
+				s.remove(event, logger)
+			} else {
+				logger.WithError(err).Warn("Failed firing scheduled event, will retry")
+			}
+			continue
+		}
+		s.remove(event, logger)
+	}
+}
+
+// claim leases the next due event so that it is not fired twice.
+func (s *scheduler) claim() (*ScheduledEvent, error) {
+	now := time.Now()
+
+	query := bson.M{
+		"fireAt":     bson.M{"$lte": now},
+		"leaseUntil": bson.M{"$lte": now},
+	}
+	change := mgo.Change{
+		Update: bson.M{
+			"$set": bson.M{"leaseUntil": now.Add(scheduledEventLease)},
+			"$inc": bson.M{"attempts": 1},
+		},
+		ReturnNew: true,
+	}
+
+	var event ScheduledEvent
+	if _, err := s.c.Find(query).Sort("fireAt").Apply(change, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// remove removes the fired event unless it was rescheduled in the meantime.
+func (s *scheduler) remove(event *ScheduledEvent, logger *logrus.Entry) {
+	err := s.c.Remove(bson.M{
+		"_id":    event.Id,
+		"fireAt": event.FireAt,
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		logger.WithError(err).Error("Failed removing scheduled event")
+	}
+}
+
+// startScheduler sets up the scheduler and starts firing the scheduled events.
+//
+// The events are only fired by the main processor, not when replaying blocks,
+// the scheduler is only used to schedule new events then.
+func (processor *BlockProcessor) startScheduler(connect ConnectFunc) error {
+	s, err := newScheduler(processor.db, processor.logger.WithField("component", "scheduler"))
+	if err != nil {
+		return err
+	}
+	processor.scheduler = s
+
+	if processor.blockRange != nil {
+		return nil
+	}
+
+	client, err := connect()
+	if err != nil {
+		return err
+	}
+	processor.t.Go(func() error {
+		<-processor.t.Dying()
+		client.Close()
+		return nil
+	})
+
+	s.Handle("story.payout_soon", processor.firePayoutReminder(client))
+
+	processor.t.Go(func() error {
+		return s.loop(processor.schedulerPollInterval, processor.t.Dying())
+	})
+	return nil
+}
@@ -0,0 +1,505 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/chain"
+	"github.com/tchap/steemwatch/notifications/revision"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultSubscriptionIndexPollInterval = 5 * time.Second
+
+func SetSubscriptionIndexPollInterval(interval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.subscriptionIndexPollInterval = interval
+	}
+}
+
+// Subscription is an event subscription as stored in the events collection.
+type Subscription struct {
+	OwnerId bson.ObjectId
+	Kind    string
+	Lists   map[string][]string
+
+	sets map[string]map[string]struct{}
+}
+
+// Contains returns true when the given list contains the value.
+func (sub *Subscription) Contains(list, value string) bool {
+	_, ok := sub.sets[list][value]
+	return ok
+}
+
+// ContainsAny returns true when the given list contains any of the values.
+func (sub *Subscription) ContainsAny(list string, values []string) bool {
+	for _, value := range values {
+		if sub.Contains(list, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Criteria specify what subscriptions an event is delivered to.
+//
+// A subscription of the given kind matches when any of its Include lists
+// contains any of the associated values while none of its Exclude lists
+// contains any of the associated values.
+type Criteria struct {
+	Kind    string
+	Include map[string][]string
+	Exclude map[string][]string
+}
+
+type threadKey struct {
+	author   string
+	permlink string
+}
+
+// subscriptionIndex keeps everything needed to match and dispatch events in memory.
+//
+// The index is reloaded from the database every time the subscriptions revision changes,
+// so MongoDB is only queried when somebody actually modifies their settings.
+type subscriptionIndex struct {
+	db       *mgo.Database
+	revision int
+	logger   *logrus.Entry
+
+	// kind -> list -> value -> subscriptions
+	subscriptions  map[string]map[string]map[string][]*Subscription
+	notifiers      map[bson.ObjectId][]*NotifierDoc
+	muted          map[bson.ObjectId]map[string]struct{}
+	frontEnds      map[bson.ObjectId]*chain.FrontEnd
+	accountOwners  map[string][]bson.ObjectId
+	threadWatches  map[threadKey]map[bson.ObjectId]time.Time
+	contentMatcher *contentMatcher
+	lock           sync.RWMutex
+
+	// reloadLock serializes reloading with the writes the index performs itself.
+	reloadLock sync.Mutex
+}
+
+func newSubscriptionIndex(db *mgo.Database, logger *logrus.Entry) (*subscriptionIndex, error) {
+	index := &subscriptionIndex{
+		db:       db,
+		revision: -1,
+		logger:   logger,
+	}
+	if _, err := index.Refresh(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Refresh reloads the index in case the subscriptions revision changed.
+func (index *subscriptionIndex) Refresh() (bool, error) {
+	rev, err := revision.Get(index.db)
+	if err != nil {
+		return false, err
+	}
+
+	if rev == index.revision {
+		return false, nil
+	}
+	if err := index.Reload(); err != nil {
+		return false, err
+	}
+	index.revision = rev
+	return true, nil
+}
+
+// Reload rebuilds the whole index from the database.
+func (index *subscriptionIndex) Reload() error {
+	index.reloadLock.Lock()
+	defer index.reloadLock.Unlock()
+
+	var (
+		subscriptions = make(map[string]map[string]map[string][]*Subscription)
+		notifiers     = make(map[bson.ObjectId][]*NotifierDoc)
+		muted         = make(map[bson.ObjectId]map[string]struct{})
+		frontEnds     = make(map[bson.ObjectId]*chain.FrontEnd)
+		accountOwners = make(map[string][]bson.ObjectId)
+		threadWatches = make(map[threadKey]map[bson.ObjectId]time.Time)
+		contentSubs   []*Subscription
+	)
+
+	// Load event subscriptions.
+	iter := index.db.C("events").Find(nil).Iter()
+	for {
+		var doc bson.M
+		if !iter.Next(&doc) {
+			break
+		}
+
+		sub := newSubscription(doc)
+		if sub == nil {
+			continue
+		}
+
+		if sub.Kind == "content.matched" {
+			contentSubs = append(contentSubs, sub)
+		}
+
+		addSubscription(subscriptions, sub)
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Wrap(err, "failed to load event subscriptions")
+	}
+
+	// Load enabled notifiers.
+	var notifier struct {
+		OwnerId     bson.ObjectId `bson:"ownerId"`
+		NotifierDoc `bson:",inline"`
+	}
+	iter = index.db.C("notifiers").Find(bson.M{"enabled": true}).Iter()
+	for iter.Next(&notifier) {
+		doc := notifier.NotifierDoc
+		notifiers[notifier.OwnerId] = append(notifiers[notifier.OwnerId], &doc)
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Wrap(err, "failed to load notifiers")
+	}
+
+	// Load user profiles.
+	var user struct {
+		Id            bson.ObjectId   `bson:"_id"`
+		Accounts      []string        `bson:"accounts"`
+		MutedAccounts []string        `bson:"mutedAccounts"`
+		FrontEnd      *chain.FrontEnd `bson:"frontEnd"`
+	}
+	iter = index.db.C("users").Find(nil).Select(bson.M{
+		"accounts":      1,
+		"mutedAccounts": 1,
+		"frontEnd":      1,
+	}).Iter()
+	for iter.Next(&user) {
+		for _, account := range user.Accounts {
+			accountOwners[account] = append(accountOwners[account], user.Id)
+		}
+		if len(user.MutedAccounts) != 0 {
+			set := make(map[string]struct{}, len(user.MutedAccounts))
+			for _, account := range user.MutedAccounts {
+				set[account] = struct{}{}
+			}
+			muted[user.Id] = set
+		}
+		if user.FrontEnd != nil {
+			frontEnds[user.Id] = user.FrontEnd
+		}
+		user.Accounts = nil
+		user.MutedAccounts = nil
+		user.FrontEnd = nil
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Wrap(err, "failed to load user profiles")
+	}
+
+	// Load thread watches.
+	var watch ThreadWatch
+	query := bson.M{
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	iter = index.db.C("threadWatches").Find(query).Iter()
+	for iter.Next(&watch) {
+		key := threadKey{watch.RootAuthor, watch.RootPermlink}
+		watchers, ok := threadWatches[key]
+		if !ok {
+			watchers = make(map[bson.ObjectId]time.Time)
+			threadWatches[key] = watchers
+		}
+		watchers[watch.OwnerId] = watch.ExpiresAt
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Wrap(err, "failed to load thread watches")
+	}
+
+	matcher := newContentMatcher(contentSubs, index.logger)
+
+	index.lock.Lock()
+	index.subscriptions = subscriptions
+	index.notifiers = notifiers
+	index.muted = muted
+	index.frontEnds = frontEnds
+	index.accountOwners = accountOwners
+	index.threadWatches = threadWatches
+	index.contentMatcher = matcher
+	index.lock.Unlock()
+	return nil
+}
+
+func newSubscription(doc bson.M) *Subscription {
+	ownerId, ok := doc["ownerId"].(bson.ObjectId)
+	if !ok {
+		return nil
+	}
+	kind, ok := doc["kind"].(string)
+	if !ok {
+		return nil
+	}
+
+	sub := &Subscription{
+		OwnerId: ownerId,
+		Kind:    kind,
+		Lists:   make(map[string][]string),
+		sets:    make(map[string]map[string]struct{}),
+	}
+	for key, value := range doc {
+		items, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+
+		var (
+			list = make([]string, 0, len(items))
+			set  = make(map[string]struct{}, len(items))
+		)
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+				set[s] = struct{}{}
+			}
+		}
+		sub.Lists[key] = list
+		sub.sets[key] = set
+	}
+	return sub
+}
+
+// addSubscription adds the subscription to the kind -> list -> value -> subscriptions map.
+func addSubscription(subscriptions map[string]map[string]map[string][]*Subscription, sub *Subscription) {
+	lists, ok := subscriptions[sub.Kind]
+	if !ok {
+		lists = make(map[string]map[string][]*Subscription)
+		subscriptions[sub.Kind] = lists
+	}
+	for list, values := range sub.sets {
+		owners, ok := lists[list]
+		if !ok {
+			owners = make(map[string][]*Subscription)
+			lists[list] = owners
+		}
+		for value := range values {
+			owners[value] = append(owners[value], sub)
+		}
+	}
+}
+
+// Match returns the owners of the subscriptions matching the given criteria.
+func (index *subscriptionIndex) Match(criteria *Criteria) []bson.ObjectId {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	var (
+		lists  = index.subscriptions[criteria.Kind]
+		seen   = make(map[bson.ObjectId]struct{})
+		owners []bson.ObjectId
+	)
+	for list, values := range criteria.Include {
+		for _, value := range values {
+			for _, sub := range lists[list][value] {
+				if _, ok := seen[sub.OwnerId]; ok {
+					continue
+				}
+				if isExcluded(sub, criteria.Exclude) {
+					continue
+				}
+				seen[sub.OwnerId] = struct{}{}
+				owners = append(owners, sub.OwnerId)
+			}
+		}
+	}
+	return owners
+}
+
+// Contains returns true in case there is a subscription of the given kind
+// with the value in the given list.
+func (index *subscriptionIndex) Contains(kind, list, value string) bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return len(index.subscriptions[kind][list][value]) != 0
+}
+
+// HasKind returns true in case there is any subscription of the given kind.
+func (index *subscriptionIndex) HasKind(kind string) bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return len(index.subscriptions[kind]) != 0
+}
+
+// HasList returns true in case there is any subscription of the given kind
+// with the given list not empty.
+func (index *subscriptionIndex) HasList(kind, list string) bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return len(index.subscriptions[kind][list]) != 0
+}
+
+// Subscriptions returns all the subscriptions of the given kind.
+func (index *subscriptionIndex) Subscriptions(kind string) []*Subscription {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	var (
+		seen = make(map[*Subscription]struct{})
+		subs []*Subscription
+	)
+	for _, values := range index.subscriptions[kind] {
+		for _, list := range values {
+			for _, sub := range list {
+				if _, ok := seen[sub]; !ok {
+					seen[sub] = struct{}{}
+					subs = append(subs, sub)
+				}
+			}
+		}
+	}
+	return subs
+}
+
+// HasThreadWatches returns true in case any thread is being watched.
+func (index *subscriptionIndex) HasThreadWatches() bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return len(index.threadWatches) != 0
+}
+
+func isExcluded(sub *Subscription, exclude map[string][]string) bool {
+	for list, values := range exclude {
+		if sub.ContainsAny(list, values) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchContent returns the content.matched keywords and patterns found in the text,
+// grouped by the subscription owner.
+func (index *subscriptionIndex) MatchContent(text string) map[bson.ObjectId][]string {
+	index.lock.RLock()
+	matcher := index.contentMatcher
+	index.lock.RUnlock()
+	return matcher.Match(text)
+}
+
+// Notifiers returns the enabled notifiers for the given user.
+func (index *subscriptionIndex) Notifiers(ownerId bson.ObjectId) []*NotifierDoc {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return index.notifiers[ownerId]
+}
+
+// IsMuted returns true when any of the given accounts is on the user's global mute list.
+func (index *subscriptionIndex) IsMuted(ownerId bson.ObjectId, accounts []string) bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	muted := index.muted[ownerId]
+	for _, account := range accounts {
+		if _, ok := muted[account]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FrontEnd returns the front-end chosen by the user, nil when not set.
+func (index *subscriptionIndex) FrontEnd(ownerId bson.ObjectId) *chain.FrontEnd {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return index.frontEnds[ownerId]
+}
+
+// AccountOwners returns the users having the given account listed in their profile.
+func (index *subscriptionIndex) AccountOwners(account string) []bson.ObjectId {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return index.accountOwners[account]
+}
+
+// ThreadWatchers returns the users watching the given thread.
+func (index *subscriptionIndex) ThreadWatchers(rootAuthor, rootPermlink string) []bson.ObjectId {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	var (
+		now      = time.Now()
+		watchers []bson.ObjectId
+	)
+	for ownerId, expiresAt := range index.threadWatches[threadKey{rootAuthor, rootPermlink}] {
+		if expiresAt.After(now) {
+			watchers = append(watchers, ownerId)
+		}
+	}
+	return watchers
+}
+
+// WatchThread registers or extends a thread watch for the given user and comment author,
+// both in the database and in the index.
+func (index *subscriptionIndex) WatchThread(
+	ownerId bson.ObjectId,
+	author string,
+	rootAuthor string,
+	rootPermlink string,
+	rootURL string,
+	expiresAt time.Time,
+) error {
+
+	index.reloadLock.Lock()
+	defer index.reloadLock.Unlock()
+
+	selector := bson.M{
+		"ownerId":      ownerId,
+		"rootAuthor":   rootAuthor,
+		"rootPermlink": rootPermlink,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"rootURL":   rootURL,
+			"expiresAt": expiresAt,
+		},
+		"$addToSet": bson.M{
+			"accounts": author,
+		},
+	}
+
+	if _, err := index.db.C("threadWatches").Upsert(selector, update); err != nil {
+		return errors.Wrapf(err, "failed to register thread watch [select=%+v]", selector)
+	}
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	key := threadKey{rootAuthor, rootPermlink}
+	watchers, ok := index.threadWatches[key]
+	if !ok {
+		watchers = make(map[bson.ObjectId]time.Time)
+		index.threadWatches[key] = watchers
+	}
+	watchers[ownerId] = expiresAt
+	return nil
+}
+
+func (index *subscriptionIndex) poller(interval time.Duration, dying <-chan struct{}) error {
+	for {
+		select {
+		case <-time.After(interval):
+			reloaded, err := index.Refresh()
+			if err != nil {
+				index.logger.WithError(err).Error("failed to refresh")
+				continue
+			}
+			if reloaded {
+				index.logger.Info("reloaded")
+			}
+		case <-dying:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package notifications
+
+import (
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// newTestSubscription returns the subscription as it would be loaded from the events collection.
+func newTestSubscription(ownerId bson.ObjectId, kind string, lists map[string][]string) *Subscription {
+	doc := bson.M{
+		"ownerId": ownerId,
+		"kind":    kind,
+	}
+	for list, values := range lists {
+		items := make([]interface{}, len(values))
+		for i, value := range values {
+			items[i] = value
+		}
+		doc[list] = items
+	}
+	return newSubscription(doc)
+}
+
+// newTestSubscriptionIndex returns an index holding the given subscriptions only.
+func newTestSubscriptionIndex(subs ...*Subscription) *subscriptionIndex {
+	subscriptions := make(map[string]map[string]map[string][]*Subscription)
+	for _, sub := range subs {
+		addSubscription(subscriptions, sub)
+	}
+	return &subscriptionIndex{
+		subscriptions:  subscriptions,
+		contentMatcher: newContentMatcher(nil, newTestLogger()),
+		logger:         newTestLogger(),
+	}
+}
+
+func sortedOwners(ownerIds []bson.ObjectId) []string {
+	owners := make([]string, len(ownerIds))
+	for i, ownerId := range ownerIds {
+		owners[i] = ownerId.Hex()
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+func TestSubscriptionIndex_Match(t *testing.T) {
+	var (
+		alice = bson.NewObjectId()
+		bob   = bson.NewObjectId()
+		carol = bson.NewObjectId()
+	)
+
+	index := newTestSubscriptionIndex(
+		newTestSubscription(alice, "story.voted", map[string][]string{
+			"authors": {"alice"},
+			"voters":  {"whale"},
+		}),
+		newTestSubscription(bob, "story.voted", map[string][]string{
+			"voters":          {"whale", "dolphin"},
+			"authorBlacklist": {"spammer"},
+			"tagBlacklist":    {"nsfw"},
+		}),
+		newTestSubscription(carol, "comment.voted", map[string][]string{
+			"authors": {"alice"},
+		}),
+	)
+
+	testCases := []struct {
+		name     string
+		criteria *Criteria
+		owners   []bson.ObjectId
+	}{
+		{
+			name: "single list",
+			criteria: &Criteria{
+				Kind:    "story.voted",
+				Include: map[string][]string{"authors": {"alice"}},
+			},
+			owners: []bson.ObjectId{alice},
+		},
+		{
+			name: "owners matched by multiple lists are returned once",
+			criteria: &Criteria{
+				Kind: "story.voted",
+				Include: map[string][]string{
+					"authors": {"alice"},
+					"voters":  {"whale"},
+				},
+			},
+			owners: []bson.ObjectId{alice, bob},
+		},
+		{
+			name: "kinds are kept apart",
+			criteria: &Criteria{
+				Kind:    "comment.voted",
+				Include: map[string][]string{"voters": {"whale"}, "authors": {"alice"}},
+			},
+			owners: []bson.ObjectId{carol},
+		},
+		{
+			name: "exclude list drops the subscription",
+			criteria: &Criteria{
+				Kind:    "story.voted",
+				Include: map[string][]string{"authors": {"spammer"}, "voters": {"dolphin"}},
+				Exclude: map[string][]string{"authorBlacklist": {"spammer"}},
+			},
+			owners: nil,
+		},
+		{
+			name: "any excluded value drops the subscription",
+			criteria: &Criteria{
+				Kind:    "story.voted",
+				Include: map[string][]string{"voters": {"whale"}},
+				Exclude: map[string][]string{"tagBlacklist": {"steem", "nsfw"}},
+			},
+			owners: []bson.ObjectId{alice},
+		},
+		{
+			name: "no value matched",
+			criteria: &Criteria{
+				Kind:    "story.voted",
+				Include: map[string][]string{"voters": {"minnow"}},
+			},
+			owners: nil,
+		},
+		{
+			name: "unknown kind",
+			criteria: &Criteria{
+				Kind:    "story.published",
+				Include: map[string][]string{"authors": {"alice"}},
+			},
+			owners: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := sortedOwners(tc.owners)
+			owners := sortedOwners(index.Match(tc.criteria))
+			if len(owners) != len(expected) {
+				t.Fatalf("expected %v, got %v", expected, owners)
+			}
+			for i := range owners {
+				if owners[i] != expected[i] {
+					t.Fatalf("expected %v, got %v", expected, owners)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionIndex_Lookups(t *testing.T) {
+	index := newTestSubscriptionIndex(
+		newTestSubscription(bson.NewObjectId(), "story.voted", map[string][]string{
+			"authors": {"alice"},
+			"voters":  {},
+		}),
+	)
+
+	testCases := []struct {
+		name     string
+		lookup   func() bool
+		expected bool
+	}{
+		{"Contains value", func() bool { return index.Contains("story.voted", "authors", "alice") }, true},
+		{"Contains other value", func() bool { return index.Contains("story.voted", "authors", "bob") }, false},
+		{"Contains other kind", func() bool { return index.Contains("comment.voted", "authors", "alice") }, false},
+		{"HasKind", func() bool { return index.HasKind("story.voted") }, true},
+		{"HasKind other kind", func() bool { return index.HasKind("comment.voted") }, false},
+		{"HasList", func() bool { return index.HasList("story.voted", "authors") }, true},
+		{"HasList empty list", func() bool { return index.HasList("story.voted", "voters") }, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := tc.lookup(); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultThreadWatchTTL = 7 * 24 * time.Hour
+
+// ThreadWatch is a temporary subscription to replies in a thread.
+//
+// A thread watch is registered automatically when a user comments on a story
+// using one of the accounts listed in the user profile. The watch is extended
+// every time the user comments in the thread again and it expires otherwise.
+type ThreadWatch struct {
+	Id           bson.ObjectId `json:"id"           bson:"_id,omitempty"`
+	OwnerId      bson.ObjectId `json:"-"            bson:"ownerId"`
+	RootAuthor   string        `json:"rootAuthor"   bson:"rootAuthor"`
+	RootPermlink string        `json:"rootPermlink" bson:"rootPermlink"`
+	RootURL      string        `json:"rootURL"      bson:"rootURL"`
+	Accounts     []string      `json:"accounts"     bson:"accounts"`
+	ExpiresAt    time.Time     `json:"expiresAt"    bson:"expiresAt"`
+}
+
+func SetThreadWatchTTL(ttl time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.threadWatchTTL = ttl
+	}
+}
+
+func ensureThreadWatchIndexes(db *mgo.Database) error {
+	indexes := []mgo.Index{
+		{
+			Key:        []string{"rootAuthor", "rootPermlink"},
+			Background: true,
+		},
+		{
+			Key:        []string{"ownerId"},
+			Background: true,
+		},
+		{
+			// The documents are removed by MongoDB once expired.
+			Key:         []string{"expiresAt"},
+			Background:  true,
+			ExpireAfter: time.Second,
+		},
+	}
+
+	for _, index := range indexes {
+		if err := db.C("threadWatches").EnsureIndex(index); err != nil {
+			return errors.Wrapf(err, "failed to create index for threadWatches.%v", index.Key)
+		}
+	}
+	return nil
+}
+
+// handleThreadReply notifies the users watching the thread the comment was posted to,
+// then it registers or extends thread watches for the users owning the comment author.
+//
+// Users already notified about the comment are passed in so that they are not notified twice.
+func (processor *BlockProcessor) handleThreadReply(
+	event *events.CommentPublished,
+	notified map[bson.ObjectId]struct{},
+) error {
+
+	rootAuthor, rootPermlink, rootURL, ok := event.RootPost()
+	if !ok {
+		return nil
+	}
+	author := event.Content.Author
+
+	// Get the users controlling the comment author account.
+	owners := processor.index.AccountOwners(author)
+	isOwner := func(userId bson.ObjectId) bool {
+		for _, ownerId := range owners {
+			if ownerId == userId {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Notify the users watching the thread, skipping the users replying to themselves.
+	reply := &events.CommentThreadReply{
+		Op:           event.Op,
+		Content:      event.Content,
+		RootAuthor:   rootAuthor,
+		RootPermlink: rootPermlink,
+		Origin:       event.Origin,
+	}
+	for _, ownerId := range processor.index.ThreadWatchers(rootAuthor, rootPermlink) {
+		if _, ok := notified[ownerId]; ok {
+			continue
+		}
+		if isOwner(ownerId) {
+			continue
+		}
+		processor.DispatchCommentThreadReplyEvent(ownerId.Hex(), reply)
+	}
+
+	// Register or extend thread watches for the comment author.
+	// Nothing is written to the database in case this is a dry run.
+	if processor.dryRun != nil {
+		return nil
+	}
+	expiresAt := time.Now().Add(processor.threadWatchTTL)
+	for _, ownerId := range owners {
+		err := processor.index.WatchThread(ownerId, author, rootAuthor, rootPermlink, rootURL, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
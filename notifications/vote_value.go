@@ -0,0 +1,236 @@
+package notifications
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultVoteValueRefreshInterval = 5 * time.Minute
+
+// rsharesTimeout limits how long a block waits for the active votes of a content
+// to be fetched. The vote is notified without the value in case it takes longer.
+const rsharesTimeout = 3 * time.Second
+
+// SetVoteValuation enables vote value estimation for vote notifications.
+//
+// The reward fund and the median price feed are fetched using the given caller
+// every refreshInterval. The processor takes ownership of the caller and closes it on exit.
+func SetVoteValuation(caller interfaces.CallCloser, refreshInterval time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.voteValuationCaller = caller
+		processor.voteValuationInterval = refreshInterval
+	}
+}
+
+// voteValuer estimates the payout value of votes.
+//
+// value = rshares * reward_balance / recent_claims * median price
+//
+// The result is expressed in the dollar asset of the chain.
+type voteValuer struct {
+	caller  interfaces.Caller
+	timeout time.Duration
+	logger  *logrus.Entry
+
+	rewardBalance float64
+	recentClaims  float64
+	price         float64
+	lock          sync.RWMutex
+}
+
+func newVoteValuer(caller interfaces.Caller, logger *logrus.Entry) *voteValuer {
+	return &voteValuer{
+		caller:  caller,
+		timeout: rsharesTimeout,
+		logger:  logger,
+	}
+}
+
+// poller refreshes the valuation parameters every interval until dying is closed.
+// Failures are only logged, the last known parameters are kept.
+func (valuer *voteValuer) poller(interval time.Duration, dying <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := valuer.refresh(); err != nil {
+				valuer.logger.WithError(err).Warn("Failed refreshing vote valuation parameters")
+			}
+		case <-dying:
+			return nil
+		}
+	}
+}
+
+func (valuer *voteValuer) refresh() error {
+	var fund struct {
+		RewardBalance string `json:"reward_balance"`
+		RecentClaims  string `json:"recent_claims"`
+	}
+	if err := valuer.caller.Call("get_reward_fund", []interface{}{"post"}, &fund); err != nil {
+		return errors.Wrap(err, "failed to get the reward fund")
+	}
+
+	var median struct {
+		Base  string `json:"base"`
+		Quote string `json:"quote"`
+	}
+	if err := valuer.caller.Call("get_current_median_history_price", []interface{}{}, &median); err != nil {
+		return errors.Wrap(err, "failed to get the current median history price")
+	}
+
+	rewardBalance, err := parseAmount(fund.RewardBalance)
+	if err != nil {
+		return errors.Wrap(err, "invalid reward fund balance")
+	}
+	recentClaims, err := strconv.ParseFloat(fund.RecentClaims, 64)
+	if err != nil || recentClaims <= 0 {
+		return errors.Errorf("invalid reward fund recent claims: %v", fund.RecentClaims)
+	}
+	base, err := parseAmount(median.Base)
+	if err != nil {
+		return errors.Wrap(err, "invalid median price base")
+	}
+	quote, err := parseAmount(median.Quote)
+	if err != nil || quote <= 0 {
+		return errors.Errorf("invalid median price quote: %v", median.Quote)
+	}
+
+	valuer.lock.Lock()
+	valuer.rewardBalance = rewardBalance
+	valuer.recentClaims = recentClaims
+	valuer.price = base / quote
+	valuer.lock.Unlock()
+
+	valuer.logger.WithFields(logrus.Fields{
+		"reward_balance": rewardBalance,
+		"recent_claims":  fund.RecentClaims,
+		"price":          base / quote,
+	}).Debug("Vote valuation parameters refreshed")
+	return nil
+}
+
+// Value returns the estimated value of the given rshares, e.g. 0.123 SBD.
+// The legacy dollar symbol is used, the notifiers map it to the symbol of the chain.
+// false is returned in case the valuation parameters are not known yet.
+func (valuer *voteValuer) Value(rshares int64) (string, bool) {
+	valuer.lock.RLock()
+	defer valuer.lock.RUnlock()
+
+	if valuer.recentClaims == 0 {
+		return "", false
+	}
+	value := float64(rshares) * valuer.rewardBalance / valuer.recentClaims * valuer.price
+	return fmt.Sprintf("%.3f SBD", value), true
+}
+
+// Rshares returns the rshares of the vote cast by the given vote operation.
+//
+// The active votes of the content are used when they already contain the vote,
+// i.e. the voter's entry carries the weight of the operation. Otherwise the active
+// votes are fetched, but the block is not held up for longer than the valuer timeout.
+func (valuer *voteValuer) Rshares(content *database.Content, op *types.VoteOperation) (int64, error) {
+	for _, vote := range content.ActiveVotes {
+		if isVote(vote.Voter, vote.Percent, op) && vote.Rshares != nil {
+			return int64(*vote.Rshares), nil
+		}
+	}
+
+	type result struct {
+		rshares int64
+		err     error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		rshares, err := valuer.fetchRshares(content, op)
+		resultCh <- result{rshares, err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.rshares, res.err
+	case <-time.After(valuer.timeout):
+		return 0, errors.Errorf("timed out getting active votes for @%v/%v", content.Author, content.Permlink)
+	}
+}
+
+func (valuer *voteValuer) fetchRshares(content *database.Content, op *types.VoteOperation) (int64, error) {
+	var votes []struct {
+		Voter   string      `json:"voter"`
+		Rshares types.Int64 `json:"rshares"`
+		Percent *types.Int  `json:"percent"`
+	}
+	params := []interface{}{content.Author, content.Permlink}
+	if err := valuer.caller.Call("get_active_votes", params, &votes); err != nil {
+		return 0, errors.Wrapf(err, "failed to get active votes for @%v/%v", content.Author, content.Permlink)
+	}
+	for _, vote := range votes {
+		if isVote(vote.Voter, vote.Percent, op) {
+			return int64(vote.Rshares), nil
+		}
+	}
+	return 0, errors.Errorf("vote by %v not found on @%v/%v", op.Voter, content.Author, content.Permlink)
+}
+
+// isVote returns true in case the active vote entry was cast by the given operation.
+// The entry of an earlier vote by the same voter carries a different weight,
+// the same weight cannot be voted twice in a row.
+func isVote(voter string, percent *types.Int, op *types.VoteOperation) bool {
+	return voter == op.Voter && percent != nil && int64(*percent) == int64(op.Weight)
+}
+
+// estimateVoteValue returns the estimated value of the vote, an empty string when not known.
+func (processor *BlockProcessor) estimateVoteValue(op *types.VoteOperation, content *database.Content) string {
+	valuer := processor.voteValuer
+	if valuer == nil {
+		return ""
+	}
+
+	rshares, err := valuer.Rshares(content, op)
+	if err != nil {
+		processor.logger.WithError(err).Warn("Failed estimating vote value")
+		return ""
+	}
+	value, _ := valuer.Value(rshares)
+	return value
+}
+
+// startVoteValuer starts refreshing the vote valuation parameters, if enabled.
+// The parameters are fetched right away so that the first blocks are not missing the values.
+func (processor *BlockProcessor) startVoteValuer() {
+	caller := processor.voteValuationCaller
+	if caller == nil {
+		return
+	}
+
+	valuer := newVoteValuer(caller, processor.logger.WithField("component", "vote_valuer"))
+	if err := valuer.refresh(); err != nil {
+		valuer.logger.WithError(err).Warn("Failed fetching vote valuation parameters")
+	}
+	processor.voteValuer = valuer
+
+	processor.t.Go(func() error {
+		defer caller.Close()
+		return valuer.poller(processor.voteValuationInterval, processor.t.Dying())
+	})
+}
+
+// parseAmount parses the numeric part of an asset amount, e.g. 1.000 STEEM.
+func parseAmount(amount string) (float64, error) {
+	fields := strings.Fields(amount)
+	if len(fields) == 0 {
+		return 0, errors.Errorf("invalid amount: %q", amount)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
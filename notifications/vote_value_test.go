@@ -0,0 +1,87 @@
+package notifications
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// staticCaller returns the given JSON response to every call after the given delay.
+type staticCaller struct {
+	response string
+	delay    time.Duration
+	calls    int
+}
+
+func (caller *staticCaller) Call(method string, params, response interface{}) error {
+	caller.calls++
+	time.Sleep(caller.delay)
+	return json.Unmarshal([]byte(caller.response), response)
+}
+
+func TestVoteValuer_Rshares(t *testing.T) {
+	var (
+		percent  = types.Int(10000)
+		previous = types.Int(5000)
+		rshares  = types.Int(1000)
+		op       = &types.VoteOperation{Voter: "alice", Author: "bob", Permlink: "post", Weight: 10000}
+		fetched  = `[{"voter": "alice", "rshares": 2000, "percent": 10000}]`
+	)
+
+	testCases := []struct {
+		name    string
+		votes   []*database.VoteState
+		rshares int64
+		calls   int
+	}{
+		{
+			name:    "cached vote",
+			votes:   []*database.VoteState{{Voter: "alice", Percent: &percent, Rshares: &rshares}},
+			rshares: 1000,
+		},
+		{
+			name:    "stale cached vote",
+			votes:   []*database.VoteState{{Voter: "alice", Percent: &previous, Rshares: &rshares}},
+			rshares: 2000,
+			calls:   1,
+		},
+		{
+			name:    "vote not cached",
+			rshares: 2000,
+			calls:   1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			caller := &staticCaller{response: fetched}
+			valuer := newVoteValuer(caller, newTestLogger())
+			content := &database.Content{Author: "bob", Permlink: "post", ActiveVotes: tc.votes}
+
+			rshares, err := valuer.Rshares(content, op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rshares != tc.rshares {
+				t.Errorf("expected %v rshares, got %v", tc.rshares, rshares)
+			}
+			if caller.calls != tc.calls {
+				t.Errorf("expected %v calls, got %v", tc.calls, caller.calls)
+			}
+		})
+	}
+}
+
+func TestVoteValuer_RsharesTimeout(t *testing.T) {
+	caller := &staticCaller{response: "[]", delay: 100 * time.Millisecond}
+	valuer := newVoteValuer(caller, newTestLogger())
+	valuer.timeout = 10 * time.Millisecond
+
+	op := &types.VoteOperation{Voter: "alice", Author: "bob", Permlink: "post", Weight: 10000}
+	if _, err := valuer.Rshares(&database.Content{Author: "bob", Permlink: "post"}, op); err == nil {
+		t.Error("expected the slow call to time out")
+	}
+}
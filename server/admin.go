@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/tchap/steemwatch/config"
+	"github.com/tchap/steemwatch/health"
+	healthRoutes "github.com/tchap/steemwatch/server/routes/health"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/tomb.v2"
+)
+
+// runAdmin starts the admin server serving profiling, metrics and detailed health checks.
+// The server is disabled in case the admin listen address is empty.
+//
+// Unless the server is bound to the loopback interface, the admin token must be set.
+// Health checks are also served by the public server since they are meant for the orchestrator,
+// but only the check results are reported there, the error messages are served here.
+func runAdmin(cfg *config.Config, checker *health.Checker, t *tomb.Tomb) error {
+	if cfg.AdminListenAddress == "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(cfg.AdminListenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "invalid admin listen address: %v", cfg.AdminListenAddress)
+	}
+	if cfg.AdminToken == "" && !isLoopback(host) {
+		return errors.Errorf(
+			"admin token must be set when not listening on the loopback interface: %v",
+			cfg.AdminListenAddress)
+	}
+
+	e := echo.New()
+
+	e.Pre(middleware.AddTrailingSlash())
+	e.Use(middleware.Recover())
+
+	requireToken := requireAdminToken(cfg.AdminToken)
+
+	// Debug
+	debug := e.Group("/debug/pprof", requireToken)
+	debug.GET("/cmdline/", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	debug.GET("/profile/", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	debug.GET("/symbol/", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	debug.GET("/trace/", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	debug.GET("/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	debug.GET(
+		"/*",
+		echo.WrapHandler(http.HandlerFunc(pprof.Index)),
+		middleware.RemoveTrailingSlash(),
+	)
+
+	// Metrics
+	e.GET("/metrics/", echo.WrapHandler(promhttp.Handler()), requireToken)
+
+	// Health
+	healthRoutes.BindDetailed(e.Group(""), checker, requireToken)
+
+	// Start listening.
+	listener, err := net.Listen("tcp", cfg.AdminListenAddress)
+	if err != nil {
+		return errors.Wrap(err, "failed to start the admin server")
+	}
+
+	t.Go(func() error {
+		http.Serve(listener, e)
+		return nil
+	})
+
+	go func() {
+		<-t.Dying()
+		listener.Close()
+	}()
+
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireAdminToken checks the bearer token in case the admin token is set.
+func requireAdminToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if token == "" {
+				return next(ctx)
+			}
+
+			header := ctx.Request().Header.Get(echo.HeaderAuthorization)
+			if subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+token)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized)
+			}
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+import { Component, OnInit } from '@angular/core';
+import { Http, Headers }     from '@angular/http';
+
+import { CookieService } from 'angular2-cookie/core';
+
+import { ContextService } from '../../../services/context.service';
+
+
+export interface AccountThreshold {
+  id?:         string;
+  account:     string;
+  metric:      string;
+  threshold:   number;
+  hysteresis?: number;
+  below?:      boolean;
+  value?:      number;
+  checkedAt?:  string;
+}
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'account-thresholds',
+  templateUrl: 'account-thresholds.component.html'
+})
+export class AccountThresholdsComponent implements OnInit {
+
+  metrics: {id: string, label: string}[];
+  model: AccountThreshold[];
+  input: AccountThreshold = this.emptyInput();
+
+  disabled: boolean = true;
+  errorMessage: string;
+
+  constructor(
+    private http:           Http,
+    private cookies:        CookieService,
+    private contextService: ContextService
+  ) {
+    const chain = contextService.getContext().chain;
+    this.metrics = [
+      {id: 'voting_power',     label: 'Voting Power (%)'},
+      {id: 'resource_credits', label: 'Resource Credits (%)'},
+      {id: 'balance',          label: `Liquid Balance (${chain.coreSymbol})`}
+    ];
+  }
+
+  ngOnInit() {
+    const headers = new Headers({
+      'X-CSRF-Token': this.cookies.get('csrf')
+    });
+
+    this.http.get('/api/thresholds', {headers})
+      .subscribe(
+        (res) => {
+          this.model = <AccountThreshold[]>res.json();
+          this.disabled = false;
+        },
+        (err) => this.errorMessage = `${err.status} ${err.text()}`
+      );
+  }
+
+  metricLabel(id: string) : string {
+    const metric = this.metrics.find(m => m.id === id);
+    return metric ? metric.label : id;
+  }
+
+  add() {
+    if (this.disabled) {
+      return;
+    }
+    this.disabled = true;
+
+    const headers = new Headers({
+      'Content-Type': 'application/json',
+      'X-CSRF-Token': this.cookies.get('csrf')
+    });
+
+    const threshold = Object.assign({}, this.input, {
+      threshold:  +this.input.threshold,
+      hysteresis: +this.input.hysteresis || 0
+    });
+
+    this.http.post('/api/thresholds', JSON.stringify(threshold), {headers})
+      .subscribe(
+        (res) => {
+          this.model.push(<AccountThreshold>res.json());
+          this.input = this.emptyInput();
+          this.disabled = false;
+          this.errorMessage = null;
+        },
+        (err) => {
+          this.disabled = false;
+          this.errorMessage = `${err.status} ${err.text()}`;
+        }
+      );
+  }
+
+  remove(threshold: AccountThreshold) {
+    if (this.disabled) {
+      return;
+    }
+    this.disabled = true;
+
+    const headers = new Headers({
+      'X-CSRF-Token': this.cookies.get('csrf')
+    });
+
+    this.http.delete(`/api/thresholds/${threshold.id}`, {headers})
+      .subscribe(
+        () => {
+          this.model = this.model.filter(t => t.id !== threshold.id);
+          this.disabled = false;
+          this.errorMessage = null;
+        },
+        (err) => {
+          this.disabled = false;
+          this.errorMessage = `${err.status} ${err.text()}`;
+        }
+      );
+  }
+
+  private emptyInput() : AccountThreshold {
+    return {account: '', metric: 'voting_power', threshold: null};
+  }
+}
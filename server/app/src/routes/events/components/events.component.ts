@@ -6,14 +6,15 @@ import { Event } from '../../../interfaces';
 
 import { EventsService }  from '../services/events.service';
 
-import { EventListComponent } from './event-list.component';
+import { EventListComponent }         from './event-list.component';
+import { AccountThresholdsComponent } from './account-thresholds.component';
 
 
 @Component({
   moduleId: module.id,
   templateUrl: 'events.component.html',
   providers: [EventsService],
-  directives: [EventListComponent]
+  directives: [EventListComponent, AccountThresholdsComponent]
 })
 export class EventsComponent implements OnInit {
 
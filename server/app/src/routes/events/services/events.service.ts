@@ -96,13 +96,35 @@ const events : Event[] = [
         id:          "tags",
         label:       "Tags",
         description: "You will be notified when a story with one of the following tags is published."
+      },
+      {
+        id:          "authorBlacklist",
+        label:       "Author Blacklist",
+        description: "The notification is dropped when the story is published by one of the following authors."
+      },
+      {
+        id:          "tagBlacklist",
+        label:       "Tag Blacklist",
+        description: "The notification is dropped when the story is tagged with one of the following tags."
+      }
+    ]
+  },
+  {
+    id:          "story.payout_soon",
+    title:       "Story Payout Soon",
+    description: "A story is about to pay out.",
+    fields:      [
+      {
+        id:          "authors",
+        label:       "Story Authors",
+        description: "You will be reminded shortly before a story by one of the following authors pays out. Only the stories published after the author is added are covered."
       }
     ]
   },
   {
     id:          "story.voted",
     title:       "Story Voted",
-    description: "A story vote was cast.",
+    description: "A story vote was cast or removed.",
     fields:      [
       {
         id:          "authors",
@@ -113,6 +135,43 @@ const events : Event[] = [
         id:          "voters",
         label:       "Story Voters",
         description: "You will be notified when a story vote is cast by one of the following voters."
+      },
+      {
+        id:          "authorBlacklist",
+        label:       "Author Blacklist",
+        description: "The notification is dropped when the story was published by one of the following authors."
+      },
+      {
+        id:          "tagBlacklist",
+        label:       "Tag Blacklist",
+        description: "The notification is dropped when the story is tagged with one of the following tags."
+      }
+    ]
+  },
+  {
+    id:          "story.flagged",
+    title:       "Story Flagged",
+    description: "A story was flagged or a flag was removed. The flags matching both are only sent as Story Flagged, not as Story Voted.",
+    fields:      [
+      {
+        id:          "authors",
+        label:       "Story Authors",
+        description: "You will be notified when a story by one of the following authors is flagged."
+      },
+      {
+        id:          "voters",
+        label:       "Story Flaggers",
+        description: "You will be notified when a story flag is cast by one of the following voters."
+      },
+      {
+        id:          "authorBlacklist",
+        label:       "Author Blacklist",
+        description: "The notification is dropped when the story was published by one of the following authors."
+      },
+      {
+        id:          "tagBlacklist",
+        label:       "Tag Blacklist",
+        description: "The notification is dropped when the story is tagged with one of the following tags."
       }
     ]
   },
@@ -130,13 +189,23 @@ const events : Event[] = [
         id:          "parentAuthors",
         label:       "Parent Authors",
         description: "You will be notified when a reply is published to a comment by one of the following authors."
+      },
+      {
+        id:          "authorBlacklist",
+        label:       "Author Blacklist",
+        description: "The notification is dropped when the comment is published by one of the following authors."
+      },
+      {
+        id:          "tagBlacklist",
+        label:       "Tag Blacklist",
+        description: "The notification is dropped when the comment is tagged with one of the following tags."
       }
     ]
   },
   {
     id:          "comment.voted",
     title:       "Comment Voted",
-    description: "A comment vote was cast.",
+    description: "A comment vote was cast or removed.",
     fields:      [
       {
         id:          "authors",
@@ -147,6 +216,87 @@ const events : Event[] = [
         id:          "voters",
         label:       "Comment Voters",
         description: "You will be notified when a comment vote is cast by one of the following voters."
+      },
+      {
+        id:          "authorBlacklist",
+        label:       "Author Blacklist",
+        description: "The notification is dropped when the comment was published by one of the following authors."
+      },
+      {
+        id:          "tagBlacklist",
+        label:       "Tag Blacklist",
+        description: "The notification is dropped when the comment is tagged with one of the following tags."
+      }
+    ]
+  },
+  {
+    id:          "comment.flagged",
+    title:       "Comment Flagged",
+    description: "A comment was flagged or a flag was removed. The flags matching both are only sent as Comment Flagged, not as Comment Voted.",
+    fields:      [
+      {
+        id:          "authors",
+        label:       "Comment Authors",
+        description: "You will be notified when a comment by one of the following authors is flagged."
+      },
+      {
+        id:          "voters",
+        label:       "Comment Flaggers",
+        description: "You will be notified when a comment flag is cast by one of the following voters."
+      },
+      {
+        id:          "authorBlacklist",
+        label:       "Author Blacklist",
+        description: "The notification is dropped when the comment was published by one of the following authors."
+      },
+      {
+        id:          "tagBlacklist",
+        label:       "Tag Blacklist",
+        description: "The notification is dropped when the comment is tagged with one of the following tags."
+      }
+    ]
+  },
+  {
+    id:          "content.matched",
+    title:       "Content Matched",
+    description: "A story or a comment matching a keyword or a pattern was published. Edits are not matched again.",
+    fields:      [
+      {
+        id:          "keywords",
+        label:       "Keywords",
+        description: "You will be notified when a story or a comment title or body contains one of the following keywords. Letter case is ignored."
+      },
+      {
+        id:          "words",
+        label:       "Whole Words",
+        description: "You will be notified when a story or a comment title or body contains one of the following words. Only whole words are matched, letter case is ignored."
+      },
+      {
+        id:          "patterns",
+        label:       "Regular Expressions",
+        description: "You will be notified when a story or a comment title or body matches one of the following regular expressions. Letter case is ignored, at most 10 expressions are used."
+      }
+    ]
+  },
+  {
+    id:          "price.alert",
+    title:       "Price Alert",
+    description: "The median price feed crossed a level or moved significantly.",
+    fields:      [
+      {
+        id:          "above",
+        label:       "Rising Above",
+        description: "You will be notified when the median price rises to or above one of the following levels, e.g. 1.05."
+      },
+      {
+        id:          "below",
+        label:       "Dropping Below",
+        description: "You will be notified when the median price drops to or below one of the following levels, e.g. 0.95."
+      },
+      {
+        id:          "moves",
+        label:       "Moves",
+        description: "You will be notified when the median price moves by at least the given percentage within the given window, e.g. 5/24h. The window is 1h when omitted, the longest window supported is 720h."
       }
     ]
   }
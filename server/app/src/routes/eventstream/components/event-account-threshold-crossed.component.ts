@@ -0,0 +1,16 @@
+import { Component, Input } from '@angular/core';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'event-account-threshold-crossed',
+  templateUrl: 'event-account-threshold-crossed.component.html'
+})
+export class AccountThresholdCrossedEventComponent {
+
+  @Input() model: any;
+
+  isRelated(account: string) : boolean {
+    return (this.model.account === account);
+  }
+}
@@ -0,0 +1,17 @@
+import { Component, Input } from '@angular/core';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'event-comment-flagged',
+  templateUrl: 'event-comment-flagged.component.html',
+  styleUrls: ['event-comment-flagged.component.css']
+})
+export class CommentFlaggedEventComponent {
+
+  @Input() model: any;
+
+  isRelated(account: string) : boolean {
+    return (this.model.author === account);
+  }
+}
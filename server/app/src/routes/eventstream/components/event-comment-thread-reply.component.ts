@@ -0,0 +1,16 @@
+import { Component, Input } from '@angular/core';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'event-comment-thread-reply',
+  templateUrl: 'event-comment-thread-reply.component.html'
+})
+export class CommentThreadReplyEventComponent {
+
+  @Input() model: any;
+
+  isRelated(account: string) : boolean {
+    return (this.model.author === account || this.model.parentAuthor === account);
+  }
+}
@@ -0,0 +1,12 @@
+import { Component, Input } from '@angular/core';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'event-price-alert',
+  templateUrl: 'event-price-alert.component.html'
+})
+export class PriceAlertEventComponent {
+
+  @Input() model: any;
+}
@@ -0,0 +1,17 @@
+import { Component, Input } from '@angular/core';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'event-story-flagged',
+  templateUrl: 'event-story-flagged.component.html',
+  styleUrls: ['event-story-flagged.component.css']
+})
+export class StoryFlaggedEventComponent {
+
+  @Input() model: any;
+
+  isRelated(account: string) : boolean {
+    return (this.model.author === account);
+  }
+}
@@ -0,0 +1,16 @@
+import { Component, Input } from '@angular/core';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'event-story-payout-soon',
+  templateUrl: 'event-story-payout-soon.component.html'
+})
+export class StoryPayoutSoonEventComponent {
+
+  @Input() model: any;
+
+  isRelated(account: string) : boolean {
+    return (this.model.author === account);
+  }
+}
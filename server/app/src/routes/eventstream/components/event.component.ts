@@ -23,7 +23,13 @@ import { UserFollowStatusChangedEventComponent } from './event-user-follow-statu
 import { StoryPublishedEventComponent }          from './event-story-published.component';
 import { StoryVotedEventComponent }              from './event-story-voted.component';
 import { CommentPublishedEventComponent }        from './event-comment-published.component';
+import { CommentThreadReplyEventComponent }      from './event-comment-thread-reply.component';
 import { CommentVotedEventComponent }            from './event-comment-voted.component';
+import { StoryFlaggedEventComponent }            from './event-story-flagged.component';
+import { CommentFlaggedEventComponent }          from './event-comment-flagged.component';
+import { StoryPayoutSoonEventComponent }         from './event-story-payout-soon.component';
+import { AccountThresholdCrossedEventComponent } from './event-account-threshold-crossed.component';
+import { PriceAlertEventComponent }              from './event-price-alert.component';
 
 
 @Component({
@@ -43,7 +49,13 @@ import { CommentVotedEventComponent }            from './event-comment-voted.com
     StoryPublishedEventComponent,
     StoryVotedEventComponent,
     CommentPublishedEventComponent,
-    CommentVotedEventComponent
+    CommentThreadReplyEventComponent,
+    CommentVotedEventComponent,
+    StoryFlaggedEventComponent,
+    CommentFlaggedEventComponent,
+    StoryPayoutSoonEventComponent,
+    AccountThresholdCrossedEventComponent,
+    PriceAlertEventComponent
   ]
 })
 export class EventComponent implements OnInit, AfterViewInit {
@@ -7,6 +7,7 @@ import 'rxjs/add/operator/do';
 
 import { ReconnectingWebSocket } from '../../../common/ReconnectingWebSocket';
 
+import { ContextService } from '../../../services/context.service';
 import { MessageService } from '../../../services/message.service';
 import { ProfileService } from '../../../services/profile.service';
 
@@ -40,6 +41,7 @@ export class EventStreamComponent implements OnInit, OnDestroy {
 
   constructor(
     private streamService: EventStreamService,
+    private contextService: ContextService,
     private profileService: ProfileService,
     private messageService: MessageService
   ) {}
@@ -97,7 +99,7 @@ export class EventStreamComponent implements OnInit, OnDestroy {
       }
 
       notification = new Notification('SteemWatch Event Stream', {
-        icon: 'https://steemit.com/images/favicons/favicon-128.png',
+        icon: this.contextService.getContext().chain.iconURL,
         body: `${numEvents} new ${numEvents === 1 ? 'event' : 'events'} received`,
         tag:  'steemwatch'
       });
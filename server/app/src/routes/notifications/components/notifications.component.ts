@@ -1,6 +1,6 @@
 import { Component, OnInit } from '@angular/core';
 
-import { MessageService } from '../../../services/index';
+import { ContextService, MessageService } from '../../../services/index';
 
 import { DiscordComponent }     from './discord.component';
 import { TelegramComponent }    from './telegram.component';
@@ -15,7 +15,15 @@ import { SteemitChatComponent } from './steemit-chat.component';
 })
 export class NotificationsComponent implements OnInit {
 
-  constructor(private messageService: MessageService) {}
+  // steemit.chat is not available for all the chains.
+  chatAvailable: boolean;
+
+  constructor(
+    private contextService: ContextService,
+    private messageService: MessageService
+  ) {
+    this.chatAvailable = contextService.getContext().chain.chatAvailable;
+  }
 
   ngOnInit() {
     this.messageService.hideMessage();
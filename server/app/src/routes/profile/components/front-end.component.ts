@@ -0,0 +1,84 @@
+import { Component, OnInit } from '@angular/core';
+import { Http, Headers }     from '@angular/http';
+
+import { CookieService } from 'angular2-cookie/core';
+
+import { ContextService, FrontEnd } from '../../../services/context.service';
+
+
+const CUSTOM = 'custom';
+
+
+@Component({
+  moduleId: module.id,
+  selector: 'front-end',
+  templateUrl: 'front-end.component.html'
+})
+export class FrontEndComponent implements OnInit {
+
+  frontEnds: FrontEnd[];
+  model: FrontEnd;
+
+  saving: boolean = false;
+  saved: boolean = false;
+  errorMessage: string;
+
+  constructor(
+    private http:           Http,
+    private cookies:        CookieService,
+    private contextService: ContextService
+  ) {
+    this.frontEnds = contextService.getContext().chain.frontEnds;
+  }
+
+  ngOnInit() {
+    const headers = new Headers({
+      'X-CSRF-Token': this.cookies.get('csrf')
+    });
+
+    this.http.get('/api/profile/frontend', {headers})
+      .subscribe(
+        (res) => this.model = <FrontEnd>res.json(),
+        (err) => this.errorMessage = `${err.status} ${err.text()}`
+      );
+  }
+
+  isCustom() : boolean {
+    return this.model.name === CUSTOM;
+  }
+
+  select(name: string) {
+    this.saved = false;
+
+    if (name === CUSTOM) {
+      // Start from the templates selected so far.
+      this.model = Object.assign({}, this.model, {name: CUSTOM});
+      return;
+    }
+
+    const frontEnd = this.frontEnds.find(fe => fe.name === name);
+    this.model = Object.assign({}, frontEnd);
+  }
+
+  onSubmit() {
+    this.saving = true;
+
+    const headers = new Headers({
+      'Content-Type': 'application/json',
+      'X-CSRF-Token': this.cookies.get('csrf')
+    });
+
+    this.http.put('/api/profile/frontend', JSON.stringify(this.model), {headers})
+      .subscribe(
+        () => {
+          this.saving = false;
+          this.saved = true;
+          this.errorMessage = null;
+        },
+        (err) => {
+          this.saving = false;
+          this.errorMessage = `${err.status} ${err.text()}`;
+        }
+      );
+  }
+}
@@ -2,11 +2,13 @@ import { Component } from '@angular/core';
 
 import { ListComponent } from '../../../components/list.component';
 
+import { FrontEndComponent } from './front-end.component';
+
 
 @Component({
   moduleId: module.id,
   templateUrl: 'profile.component.html',
   styleUrls: ['profile.component.css'],
-  directives: [ListComponent]
+  directives: [ListComponent, FrontEndComponent]
 })
 export class ProfileComponent {}
@@ -6,10 +6,30 @@ export interface User {
   email: string;
 }
 
+export interface FrontEnd {
+  name:          string;
+  postURL?:      string;
+  accountURL?:   string;
+  transfersURL?: string;
+}
+
+export interface Chain {
+  name:               string;
+  displayName:        string;
+  coreSymbol:         string;
+  dollarSymbol:       string;
+  frontEnd:           FrontEnd;
+  frontEnds:          FrontEnd[];
+  iconURL:            string;
+  explorerAccountURL: string;
+  chatAvailable:      boolean;
+}
+
 export interface Context {
   canonicalURL: string;
   env:          string;
   user:         User;
+  chain:        Chain;
 }
 
 declare var ctx: Context;
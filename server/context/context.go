@@ -3,8 +3,10 @@ package context
 import (
 	"net/url"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/server/sessions"
 
+	"github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 )
 
@@ -21,4 +23,6 @@ type Context struct {
 	SessionManager *sessions.SessionManager
 	DB             *mgo.Database
 	SSLEnabled     bool
+	Logger         *logrus.Entry
+	Chain          *chain.Profile
 }
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"github.com/tchap/steemwatch/notifications/revision"
+	"github.com/tchap/steemwatch/server/context"
+
+	"github.com/labstack/echo"
+)
+
+// TouchOnWrite returns a middleware incrementing the subscriptions revision
+// every time a request that is not read-only is handled successfully.
+func TouchOnWrite(serverCtx *context.Context) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if err := next(ctx); err != nil {
+				return err
+			}
+
+			switch ctx.Request().Method {
+			case echo.GET, echo.HEAD, echo.OPTIONS:
+				return nil
+			}
+
+			if err := revision.Touch(serverCtx.DB); err != nil {
+				serverCtx.Logger.WithError(err).Error("failed to touch the subscriptions revision")
+			}
+			return nil
+		}
+	}
+}
@@ -3,41 +3,63 @@ package eventstream
 import (
 	"bufio"
 	"strings"
+	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 )
 
 type Event struct {
 	Kind    string      `json:"kind"`
 	Payload interface{} `json:"payload,omitempty"`
+
+	// Delayed events carry the time they actually happened at.
+	Delayed   bool       `json:"delayed,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// withOrigin marks the event as delayed in case it is being delivered late.
+func withOrigin(event *Event, origin *events.Origin) *Event {
+	if origin.IsDelayed() {
+		timestamp := origin.Timestamp
+		event.Delayed = true
+		event.Timestamp = &timestamp
+	}
+	return event
 }
 
 type AccountUpdatedPayload struct {
-	Account string `json:"account"`
+	Account    string `json:"account"`
+	AccountURL string `json:"accountURL"`
 }
 
-func formatAccountUpdated(event *events.AccountUpdated) *Event {
+func formatAccountUpdated(profile *chain.Profile, event *events.AccountUpdated) *Event {
 	return &Event{
 		Kind: "account.updated",
 		Payload: &AccountUpdatedPayload{
-			Account: event.Op.Account,
+			Account:    event.Op.Account,
+			AccountURL: profile.ExplorerAccountLink(event.Op.Account),
 		},
 	}
 }
 
 type AccountWitnessVotedPayload struct {
-	Account string `json:"account"`
-	Witness string `json:"witness"`
-	Approve bool   `json:"approve"`
+	Account    string `json:"account"`
+	AccountURL string `json:"accountURL"`
+	Witness    string `json:"witness"`
+	WitnessURL string `json:"witnessURL"`
+	Approve    bool   `json:"approve"`
 }
 
-func formatAccountWitnessVoted(event *events.AccountWitnessVoted) *Event {
+func formatAccountWitnessVoted(profile *chain.Profile, event *events.AccountWitnessVoted) *Event {
 	return &Event{
 		Kind: "account.witness_voted",
 		Payload: &AccountWitnessVotedPayload{
-			Account: event.Op.Account,
-			Witness: event.Op.Witness,
-			Approve: event.Op.Approve,
+			Account:    event.Op.Account,
+			AccountURL: profile.FrontEnd.Account(event.Op.Account),
+			Witness:    event.Op.Witness,
+			WitnessURL: profile.FrontEnd.Account(event.Op.Witness),
+			Approve:    event.Op.Approve,
 		},
 	}
 }
@@ -49,13 +71,13 @@ type TransferMadePayload struct {
 	Memo   string `json:"memo,omitempty"`
 }
 
-func formatTransferMade(event *events.TransferMade) *Event {
+func formatTransferMade(profile *chain.Profile, event *events.TransferMade) *Event {
 	return &Event{
 		Kind: "transfer.made",
 		Payload: &TransferMadePayload{
 			From:   event.Op.From,
 			To:     event.Op.To,
-			Amount: event.Op.Amount,
+			Amount: profile.FormatAmount(event.Op.Amount),
 			Memo:   event.Op.Memo,
 		},
 	}
@@ -63,17 +85,19 @@ func formatTransferMade(event *events.TransferMade) *Event {
 
 type UserMentionedPayload struct {
 	User     string `json:"user"`
+	UserURL  string `json:"userURL"`
 	URL      string `json:"url"`
 	Author   string `json:"author"`
 	Permlink string `json:"permlink"`
 }
 
-func formatUserMentioned(event *events.UserMentioned) *Event {
+func formatUserMentioned(profile *chain.Profile, event *events.UserMentioned) *Event {
 	return &Event{
 		Kind: "user.mentioned",
 		Payload: &UserMentionedPayload{
 			User:     event.User,
-			URL:      event.Content.URL,
+			UserURL:  profile.FrontEnd.Account(event.User),
+			URL:      profile.FrontEnd.Post(event.Content),
 			Author:   event.Content.Author,
 			Permlink: event.Content.Permlink,
 		},
@@ -81,12 +105,14 @@ func formatUserMentioned(event *events.UserMentioned) *Event {
 }
 
 type UserFollowStatusChangedPayload struct {
-	Follower  string `json:"follower"`
-	Following string `json:"following"`
-	What      string `json:"what,omitempty"`
+	Follower     string `json:"follower"`
+	FollowerURL  string `json:"followerURL"`
+	Following    string `json:"following"`
+	FollowingURL string `json:"followingURL"`
+	What         string `json:"what,omitempty"`
 }
 
-func formatUserFollowStatusChanged(event *events.UserFollowStatusChanged) *Event {
+func formatUserFollowStatusChanged(profile *chain.Profile, event *events.UserFollowStatusChanged) *Event {
 	var what string
 	for _, v := range event.Op.What {
 		what = v
@@ -104,36 +130,45 @@ func formatUserFollowStatusChanged(event *events.UserFollowStatusChanged) *Event
 	return &Event{
 		Kind: "user.follow_changed",
 		Payload: &UserFollowStatusChangedPayload{
-			Follower:  event.Op.Follower,
-			Following: event.Op.Following,
-			What:      what,
+			Follower:     event.Op.Follower,
+			FollowerURL:  profile.FrontEnd.Account(event.Op.Follower),
+			Following:    event.Op.Following,
+			FollowingURL: profile.FrontEnd.Account(event.Op.Following),
+			What:         what,
 		},
 	}
 }
 
 type StoryPublishedPayload struct {
-	Author string   `json:"author"`
-	Title  string   `json:"title"`
-	URL    string   `json:"url"`
-	Tags   []string `json:"tags"`
+	Author    string   `json:"author"`
+	AuthorURL string   `json:"authorURL"`
+	Title     string   `json:"title"`
+	URL       string   `json:"url"`
+	Tags      []string `json:"tags"`
 }
 
-func formatStoryPublished(event *events.StoryPublished) *Event {
+func formatStoryPublished(profile *chain.Profile, event *events.StoryPublished) *Event {
 	return &Event{
 		Kind: "story.published",
 		Payload: &StoryPublishedPayload{
-			Author: event.Content.Author,
-			Title:  event.Content.Title,
-			URL:    event.Content.URL,
-			Tags:   event.Content.JsonMetadata.Tags,
+			Author:    event.Content.Author,
+			AuthorURL: profile.FrontEnd.Account(event.Content.Author),
+			Title:     event.Content.Title,
+			URL:       profile.FrontEnd.Post(event.Content),
+			Tags:      event.Content.JsonMetadata.Tags,
 		},
 	}
 }
 
+// StoryVotedPayload is used for story.flagged as well.
 type StoryVotedPayload struct {
 	Voter              string `json:"voter"`
+	VoterURL           string `json:"voterURL"`
 	VoteWeight         int16  `json:"voteWeight"`
+	VoteValue          string `json:"voteValue,omitempty"`
+	Removed            bool   `json:"removed,omitempty"`
 	Author             string `json:"author"`
+	AuthorURL          string `json:"authorURL"`
 	Title              string `json:"title"`
 	URL                string `json:"url"`
 	TotalPayout        string `json:"totalPayout"`
@@ -141,24 +176,57 @@ type StoryVotedPayload struct {
 	TotalPendingPayout string `json:"totalPendingPayout"`
 }
 
-func formatStoryVoted(event *events.StoryVoted) *Event {
+// formatVoteValue formats the estimated vote value, if known.
+func formatVoteValue(profile *chain.Profile, value string) string {
+	if value == "" {
+		return ""
+	}
+	return profile.FormatAmount(value)
+}
+
+func formatStoryVoted(profile *chain.Profile, event *events.StoryVoted) *Event {
 	return &Event{
 		Kind: "story.voted",
 		Payload: &StoryVotedPayload{
 			Voter:              event.Op.Voter,
+			VoterURL:           profile.FrontEnd.Account(event.Op.Voter),
+			VoteWeight:         int16(event.Op.Weight),
+			VoteValue:          formatVoteValue(profile, event.Value),
+			Removed:            event.Removed,
+			Author:             event.Content.Author,
+			AuthorURL:          profile.FrontEnd.Account(event.Content.Author),
+			Title:              event.Content.Title,
+			URL:                profile.FrontEnd.Post(event.Content),
+			TotalPayout:        profile.FormatAmount(event.Content.TotalPayoutValue),
+			PendingPayout:      profile.FormatAmount(event.Content.PendingPayoutValue),
+			TotalPendingPayout: profile.FormatAmount(event.Content.TotalPendingPayoutValue),
+		},
+	}
+}
+
+func formatStoryFlagged(profile *chain.Profile, event *events.StoryFlagged) *Event {
+	return &Event{
+		Kind: "story.flagged",
+		Payload: &StoryVotedPayload{
+			Voter:              event.Op.Voter,
+			VoterURL:           profile.FrontEnd.Account(event.Op.Voter),
 			VoteWeight:         int16(event.Op.Weight),
+			VoteValue:          formatVoteValue(profile, event.Value),
+			Removed:            event.Removed,
 			Author:             event.Content.Author,
+			AuthorURL:          profile.FrontEnd.Account(event.Content.Author),
 			Title:              event.Content.Title,
-			URL:                event.Content.URL,
-			TotalPayout:        event.Content.TotalPayoutValue,
-			PendingPayout:      event.Content.PendingPayoutValue,
-			TotalPendingPayout: event.Content.TotalPendingPayoutValue,
+			URL:                profile.FrontEnd.Post(event.Content),
+			TotalPayout:        profile.FormatAmount(event.Content.TotalPayoutValue),
+			PendingPayout:      profile.FormatAmount(event.Content.PendingPayoutValue),
+			TotalPendingPayout: profile.FormatAmount(event.Content.TotalPendingPayoutValue),
 		},
 	}
 }
 
 type CommentPublishedPayload struct {
 	Author         string `json:"author"`
+	AuthorURL      string `json:"authorURL"`
 	URL            string `json:"url"`
 	ParentAuthor   string `json:"parentAuthor"`
 	ParentPermlink string `json:"parentPermlink"`
@@ -166,7 +234,7 @@ type CommentPublishedPayload struct {
 	ReadMore       bool   `json:"more,omitempty"`
 }
 
-func formatCommentPublished(event *events.CommentPublished) *Event {
+func formatCommentPublished(profile *chain.Profile, event *events.CommentPublished) *Event {
 	commentLines := make([]string, 0, 5)
 	scanner := bufio.NewScanner(strings.NewReader(event.Content.Body))
 	i := 0
@@ -182,7 +250,8 @@ func formatCommentPublished(event *events.CommentPublished) *Event {
 		Kind: "comment.published",
 		Payload: &CommentPublishedPayload{
 			Author:         event.Content.Author,
-			URL:            event.Content.URL,
+			AuthorURL:      profile.FrontEnd.Account(event.Content.Author),
+			URL:            profile.FrontEnd.Post(event.Content),
 			ParentAuthor:   event.Content.ParentAuthor,
 			ParentPermlink: event.Content.ParentPermlink,
 			Content:        content,
@@ -191,9 +260,38 @@ func formatCommentPublished(event *events.CommentPublished) *Event {
 	}
 }
 
+type CommentThreadReplyPayload struct {
+	CommentPublishedPayload
+
+	RootAuthor   string `json:"rootAuthor"`
+	RootPermlink string `json:"rootPermlink"`
+	RootURL      string `json:"rootURL"`
+}
+
+func formatCommentThreadReply(profile *chain.Profile, event *events.CommentThreadReply) *Event {
+	published := formatCommentPublished(profile, &events.CommentPublished{
+		Op:      event.Op,
+		Content: event.Content,
+	})
+
+	return &Event{
+		Kind: "comment.thread_reply",
+		Payload: &CommentThreadReplyPayload{
+			CommentPublishedPayload: *published.Payload.(*CommentPublishedPayload),
+			RootAuthor:              event.RootAuthor,
+			RootPermlink:            event.RootPermlink,
+			RootURL:                 profile.FrontEnd.Post(event.Root()),
+		},
+	}
+}
+
+// CommentVotedPayload is used for comment.flagged as well.
 type CommentVotedPayload struct {
 	Voter              string `json:"voter"`
+	VoterURL           string `json:"voterURL"`
 	VoteWeight         int16  `json:"voteWeight"`
+	VoteValue          string `json:"voteValue,omitempty"`
+	Removed            bool   `json:"removed,omitempty"`
 	Author             string `json:"author"`
 	Permlink           string `json:"permlink"`
 	URL                string `json:"url"`
@@ -202,18 +300,185 @@ type CommentVotedPayload struct {
 	TotalPendingPayout string `json:"totalPendingPayout"`
 }
 
-func formatCommentVoted(event *events.CommentVoted) *Event {
+func formatCommentVoted(profile *chain.Profile, event *events.CommentVoted) *Event {
 	return &Event{
 		Kind: "comment.voted",
 		Payload: &CommentVotedPayload{
 			Voter:              event.Op.Voter,
+			VoterURL:           profile.FrontEnd.Account(event.Op.Voter),
+			VoteWeight:         int16(event.Op.Weight),
+			VoteValue:          formatVoteValue(profile, event.Value),
+			Removed:            event.Removed,
+			Author:             event.Content.Author,
+			Permlink:           event.Content.Permlink,
+			URL:                profile.FrontEnd.Post(event.Content),
+			TotalPayout:        profile.FormatAmount(event.Content.TotalPayoutValue),
+			PendingPayout:      profile.FormatAmount(event.Content.PendingPayoutValue),
+			TotalPendingPayout: profile.FormatAmount(event.Content.TotalPendingPayoutValue),
+		},
+	}
+}
+
+func formatCommentFlagged(profile *chain.Profile, event *events.CommentFlagged) *Event {
+	return &Event{
+		Kind: "comment.flagged",
+		Payload: &CommentVotedPayload{
+			Voter:              event.Op.Voter,
+			VoterURL:           profile.FrontEnd.Account(event.Op.Voter),
 			VoteWeight:         int16(event.Op.Weight),
+			VoteValue:          formatVoteValue(profile, event.Value),
+			Removed:            event.Removed,
 			Author:             event.Content.Author,
 			Permlink:           event.Content.Permlink,
-			URL:                event.Content.URL,
-			TotalPayout:        event.Content.TotalPayoutValue,
-			PendingPayout:      event.Content.PendingPayoutValue,
-			TotalPendingPayout: event.Content.TotalPendingPayoutValue,
+			URL:                profile.FrontEnd.Post(event.Content),
+			TotalPayout:        profile.FormatAmount(event.Content.TotalPayoutValue),
+			PendingPayout:      profile.FormatAmount(event.Content.PendingPayoutValue),
+			TotalPendingPayout: profile.FormatAmount(event.Content.TotalPendingPayoutValue),
+		},
+	}
+}
+
+type ContentMatchedPayload struct {
+	Author    string   `json:"author"`
+	AuthorURL string   `json:"authorURL"`
+	Permlink  string   `json:"permlink"`
+	Title     string   `json:"title,omitempty"`
+	URL       string   `json:"url"`
+	Story     bool     `json:"story"`
+	Matches   []string `json:"matches"`
+}
+
+func formatContentMatched(profile *chain.Profile, event *events.ContentMatched) *Event {
+	return &Event{
+		Kind: "content.matched",
+		Payload: &ContentMatchedPayload{
+			Author:    event.Content.Author,
+			AuthorURL: profile.FrontEnd.Account(event.Content.Author),
+			Permlink:  event.Content.Permlink,
+			Title:     event.Content.Title,
+			URL:       profile.FrontEnd.Post(event.Content),
+			Story:     event.Content.IsStory(),
+			Matches:   event.Matches,
+		},
+	}
+}
+
+type StoryPayoutSoonPayload struct {
+	Author        string    `json:"author"`
+	AuthorURL     string    `json:"authorURL"`
+	Title         string    `json:"title"`
+	URL           string    `json:"url"`
+	PendingPayout string    `json:"pendingPayout"`
+	CashoutTime   time.Time `json:"cashoutTime"`
+	TimeLeft      string    `json:"timeLeft"`
+}
+
+func formatStoryPayoutSoon(profile *chain.Profile, event *events.StoryPayoutSoon) *Event {
+	return &Event{
+		Kind: "story.payout_soon",
+		Payload: &StoryPayoutSoonPayload{
+			Author:        event.Content.Author,
+			AuthorURL:     profile.FrontEnd.Account(event.Content.Author),
+			Title:         event.Content.Title,
+			URL:           profile.FrontEnd.Post(event.Content),
+			PendingPayout: profile.FormatAmount(event.Content.PendingPayoutValue),
+			CashoutTime:   event.CashoutTime,
+			TimeLeft:      event.FormattedTimeLeft(),
+		},
+	}
+}
+
+type AccountThresholdCrossedPayload struct {
+	Account    string  `json:"account"`
+	AccountURL string  `json:"accountURL"`
+	Metric     string  `json:"metric"`
+	MetricName string  `json:"metricName"`
+	Threshold  float64 `json:"threshold"`
+	Value      float64 `json:"value"`
+	// The values formatted including the unit.
+	FormattedThreshold string `json:"formattedThreshold"`
+	FormattedValue     string `json:"formattedValue"`
+}
+
+func formatAccountThresholdCrossed(profile *chain.Profile, event *events.AccountThresholdCrossed) *Event {
+	return &Event{
+		Kind: "account.threshold_crossed",
+		Payload: &AccountThresholdCrossedPayload{
+			Account:            event.Account,
+			AccountURL:         profile.FrontEnd.Account(event.Account),
+			Metric:             event.Metric,
+			MetricName:         event.MetricName(),
+			Threshold:          event.Threshold,
+			Value:              event.Value,
+			FormattedThreshold: profile.FormatAmount(event.FormattedThreshold()),
+			FormattedValue:     profile.FormatAmount(event.FormattedValue()),
+		},
+	}
+}
+
+type PriceAlertPayload struct {
+	Kind string `json:"kind"`
+	// Level is set for the above and below kinds.
+	Level float64 `json:"level,omitempty"`
+	// Percent, Window and Change are set for the move kind.
+	Percent       float64 `json:"percent,omitempty"`
+	Window        string  `json:"window,omitempty"`
+	Change        float64 `json:"change,omitempty"`
+	Description   string  `json:"description"`
+	Price         string  `json:"price"`
+	PreviousPrice string  `json:"previousPrice"`
+}
+
+func formatPriceAlert(profile *chain.Profile, event *events.PriceAlert) *Event {
+	payload := &PriceAlertPayload{
+		Kind:          event.Kind,
+		Level:         event.Level,
+		Percent:       event.Percent,
+		Change:        event.Change,
+		Description:   event.Describe(profile.FormatPrice),
+		Price:         profile.FormatPrice(event.Price),
+		PreviousPrice: profile.FormatPrice(event.PreviousPrice),
+	}
+	if event.Window != 0 {
+		payload.Window = event.Window.String()
+	}
+
+	return &Event{
+		Kind:    "price.alert",
+		Payload: payload,
+	}
+}
+
+type BlockOrphanedPayload struct {
+	BlockNum uint32   `json:"blockNum"`
+	Kinds    []string `json:"kinds"`
+	Count    int      `json:"count"`
+}
+
+func formatBlockOrphaned(event *events.BlockOrphaned) *Event {
+	return &Event{
+		Kind: "block.orphaned",
+		Payload: &BlockOrphanedPayload{
+			BlockNum: event.BlockNum,
+			Kinds:    event.Kinds,
+			Count:    event.Count,
+		},
+	}
+}
+
+type CatchUpDigestPayload struct {
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Counts map[string]int `json:"counts"`
+}
+
+func formatCatchUpDigest(event *events.CatchUpDigest) *Event {
+	return &Event{
+		Kind: "catch_up.digest",
+		Payload: &CatchUpDigestPayload{
+			From:   event.From,
+			To:     event.To,
+			Counts: event.Counts,
 		},
 	}
 }
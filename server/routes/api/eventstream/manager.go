@@ -1,10 +1,10 @@
 package eventstream
 
 import (
-	"log"
 	"sync"
 	"time"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/notifications/events"
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/users"
@@ -12,6 +12,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -20,19 +21,32 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+var numConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "steemwatch",
+	Name:      "eventstream_connections",
+	Help:      "Number of open event stream WebSocket connections.",
+})
+
+func init() {
+	prometheus.MustRegister(numConnections)
+}
+
 type connectionRecord struct {
 	conn *websocket.Conn
 	lock *sync.Mutex
 }
 
 type Manager struct {
+	profile     *chain.Profile
 	connections map[string]*connectionRecord
 	closed      bool
 	lock        *sync.RWMutex
 }
 
-func NewManager() *Manager {
+// NewManager creates a manager rendering the events for the given chain.
+func NewManager(profile *chain.Profile) *Manager {
 	return &Manager{
+		profile:     profile,
 		connections: make(map[string]*connectionRecord),
 		lock:        &sync.RWMutex{},
 	}
@@ -65,8 +79,9 @@ func (manager *Manager) Bind(serverCtx *context.Context, group *echo.Group) {
 
 			// Insert the new connection record into the map.
 			manager.connections[userID] = &connectionRecord{conn, &sync.Mutex{}}
-			log.Println(
-				"WebSocket connection added. Number of connections:", len(manager.connections))
+			numConnections.Set(float64(len(manager.connections)))
+			serverCtx.Logger.WithField("connections", len(manager.connections)).
+				Info("WebSocket connection added")
 			manager.lock.Unlock()
 
 			for {
@@ -74,9 +89,9 @@ func (manager *Manager) Bind(serverCtx *context.Context, group *echo.Group) {
 				if err != nil {
 					manager.lock.Lock()
 					delete(manager.connections, userID)
-					log.Println(
-						"WebSocket connection removed. Number of connections:",
-						len(manager.connections))
+					numConnections.Set(float64(len(manager.connections)))
+					serverCtx.Logger.WithField("connections", len(manager.connections)).
+						Info("WebSocket connection removed")
 					manager.lock.Unlock()
 					return
 				}
@@ -122,74 +137,174 @@ func (manager *Manager) Close() error {
 	return nil
 }
 
+// userProfile returns the chain profile using the front-end chosen by the user.
+func (manager *Manager) userProfile(userSettings bson.Raw) *chain.Profile {
+	if len(userSettings.Data) == 0 {
+		return manager.profile
+	}
+	var preferences chain.Preferences
+	if err := userSettings.Unmarshal(&preferences); err != nil {
+		return manager.profile
+	}
+	return manager.profile.WithFrontEnd(preferences.FrontEnd)
+}
+
 func (manager *Manager) DispatchAccountUpdatedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.AccountUpdated,
 ) error {
-	return manager.sendEvent(userId, formatAccountUpdated(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatAccountUpdated(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchAccountWitnessVotedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.AccountWitnessVoted,
 ) error {
-	return manager.sendEvent(userId, formatAccountWitnessVoted(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatAccountWitnessVoted(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchTransferMadeEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.TransferMade,
 ) error {
-	return manager.sendEvent(userId, formatTransferMade(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatTransferMade(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchUserMentionedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.UserMentioned,
 ) error {
-	return manager.sendEvent(userId, formatUserMentioned(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatUserMentioned(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchUserFollowStatusChangedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.UserFollowStatusChanged,
 ) error {
-	return manager.sendEvent(userId, formatUserFollowStatusChanged(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatUserFollowStatusChanged(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchStoryPublishedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.StoryPublished,
 ) error {
-	return manager.sendEvent(userId, formatStoryPublished(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatStoryPublished(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchStoryVotedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.StoryVoted,
 ) error {
-	return manager.sendEvent(userId, formatStoryVoted(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatStoryVoted(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchCommentPublishedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.CommentPublished,
 ) error {
-	return manager.sendEvent(userId, formatCommentPublished(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatCommentPublished(profile, event), &event.Origin))
+}
+
+func (manager *Manager) DispatchCommentThreadReplyEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentThreadReply,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatCommentThreadReply(profile, event), &event.Origin))
 }
 
 func (manager *Manager) DispatchCommentVotedEvent(
 	userId string,
-	_ bson.Raw,
+	userSettings bson.Raw,
 	event *events.CommentVoted,
 ) error {
-	return manager.sendEvent(userId, formatCommentVoted(event))
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatCommentVoted(profile, event), &event.Origin))
+}
+
+func (manager *Manager) DispatchStoryFlaggedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryFlagged,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatStoryFlagged(profile, event), &event.Origin))
+}
+
+func (manager *Manager) DispatchCommentFlaggedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentFlagged,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatCommentFlagged(profile, event), &event.Origin))
+}
+
+func (manager *Manager) DispatchContentMatchedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.ContentMatched,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, withOrigin(formatContentMatched(profile, event), &event.Origin))
+}
+
+func (manager *Manager) DispatchStoryPayoutSoonEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryPayoutSoon,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, formatStoryPayoutSoon(profile, event))
+}
+
+func (manager *Manager) DispatchAccountThresholdCrossedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountThresholdCrossed,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, formatAccountThresholdCrossed(profile, event))
+}
+
+func (manager *Manager) DispatchPriceAlertEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PriceAlert,
+) error {
+	profile := manager.userProfile(userSettings)
+	return manager.sendEvent(userId, formatPriceAlert(profile, event))
+}
+
+func (manager *Manager) DispatchBlockOrphanedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.BlockOrphaned,
+) error {
+	return manager.sendEvent(userId, formatBlockOrphaned(event))
+}
+
+func (manager *Manager) DispatchCatchUpDigestEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CatchUpDigest,
+) error {
+	return manager.sendEvent(userId, formatCatchUpDigest(event))
 }
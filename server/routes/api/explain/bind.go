@@ -0,0 +1,59 @@
+package explain
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// Bind binds the explain endpoint, which tells the current user
+// why they were or weren't notified about the given operation.
+//
+// The operation is specified using either block=<number> or trx=<id>.
+// op=<index> selects a single operation within the block or the transaction.
+func Bind(serverCtx *context.Context, group *echo.Group, explainer *notifications.Explainer) {
+	group.GET("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		opNum := -1
+		if v := ctx.QueryParam("op"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid operation index")
+			}
+			opNum = n
+		}
+
+		var (
+			explanations []*notifications.Explanation
+			err          error
+		)
+		if trxId := ctx.QueryParam("trx"); trxId != "" {
+			explanations, err = explainer.ExplainTransactionOperation(profile.Id, trxId, opNum)
+		} else if v := ctx.QueryParam("block"); v != "" {
+			blockNum, ex := strconv.ParseUint(v, 10, 32)
+			if ex != nil || blockNum == 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid block number")
+			}
+			explanations, err = explainer.ExplainBlockOperation(profile.Id, uint32(blockNum), opNum)
+		} else {
+			return echo.NewHTTPError(http.StatusBadRequest, "block or trx must be specified")
+		}
+		if err != nil {
+			if errors.Cause(err) == notifications.ErrOperationNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "operation not found")
+			}
+			return err
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(explanations)
+	})
+}
@@ -2,8 +2,6 @@ package discord
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"strings"
 
 	mgo "gopkg.in/mgo.v2"
@@ -14,6 +12,7 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/kr/pretty"
 	"github.com/pkg/errors"
+	"github.com/tchap/steemwatch/notifications/revision"
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/users"
 
@@ -43,6 +42,8 @@ func InitBot(
 	serverCtx *context.Context,
 ) (*discordgo.Session, error) {
 
+	logger := serverCtx.Logger.WithField("component", "discord")
+
 	// Ensure indexes.
 	if err := serverCtx.DB.C("notifiers").EnsureIndex(mgo.Index{
 		Key:        []string{"settings.startToken"},
@@ -50,7 +51,7 @@ func InitBot(
 		Background: true,
 		Sparse:     true,
 	}); err != nil {
-		log.Printf("%# v", errors.Wrap(err, "failed to create index for Discord"))
+		logger.WithError(err).Error("failed to create index for Discord")
 	}
 
 	if err := serverCtx.DB.C("notifiers").EnsureIndex(mgo.Index{
@@ -59,7 +60,7 @@ func InitBot(
 		Background: true,
 		Sparse:     true,
 	}); err != nil {
-		log.Printf("%# v", errors.Wrap(err, "failed to create index for Discord"))
+		logger.WithError(err).Error("failed to create index for Discord")
 	}
 
 	// Discord now!
@@ -72,7 +73,7 @@ func InitBot(
 
 	var botID string
 	dg.AddHandler(func(s *discordgo.Session, msg *discordgo.Ready) {
-		fmt.Printf("DISCORD READY: %# v\n", pretty.Formatter(msg))
+		logger.Debugf("ready: %# v", pretty.Formatter(msg))
 		botID = msg.User.ID
 	})
 
@@ -87,13 +88,13 @@ func InitBot(
 			return
 		}
 
-		fmt.Printf("DISCORD MESSAGE: %# v\n", pretty.Formatter(msg))
+		logger.Debugf("message: %# v", pretty.Formatter(msg))
 
 		// Helpers.
 		channelID := msg.ChannelID
 		send := func(text string) {
 			if _, err := dg.ChannelMessageSend(channelID, text); err != nil {
-				log.Printf("discord: %# v", errors.Wrap(err, "failed to send a message"))
+				logger.WithError(err).Error("failed to send a message")
 			}
 		}
 
@@ -106,7 +107,7 @@ func InitBot(
 			var err error
 			channel, err = dg.Channel(channelID)
 			if err != nil {
-				log.Printf("discord: %# v", errors.Wrap(err, "failed get channel by ID"))
+				logger.WithError(err).Error("failed to get channel by ID")
 				send("Something went terribly wrong, sorry!")
 				return
 			}
@@ -177,7 +178,7 @@ To command me, simply send me a message containing one of the commands above.`
 				if err == mgo.ErrNotFound {
 					text = "You are not linked with SteemWatch yet!"
 				} else {
-					log.Printf("%# v", err)
+					logger.WithError(err).Error("failed to handle command")
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
@@ -199,7 +200,7 @@ To command me, simply send me a message containing one of the commands above.`
 				if errors.Cause(err) == mgo.ErrNotFound {
 					text = "SteemWatch link not found, did you call **link**?"
 				} else {
-					log.Printf("%# v", err)
+					logger.WithError(err).Error("failed to handle command")
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
@@ -215,7 +216,7 @@ To command me, simply send me a message containing one of the commands above.`
 				if errors.Cause(err) == mgo.ErrNotFound {
 					text = "SteemWatch link not found, did you call **link**?"
 				} else {
-					log.Printf("%# v", err)
+					logger.WithError(err).Error("failed to handle command")
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
@@ -231,7 +232,7 @@ To command me, simply send me a message containing one of the commands above.`
 				if errors.Cause(err) == mgo.ErrNotFound {
 					text = "SteemWatch link not found, did you call **link**?"
 				} else {
-					log.Printf("%# v", err)
+					logger.WithError(err).Error("failed to handle command")
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
@@ -267,10 +268,13 @@ To command me, simply send me a message containing one of the commands above.`
 						send("I don't recognize the token you provided.")
 					} else {
 						send("Something went terribly wrong, sorry!")
-						log.Printf("%# v", errors.Wrap(err, "failed to enable Discord"))
+						logger.WithError(err).Error("failed to enable Discord")
 					}
 					return
 				}
+				if err := revision.Touch(serverCtx.DB); err != nil {
+					logger.WithError(err).Error("failed to touch the subscriptions revision")
+				}
 
 				text = "SteemWatch account linked successfully."
 
@@ -294,11 +298,11 @@ To command me, simply send me a message containing one of the commands above.`
 	t.Go(func() error {
 		me, err := dg.User("@me")
 		if err != nil {
-			log.Println("discord: failed to get @me")
+			logger.WithError(err).Warn("failed to get @me")
 			return nil
 		}
 
-		fmt.Printf("DISCORD: I am %# v\n", pretty.Formatter(me))
+		logger.Debugf("I am %# v", pretty.Formatter(me))
 		return nil
 	})
 
@@ -382,8 +386,10 @@ func setEnabled(c *mgo.Collection, selector bson.M, enabled bool) error {
 		},
 	}
 
-	err := c.Update(selector, update)
-	return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	if err := c.Update(selector, update); err != nil {
+		return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	}
+	return revision.Touch(c.Database)
 }
 
 func unlink(c *mgo.Collection, selector bson.M) error {
@@ -400,6 +406,8 @@ func unlink(c *mgo.Collection, selector bson.M) error {
 		},
 	}
 
-	err := c.Update(selector, update)
-	return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	if err := c.Update(selector, update); err != nil {
+		return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	}
+	return revision.Touch(c.Database)
 }
@@ -11,6 +11,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/pkg/errors"
+	"github.com/tchap/steemwatch/notifications/revision"
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/users"
 
@@ -126,6 +127,9 @@ You will be receiving SteemWatch notifications in this channel.`
 				}
 				return errors.Wrap(err, "failed to enable Telegram")
 			}
+			if err := revision.Touch(serverCtx.DB); err != nil {
+				serverCtx.Logger.WithError(err).Error("failed to touch the subscriptions revision")
+			}
 
 			return ctx.JSON(http.StatusOK, map[string]interface{}{
 				"method":  "sendMessage",
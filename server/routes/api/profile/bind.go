@@ -3,17 +3,22 @@ package profile
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
 
+	"github.com/tchap/steemwatch/chain"
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/users"
 
 	"github.com/labstack/echo"
+	"github.com/pkg/errors"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type Profile struct {
-	Accounts []string `json:"accounts" bson:"accounts"`
+	Accounts      []string        `json:"accounts"           bson:"accounts"`
+	MutedAccounts []string        `json:"mutedAccounts"      bson:"mutedAccounts"`
+	FrontEnd      *chain.FrontEnd `json:"frontEnd,omitempty" bson:"frontEnd,omitempty"`
 }
 
 func Bind(serverCtx *context.Context, group *echo.Group) {
@@ -25,7 +30,9 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 		}
 
 		selector := bson.M{
-			"accounts": 1,
+			"accounts":      1,
+			"mutedAccounts": 1,
+			"frontEnd":      1,
 		}
 
 		var doc Profile
@@ -39,7 +46,18 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 		return json.NewEncoder(ctx.Response().Writer).Encode(&doc)
 	})
 
-	group.GET("/accounts/", func(ctx echo.Context) error {
+	// The accounts controlled by the user.
+	bindList(serverCtx, group.Group("/accounts"), "accounts")
+
+	// The accounts the user never wants to be notified about.
+	bindList(serverCtx, group.Group("/muted"), "mutedAccounts")
+
+	// The front-end used for the links in notifications.
+	bindFrontEnd(serverCtx, group.Group("/frontend"))
+}
+
+func bindFrontEnd(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
 		profile := ctx.Get("user").(*users.User)
 
 		query := bson.M{
@@ -47,21 +65,105 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 		}
 
 		selector := bson.M{
-			"accounts": 1,
+			"frontEnd": 1,
+		}
+
+		var doc Profile
+		err := serverCtx.DB.C("users").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+
+		// Send the chain default in case the user has not chosen any front-end.
+		frontEnd := doc.FrontEnd
+		if frontEnd == nil {
+			frontEnd = serverCtx.Chain.FrontEnd
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(frontEnd)
+	})
+
+	group.PUT("/", func(ctx echo.Context) error {
+		var frontEnd chain.FrontEnd
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&frontEnd); err != nil {
+			return errors.Wrap(err, "failed to decode request body")
+		}
+
+		// Only the templates of custom front-ends are stored,
+		// the predefined ones are referenced by name.
+		if frontEnd.Name == chain.CustomFrontEnd {
+			if err := frontEnd.Validate(); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+		} else {
+			if serverCtx.Chain.ResolveFrontEnd(&frontEnd) == nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "unknown front-end: "+frontEnd.Name)
+			}
+			frontEnd = chain.FrontEnd{Name: frontEnd.Name}
+		}
+
+		profile := ctx.Get("user").(*users.User)
+
+		selector := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"frontEnd": &frontEnd,
+			},
+		}
+
+		_, err := serverCtx.DB.C("users").Upsert(selector, update)
+		return err
+	})
+
+	group.DELETE("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		selector := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		update := bson.M{
+			"$unset": bson.M{
+				"frontEnd": "",
+			},
+		}
+
+		err := serverCtx.DB.C("users").Update(selector, update)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func bindList(serverCtx *context.Context, group *echo.Group, listName string) {
+	group.GET("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		query := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		selector := bson.M{
+			listName: 1,
 		}
 
 		var (
-			doc  Profile
+			doc  map[string][]string
 			list []string
 		)
 		err := serverCtx.DB.C("users").Find(query).Select(selector).One(&doc)
 		if err != nil && err != mgo.ErrNotFound {
 			return err
 		}
-		if doc.Accounts == nil {
-			list = []string{}
+		if lx, ok := doc[listName]; ok {
+			list = lx
 		} else {
-			list = doc.Accounts
+			list = []string{}
 		}
 
 		// Send the chosen list as a response.
@@ -69,7 +171,7 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 		return json.NewEncoder(ctx.Response().Writer).Encode(list)
 	})
 
-	group.POST("/accounts/", func(ctx echo.Context) error {
+	group.POST("/", func(ctx echo.Context) error {
 		// Read the request body.
 		body, err := ioutil.ReadAll(ctx.Request().Body)
 		if err != nil {
@@ -85,7 +187,7 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 
 		update := bson.M{
 			"$push": bson.M{
-				"accounts": string(body),
+				listName: string(body),
 			},
 		}
 
@@ -93,7 +195,7 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 		return err
 	})
 
-	group.DELETE("/accounts/:item/", func(ctx echo.Context) error {
+	group.DELETE("/:item/", func(ctx echo.Context) error {
 		// Push to the database.
 		var (
 			profile = ctx.Get("user").(*users.User)
@@ -106,7 +208,7 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 
 		update := bson.M{
 			"$pull": bson.M{
-				"accounts": item,
+				listName: item,
 			},
 		}
 
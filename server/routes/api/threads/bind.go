@@ -0,0 +1,61 @@
+package threads
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Bind(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		query := bson.M{
+			"ownerId":   bson.ObjectIdHex(profile.Id),
+			"expiresAt": bson.M{"$gt": time.Now()},
+		}
+
+		list := []*notifications.ThreadWatch{}
+		err := serverCtx.DB.C("threadWatches").Find(query).Sort("-expiresAt").All(&list)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get thread watches [query=%+v]", query)
+		}
+
+		// Send the list as a response.
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(list)
+	})
+
+	group.DELETE("/:id/", func(ctx echo.Context) error {
+		var (
+			profile = ctx.Get("user").(*users.User)
+			id      = ctx.Param("id")
+		)
+
+		if !bson.IsObjectIdHex(id) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid thread watch ID")
+		}
+
+		selector := bson.M{
+			"_id":     bson.ObjectIdHex(id),
+			"ownerId": bson.ObjectIdHex(profile.Id),
+		}
+
+		if err := serverCtx.DB.C("threadWatches").Remove(selector); err != nil {
+			if err == mgo.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "thread watch not found")
+			}
+			return errors.Wrapf(err, "failed to remove thread watch [select=%+v]", selector)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	})
+}
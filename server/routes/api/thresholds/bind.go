@@ -0,0 +1,101 @@
+package thresholds
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MaxThresholdsPerUser limits the number of accounts polled on behalf of a single user.
+const MaxThresholdsPerUser = 20
+
+func Bind(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+		}
+
+		list := []*notifications.AccountThreshold{}
+		err := serverCtx.DB.C("accountThresholds").Find(query).Sort("account", "metric").All(&list)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get account thresholds [query=%+v]", query)
+		}
+
+		// Send the list as a response.
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(list)
+	})
+
+	group.POST("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+		ownerId := bson.ObjectIdHex(profile.Id)
+
+		var threshold notifications.AccountThreshold
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&threshold); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid account threshold")
+		}
+
+		// Only the settings are taken from the request, the state is reset.
+		threshold = notifications.AccountThreshold{
+			Id:         bson.NewObjectId(),
+			OwnerId:    ownerId,
+			Account:    strings.ToLower(strings.TrimPrefix(threshold.Account, "@")),
+			Metric:     threshold.Metric,
+			Threshold:  threshold.Threshold,
+			Hysteresis: threshold.Hysteresis,
+		}
+		if err := threshold.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		n, err := serverCtx.DB.C("accountThresholds").Find(bson.M{"ownerId": ownerId}).Count()
+		if err != nil {
+			return errors.Wrap(err, "failed to count account thresholds")
+		}
+		if n >= MaxThresholdsPerUser {
+			return echo.NewHTTPError(http.StatusBadRequest, "too many account thresholds")
+		}
+
+		if err := serverCtx.DB.C("accountThresholds").Insert(&threshold); err != nil {
+			return errors.Wrapf(err, "failed to insert account threshold [doc=%+v]", threshold)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&threshold)
+	})
+
+	group.DELETE("/:id/", func(ctx echo.Context) error {
+		var (
+			profile = ctx.Get("user").(*users.User)
+			id      = ctx.Param("id")
+		)
+
+		if !bson.IsObjectIdHex(id) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid account threshold ID")
+		}
+
+		selector := bson.M{
+			"_id":     bson.ObjectIdHex(id),
+			"ownerId": bson.ObjectIdHex(profile.Id),
+		}
+
+		if err := serverCtx.DB.C("accountThresholds").Remove(selector); err != nil {
+			if err == mgo.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "account threshold not found")
+			}
+			return errors.Wrapf(err, "failed to remove account threshold [select=%+v]", selector)
+		}
+		return nil
+	})
+}
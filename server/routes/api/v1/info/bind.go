@@ -13,8 +13,12 @@ import (
 )
 
 type Info struct {
-	NextBlockNumber    uint32     `json:"nextBlockNumber"`
-	LastBlockTimestamp *time.Time `json:"lastBlockTimestamp,omitempty"`
+	NextBlockNumber             uint32     `json:"nextBlockNumber"`
+	LastBlockTimestamp          *time.Time `json:"lastBlockTimestamp,omitempty"`
+	LastIrreversibleBlockNumber uint32     `json:"lastIrreversibleBlockNumber"`
+
+	// LagSeconds is how many seconds the last checkpointed block is behind the wall clock.
+	LagSeconds int64 `json:"lagSeconds"`
 }
 
 func Bind(serverCtx *context.Context, root *echo.Group) {
@@ -28,6 +32,11 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 		info := &Info{
 			config.NextBlockNum,
 			config.LastBlockTimestamp,
+			config.LastIrreversibleBlockNum,
+			0,
+		}
+		if ts := config.LastBlockTimestamp; ts != nil {
+			info.LagSeconds = int64(time.Since(*ts) / time.Second)
 		}
 
 		resp := ctx.Response()
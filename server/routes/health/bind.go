@@ -0,0 +1,56 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tchap/steemwatch/health"
+
+	"github.com/labstack/echo"
+)
+
+type Report struct {
+	Status string           `json:"status"`
+	Checks []*health.Status `json:"checks"`
+}
+
+// Bind binds the public health endpoints. Only the names and the results
+// of the checks are reported, the error messages are served by BindDetailed.
+func Bind(root *echo.Group, checker *health.Checker) {
+	root.GET("/healthz/", newHandlerFunc(checker.Live, false))
+	root.GET("/readyz/", newHandlerFunc(checker.Ready, false))
+}
+
+// BindDetailed binds the health endpoints including the error messages,
+// meant for the admin server only.
+func BindDetailed(root *echo.Group, checker *health.Checker, m ...echo.MiddlewareFunc) {
+	root.GET("/healthz/", newHandlerFunc(checker.Live, true), m...)
+	root.GET("/readyz/", newHandlerFunc(checker.Ready, true), m...)
+}
+
+func newHandlerFunc(run func() (bool, []*health.Status), detailed bool) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		ok, statuses := run()
+
+		if !detailed {
+			for _, status := range statuses {
+				status.Message = ""
+			}
+		}
+
+		report := &Report{
+			Status: "ok",
+			Checks: statuses,
+		}
+		code := http.StatusOK
+		if !ok {
+			report.Status = "failing"
+			code = http.StatusServiceUnavailable
+		}
+
+		resp := ctx.Response()
+		resp.Header().Set(echo.HeaderContentType, "application/json")
+		resp.WriteHeader(code)
+		return json.NewEncoder(resp.Writer).Encode(report)
+	}
+}
@@ -26,7 +26,10 @@ func (handler *Handler) HandlerFunc(ctx echo.Context) error {
 
 	var (
 		templateName string
-		templateCtx  = &views.PageContext{CanonicalURL: handler.ctx.CanonicalURL}
+		templateCtx  = &views.PageContext{
+			CanonicalURL: handler.ctx.CanonicalURL,
+			Chain:        handler.ctx.Chain,
+		}
 	)
 	if profile == nil {
 		templateName = "welcome.html"
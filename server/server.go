@@ -5,11 +5,13 @@ import (
 	"encoding/hex"
 	"net"
 	"net/http"
-	"net/http/pprof"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/tchap/steemwatch/config"
+	"github.com/tchap/steemwatch/health"
+	"github.com/tchap/steemwatch/notifications"
 	"github.com/tchap/steemwatch/server/auth"
 	"github.com/tchap/steemwatch/server/auth/facebook"
 	"github.com/tchap/steemwatch/server/auth/github"
@@ -18,17 +20,22 @@ import (
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/db"
 	"github.com/tchap/steemwatch/server/routes/api/eventstream"
+	"github.com/tchap/steemwatch/server/routes/api/explain"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/discord"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/slack"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/steemitchat"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/telegram"
 	"github.com/tchap/steemwatch/server/routes/api/profile"
+	"github.com/tchap/steemwatch/server/routes/api/threads"
+	"github.com/tchap/steemwatch/server/routes/api/thresholds"
 	"github.com/tchap/steemwatch/server/routes/api/v1/info"
+	healthRoutes "github.com/tchap/steemwatch/server/routes/health"
 	"github.com/tchap/steemwatch/server/routes/home"
 	"github.com/tchap/steemwatch/server/routes/logout"
 	"github.com/tchap/steemwatch/server/sessions"
 	"github.com/tchap/steemwatch/server/users/stores/mongodb"
 	"github.com/tchap/steemwatch/server/views"
+	"github.com/tchap/steemwatch/steemd"
 
 	"github.com/bwmarrin/discordgo"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -37,6 +44,7 @@ import (
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/middleware"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/tomb.v2"
 )
@@ -51,8 +59,18 @@ type Context struct {
 	t tomb.Tomb
 }
 
-func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session, error) {
-	serverCtx := &context.Context{}
+func Run(
+	mongo *mgo.Database,
+	cfg *config.Config,
+	checker *health.Checker,
+	logger *logrus.Entry,
+	pool *steemd.Pool,
+) (*Context, *discordgo.Session, error) {
+
+	serverCtx := &context.Context{
+		Logger: logger,
+		Chain:  cfg.ChainProfile(),
+	}
 
 	// Environment.
 	switch cfg.Env {
@@ -68,6 +86,10 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 	// Database.
 	serverCtx.DB = mongo
 
+	checker.Add("mongodb", health.Readiness, func() error {
+		return mongo.Session.Ping()
+	})
+
 	// User store.
 	userStore := mongodb.NewUserStore(mongo.C("users"))
 
@@ -112,7 +134,8 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 
 	// Middleware
 	e.Pre(middleware.AddTrailingSlash())
-	e.Use(middleware.Logger())
+	e.Use(middleware.RequestID())
+	e.Use(requestLogger(logger))
 	e.Use(middleware.Recover())
 	e.Use(middleware.Secure())
 	e.Use(session.Middleware(gorillaSessions.NewCookieStore(hashKey, blockKey)))
@@ -132,17 +155,8 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 	csrfConfig.CookiePath = "/"
 	csrf := middleware.CSRFWithConfig(csrfConfig)
 
-	// Debug
-	e.GET("/debug/pprof/cmdline/", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
-	e.GET("/debug/pprof/profile/", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
-	e.GET("/debug/pprof/symbol/", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
-	e.GET("/debug/pprof/trace/", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
-	e.GET("/debug/pprof/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
-	e.GET(
-		"/debug/pprof/*",
-		echo.WrapHandler(http.HandlerFunc(pprof.Index)),
-		middleware.RemoveTrailingSlash(),
-	)
+	// Health
+	healthRoutes.Bind(e.Group(""), checker)
 
 	// Web
 	homeHandler := home.NewHandlerFunc(serverCtx)
@@ -184,18 +198,42 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 	info.Bind(serverCtx, e.Group("/api/v1/info"))
 
 	// API
-	api := e.Group("/api", csrf, auth.Required(serverCtx))
+	api := e.Group("/api", csrf, auth.Required(serverCtx), db.TouchOnWrite(serverCtx))
 
 	// API - Events
 	db.BindList(serverCtx, api.Group("/events/:kind/:list"))
 
+	// API - Thread Watches
+	threads.Bind(serverCtx, api.Group("/threads"))
+
+	// API - Account Thresholds
+	thresholds.Bind(serverCtx, api.Group("/thresholds"))
+
+	// API - Explain
+	var explainer *notifications.Explainer
+	if pool != nil {
+		transport, err := pool.NewTransport()
+		if err != nil {
+			return nil, nil, err
+		}
+		explainer, err = notifications.NewExplainer(
+			transport, mongo, logger.WithField("component", "explainer"))
+		if err != nil {
+			transport.Close()
+			return nil, nil, err
+		}
+		explain.Bind(serverCtx, api.Group("/explain"), explainer)
+	}
+
 	// API - Event Stream
-	manager := eventstream.NewManager()
+	manager := eventstream.NewManager(serverCtx.Chain)
 	manager.Bind(serverCtx, api.Group("/eventstream"))
 
 	// API - Notifiers
 	slack.Bind(serverCtx, api.Group("/notifiers/slack"))
-	steemitchat.Bind(serverCtx, api.Group("/notifiers/steemit-chat"))
+	if serverCtx.Chain.ChatAvailable {
+		steemitchat.Bind(serverCtx, api.Group("/notifiers/steemit-chat"))
+	}
 
 	// Telegram
 	botSecret := make([]byte, 256/8)
@@ -218,6 +256,12 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 		}
 	}
 
+	// The bot session is only verified once per minute, not on every probe.
+	checker.Add("telegram", health.Readiness, health.Cached(func() error {
+		_, err := bot.GetMe()
+		return err
+	}, time.Minute))
+
 	telegram.BindWebhook(serverCtx, e.Group(botURL.String()))
 	telegram.BindAPI(serverCtx, api.Group("/notifiers/telegram"))
 
@@ -241,8 +285,20 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 		return nil, nil, err
 	}
 
+	checker.Add("discord", health.Readiness, func() error {
+		if !dg.DataReady {
+			return errors.New("Discord session not ready")
+		}
+		return nil
+	})
+
 	discord.BindAPI(serverCtx, api.Group("/notifiers/discord"))
 
+	// Admin
+	if err := runAdmin(cfg, checker, &ctx.t); err != nil {
+		return nil, nil, err
+	}
+
 	// Start listening.
 	ctx.t.Go(func() error {
 		http.Serve(listener, e)
@@ -252,11 +308,44 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 	go func() {
 		<-ctx.t.Dying()
 		listener.Close()
+		if explainer != nil {
+			explainer.Close()
+		}
 	}()
 
 	return ctx, dg, nil
 }
 
+// requestLogger logs every request handled using the given logger.
+// The request ID set by the RequestID middleware is included.
+func requestLogger(logger *logrus.Entry) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			req := ctx.Request()
+			resp := ctx.Response()
+			entry := logger.WithFields(logrus.Fields{
+				"request_id": resp.Header().Get(echo.HeaderXRequestID),
+				"method":     req.Method,
+				"uri":        req.RequestURI,
+				"status":     resp.Status,
+				"latency":    time.Since(start).String(),
+				"remote_ip":  ctx.RealIP(),
+			})
+			if err != nil {
+				entry = entry.WithError(err)
+			}
+			entry.Info("request handled")
+			return nil
+		}
+	}
+}
+
 func (ctx *Context) Interrupt() {
 	ctx.t.Kill(nil)
 }
@@ -5,6 +5,8 @@ import (
 	"io"
 	"net/url"
 
+	"github.com/tchap/steemwatch/chain"
+
 	"github.com/labstack/echo"
 )
 
@@ -14,6 +16,7 @@ type PageContext struct {
 	UserId          string
 	UserEmail       string
 	UserDisplayName string
+	Chain           *chain.Profile
 }
 
 type Template struct {
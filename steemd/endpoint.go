@@ -0,0 +1,231 @@
+package steemd
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/go-steem/rpc/transports/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// ewmaWeight is the weight of the latest sample in the moving averages.
+const ewmaWeight = 0.2
+
+// endpoint keeps track of the health of a single steemd endpoint.
+// It is shared by all the transports created by a pool.
+//
+// The connection state is tracked for every WebSocket transport separately,
+// the endpoint is considered connected as long as any of the transports is.
+type endpoint struct {
+	url       string
+	websocket bool
+
+	latency       time.Duration
+	errorRate     float64
+	conns         map[*trackedTransport]bool
+	headBlockNum  uint32
+	headBlockTime time.Time
+
+	lock sync.Mutex
+}
+
+func newEndpoint(rawURL string) (*endpoint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid steemd endpoint: %v", rawURL)
+	}
+
+	ep := &endpoint{
+		url:   rawURL,
+		conns: make(map[*trackedTransport]bool),
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+		ep.websocket = true
+	case "http", "https":
+		// HTTP is connectionless.
+	default:
+		return nil, errors.Errorf("unsupported steemd endpoint scheme: %v", rawURL)
+	}
+	return ep, nil
+}
+
+// dial creates a transport for the endpoint based on the URL scheme.
+func (ep *endpoint) dial(timeout time.Duration, logger *logrus.Entry) (interfaces.CallCloser, error) {
+	if !ep.websocket {
+		return NewHTTPTransport(ep.url, timeout), nil
+	}
+
+	tracked := &trackedTransport{
+		ep:   ep,
+		done: make(chan struct{}),
+	}
+	ep.lock.Lock()
+	ep.conns[tracked] = false
+	ep.lock.Unlock()
+
+	monitorChan := make(chan interface{})
+	go tracked.track(monitorChan, logger)
+
+	t, err := websocket.NewTransport([]string{ep.url},
+		websocket.SetDialTimeout(timeout),
+		websocket.SetWriteTimeout(timeout/2),
+		websocket.SetReadTimeout(timeout),
+		websocket.SetAutoReconnectEnabled(true),
+		websocket.SetAutoReconnectMaxDelay(1*time.Minute),
+		websocket.SetMonitor(monitorChan))
+	if err != nil {
+		tracked.untrack()
+		return nil, errors.Wrapf(err, "failed to initialize WebSocket transport for %v", ep.url)
+	}
+	tracked.CallCloser = t
+	return tracked, nil
+}
+
+// connected returns true in case the endpoint can be called right away.
+// The caller is expected to hold the lock.
+func (ep *endpoint) connected() bool {
+	if !ep.websocket {
+		return true
+	}
+	for _, connected := range ep.conns {
+		if connected {
+			return true
+		}
+	}
+	return false
+}
+
+// trackedTransport is a WebSocket transport the connection state of which
+// is tracked by the endpoint until the transport is closed.
+type trackedTransport struct {
+	interfaces.CallCloser
+	ep   *endpoint
+	done chan struct{}
+}
+
+// track updates the connection state based on the WebSocket transport events.
+func (t *trackedTransport) track(monitorChan <-chan interface{}, logger *logrus.Entry) {
+	for {
+		select {
+		case event := <-monitorChan:
+			logger.WithField("endpoint", t.ep.url).Infof("connection: %v", event)
+
+			t.ep.lock.Lock()
+			if _, ok := t.ep.conns[t]; ok {
+				switch event.(type) {
+				case *websocket.ConnectedEvent:
+					t.ep.conns[t] = true
+				case *websocket.DisconnectedEvent:
+					t.ep.conns[t] = false
+				}
+			}
+			t.ep.lock.Unlock()
+
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// untrack stops tracking the connection state of the transport.
+func (t *trackedTransport) untrack() {
+	t.ep.lock.Lock()
+	delete(t.ep.conns, t)
+	t.ep.lock.Unlock()
+	close(t.done)
+}
+
+func (t *trackedTransport) Close() error {
+	err := t.CallCloser.Close()
+	t.untrack()
+	return err
+}
+
+// observe records the outcome of a call.
+// Errors returned by steemd itself are not counted, the endpoint is working fine in that case.
+func (ep *endpoint) observe(latency time.Duration, err error) {
+	failed := err != nil
+	if _, ok := errors.Cause(err).(*jsonrpc2.Error); ok {
+		failed = false
+	}
+
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	if ep.latency == 0 {
+		ep.latency = latency
+	} else if !failed {
+		ep.latency = time.Duration(ewmaWeight*float64(latency) + (1-ewmaWeight)*float64(ep.latency))
+	}
+
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	ep.errorRate = ewmaWeight*sample + (1-ewmaWeight)*ep.errorRate
+}
+
+// observeHead records the head block reported by the endpoint.
+func (ep *endpoint) observeHead(num uint32, timestamp time.Time) {
+	ep.lock.Lock()
+	ep.headBlockNum = num
+	ep.headBlockTime = timestamp
+	ep.lock.Unlock()
+}
+
+// EndpointStatus describes the health of a steemd endpoint.
+type EndpointStatus struct {
+	URL           string        `json:"url"`
+	Connected     bool          `json:"connected"`
+	Latency       time.Duration `json:"latency"`
+	ErrorRate     float64       `json:"errorRate"`
+	HeadBlockNum  uint32        `json:"headBlockNumber"`
+	HeadBlockTime time.Time     `json:"headBlockTime"`
+	HeadBlockAge  time.Duration `json:"headBlockAge"`
+	BlocksBehind  uint32        `json:"blocksBehind"`
+	Score         float64       `json:"score"`
+	Healthy       bool          `json:"healthy"`
+}
+
+// status computes the endpoint status given the highest head block number known.
+//
+// The score is expressed in seconds, lower is better. Errors and every block
+// the endpoint is behind the other endpoints are penalized.
+func (ep *endpoint) status(bestHead uint32, maxBlocksBehind uint32, maxHeadAge time.Duration) *EndpointStatus {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	connected := ep.connected()
+	status := &EndpointStatus{
+		URL:           ep.url,
+		Connected:     connected,
+		Latency:       ep.latency,
+		ErrorRate:     ep.errorRate,
+		HeadBlockNum:  ep.headBlockNum,
+		HeadBlockTime: ep.headBlockTime,
+	}
+	if bestHead > ep.headBlockNum {
+		status.BlocksBehind = bestHead - ep.headBlockNum
+	}
+	if !ep.headBlockTime.IsZero() {
+		status.HeadBlockAge = time.Since(ep.headBlockTime)
+	}
+
+	status.Score = ep.latency.Seconds() + 10*ep.errorRate + 3*float64(status.BlocksBehind)
+	if !connected {
+		status.Score += 60
+	}
+
+	status.Healthy = connected &&
+		ep.headBlockNum != 0 &&
+		ep.errorRate < 0.5 &&
+		status.BlocksBehind <= maxBlocksBehind &&
+		!ep.headBlockTime.IsZero() &&
+		status.HeadBlockAge <= maxHeadAge
+	return status
+}
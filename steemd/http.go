@@ -0,0 +1,98 @@
+package steemd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// HTTPTransport implements JSON-RPC 2.0 over HTTP.
+// It can be used anywhere the WebSocket transport is used.
+type HTTPTransport struct {
+	url    string
+	client *http.Client
+	nextId uint64
+}
+
+func NewHTTPTransport(url string, timeout time.Duration) *HTTPTransport {
+	return &HTTPTransport{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Id      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Id     uint64           `json:"id"`
+	Result *json.RawMessage `json:"result"`
+	Error  *jsonrpc2.Error  `json:"error"`
+}
+
+// Call sends the request and decodes the result into response.
+// In case steemd returns an error, *jsonrpc2.Error is returned,
+// the same way the WebSocket transport does it.
+func (t *HTTPTransport) Call(method string, params, response interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(&rpcRequest{
+		JSONRPC: "2.0",
+		Id:      atomic.AddUint64(&t.nextId, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode request: %v", method)
+	}
+
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "failed to call %v", method)
+	}
+	defer resp.Body.Close()
+
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		// Drain the body so that the connection can be reused.
+		io.Copy(ioutil.Discard, resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("failed to call %v: %v", method, resp.Status)
+		}
+		return errors.Wrapf(err, "failed to decode response: %v", method)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to call %v: %v", method, resp.Status)
+	}
+
+	if response == nil || rpcResp.Result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(*rpcResp.Result, response); err != nil {
+		return errors.Wrapf(err, "failed to decode result: %v", method)
+	}
+	return nil
+}
+
+// Close is a no-op, there is no connection to be closed.
+func (t *HTTPTransport) Close() error {
+	return nil
+}
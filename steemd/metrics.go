@@ -0,0 +1,45 @@
+package steemd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	endpointScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "steemwatch",
+		Name:      "steemd_endpoint_score",
+		Help:      "Health score of the steemd endpoint, lower is better.",
+	}, []string{"endpoint"})
+
+	endpointHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "steemwatch",
+		Name:      "steemd_endpoint_healthy",
+		Help:      "Whether the steemd endpoint is considered healthy.",
+	}, []string{"endpoint"})
+
+	endpointBlocksBehind = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "steemwatch",
+		Name:      "steemd_endpoint_blocks_behind",
+		Help:      "Number of blocks the steemd endpoint is behind the best endpoint.",
+	}, []string{"endpoint"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		endpointScore,
+		endpointHealthy,
+		endpointBlocksBehind,
+	)
+}
+
+func (pool *Pool) updateMetrics() {
+	for _, status := range pool.Status() {
+		healthy := 0.0
+		if status.Healthy {
+			healthy = 1
+		}
+		endpointScore.WithLabelValues(status.URL).Set(status.Score)
+		endpointHealthy.WithLabelValues(status.URL).Set(healthy)
+		endpointBlocksBehind.WithLabelValues(status.URL).Set(float64(status.BlocksBehind))
+	}
+}
@@ -0,0 +1,320 @@
+package steemd
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sourcegraph/jsonrpc2"
+	"gopkg.in/tomb.v2"
+)
+
+const (
+	DefaultTimeout         = 1 * time.Minute
+	DefaultProbeInterval   = 10 * time.Second
+	DefaultMaxBlocksBehind = 20
+	DefaultMaxHeadAge      = 1 * time.Minute
+)
+
+// Pool keeps track of the health of a set of steemd endpoints
+// and creates transports failing over between them.
+//
+// The endpoints are probed periodically for the head block so that the endpoints
+// lagging behind the others are avoided, even when they respond just fine.
+// The endpoints reporting a stale head block are avoided as well, that is the case
+// when all the endpoints are stuck at the same block.
+type Pool struct {
+	endpoints       []*endpoint
+	timeout         time.Duration
+	probeInterval   time.Duration
+	maxBlocksBehind uint32
+	maxHeadAge      time.Duration
+	logger          *logrus.Entry
+
+	t tomb.Tomb
+}
+
+type Option func(*Pool)
+
+// SetTimeout sets the timeout used for the calls and for dialing.
+func SetTimeout(timeout time.Duration) Option {
+	return func(pool *Pool) {
+		pool.timeout = timeout
+	}
+}
+
+// SetProbeInterval sets how often the endpoints are asked for the head block.
+func SetProbeInterval(interval time.Duration) Option {
+	return func(pool *Pool) {
+		pool.probeInterval = interval
+	}
+}
+
+// SetMaxBlocksBehind sets how many blocks an endpoint can be behind the others to be considered healthy.
+func SetMaxBlocksBehind(n uint32) Option {
+	return func(pool *Pool) {
+		pool.maxBlocksBehind = n
+	}
+}
+
+// SetMaxHeadAge sets how old the head block reported by an endpoint can be for the endpoint to be considered healthy.
+func SetMaxHeadAge(age time.Duration) Option {
+	return func(pool *Pool) {
+		pool.maxHeadAge = age
+	}
+}
+
+// SetLogger sets the logger to be used. The standard logrus logger is used by default.
+func SetLogger(logger *logrus.Entry) Option {
+	return func(pool *Pool) {
+		pool.logger = logger
+	}
+}
+
+// NewPool creates a pool for the given endpoint URLs.
+// The transport is selected by the URL scheme, ws(s) for WebSocket and http(s) for HTTP.
+//
+// The endpoints that cannot be reached are considered unhealthy,
+// they are dialed again every time they are to be probed.
+func NewPool(urls []string, opts ...Option) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no steemd endpoint specified")
+	}
+
+	pool := &Pool{
+		timeout:         DefaultTimeout,
+		probeInterval:   DefaultProbeInterval,
+		maxBlocksBehind: DefaultMaxBlocksBehind,
+		maxHeadAge:      DefaultMaxHeadAge,
+		logger:          logrus.NewEntry(logrus.StandardLogger()),
+	}
+	for _, opt := range opts {
+		opt(pool)
+	}
+
+	for _, u := range urls {
+		ep, err := newEndpoint(u)
+		if err != nil {
+			return nil, err
+		}
+		pool.endpoints = append(pool.endpoints, ep)
+	}
+
+	// Start probing the endpoints.
+	for _, ep := range pool.endpoints {
+		ep := ep
+		pool.t.Go(func() error {
+			return pool.prober(ep)
+		})
+	}
+
+	return pool, nil
+}
+
+func (pool *Pool) prober(ep *endpoint) error {
+	var conn interfaces.CallCloser
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	probe := func() {
+		if conn == nil {
+			c, err := ep.dial(pool.timeout, pool.logger)
+			if err != nil {
+				ep.observe(0, err)
+				pool.logger.WithError(err).WithField("endpoint", ep.url).Warn("steemd endpoint unreachable")
+				return
+			}
+			conn = c
+		}
+
+		var props struct {
+			HeadBlockNumber uint32 `json:"head_block_number"`
+			Time            string `json:"time"`
+		}
+		start := time.Now()
+		err := conn.Call("get_dynamic_global_properties", []interface{}{}, &props)
+		ep.observe(time.Since(start), err)
+		if err != nil {
+			pool.logger.WithError(err).WithField("endpoint", ep.url).Warn("steemd probe failed")
+			return
+		}
+
+		timestamp, _ := time.Parse("2006-01-02T15:04:05", props.Time)
+		ep.observeHead(props.HeadBlockNumber, timestamp)
+	}
+
+	probe()
+	pool.updateMetrics()
+
+	ticker := time.NewTicker(pool.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			probe()
+			pool.updateMetrics()
+		case <-pool.t.Dying():
+			return nil
+		}
+	}
+}
+
+// Status returns the status of all the endpoints, the best endpoint first.
+func (pool *Pool) Status() []*EndpointStatus {
+	var bestHead uint32
+	for _, ep := range pool.endpoints {
+		ep.lock.Lock()
+		if ep.headBlockNum > bestHead {
+			bestHead = ep.headBlockNum
+		}
+		ep.lock.Unlock()
+	}
+
+	statuses := make([]*EndpointStatus, 0, len(pool.endpoints))
+	for _, ep := range pool.endpoints {
+		statuses = append(statuses, ep.status(bestHead, pool.maxBlocksBehind, pool.maxHeadAge))
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		if statuses[i].Healthy != statuses[j].Healthy {
+			return statuses[i].Healthy
+		}
+		return statuses[i].Score < statuses[j].Score
+	})
+	return statuses
+}
+
+// ranked returns the endpoints ordered the way they are to be tried.
+func (pool *Pool) ranked() []*endpoint {
+	byURL := make(map[string]*endpoint, len(pool.endpoints))
+	for _, ep := range pool.endpoints {
+		byURL[ep.url] = ep
+	}
+
+	statuses := pool.Status()
+	eps := make([]*endpoint, 0, len(statuses))
+	for _, status := range statuses {
+		eps = append(eps, byURL[status.URL])
+	}
+	return eps
+}
+
+// Check fails in case none of the endpoints is healthy.
+func (pool *Pool) Check() error {
+	statuses := pool.Status()
+	if statuses[0].Healthy {
+		return nil
+	}
+
+	urls := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		urls = append(urls, status.URL)
+	}
+	return errors.Errorf("no healthy steemd endpoint: %v", strings.Join(urls, ", "))
+}
+
+// NewTransport returns a transport failing over between the endpoints.
+// The connections to the endpoints are established lazily.
+func (pool *Pool) NewTransport() (*Transport, error) {
+	if !pool.t.Alive() {
+		return nil, errors.New("steemd pool closed")
+	}
+	return &Transport{
+		pool:  pool,
+		conns: make(map[*endpoint]interfaces.CallCloser),
+	}, nil
+}
+
+// Close stops probing the endpoints.
+// The transports created by the pool are to be closed separately.
+func (pool *Pool) Close() error {
+	pool.t.Kill(nil)
+	return pool.t.Wait()
+}
+
+// Transport implements interfaces.CallCloser, failing over between the pool endpoints.
+//
+// Every call is sent to the best endpoint available. In case it fails
+// without steemd returning an error, the call is retried using the next endpoint.
+type Transport struct {
+	pool   *Pool
+	conns  map[*endpoint]interfaces.CallCloser
+	closed bool
+	lock   sync.Mutex
+}
+
+func (t *Transport) conn(ep *endpoint) (interfaces.CallCloser, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil, errors.New("transport closed")
+	}
+	if conn, ok := t.conns[ep]; ok {
+		return conn, nil
+	}
+
+	conn, err := ep.dial(t.pool.timeout, t.pool.logger)
+	if err != nil {
+		return nil, err
+	}
+	t.conns[ep] = conn
+	return conn, nil
+}
+
+func (t *Transport) Call(method string, params, response interface{}) error {
+	var lastErr error
+	for _, ep := range t.pool.ranked() {
+		conn, err := t.conn(ep)
+		if err != nil {
+			ep.observe(0, err)
+			lastErr = err
+			continue
+		}
+
+		start := time.Now()
+		err = conn.Call(method, params, response)
+		ep.observe(time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+
+		// steemd processed the request, another endpoint would return the same error.
+		if _, ok := errors.Cause(err).(*jsonrpc2.Error); ok {
+			return err
+		}
+
+		t.pool.logger.WithError(err).WithFields(logrus.Fields{
+			"endpoint": ep.url,
+			"method":   method,
+		}).Warn("steemd call failed, failing over ...")
+		lastErr = err
+	}
+	return errors.Wrapf(lastErr, "all steemd endpoints failed to handle %v", method)
+}
+
+func (t *Transport) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	var firstErr error
+	for _, conn := range t.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}